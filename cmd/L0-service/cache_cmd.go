@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/beganov/L0/internal/cache"
+	"github.com/beganov/L0/internal/config"
+	"github.com/beganov/L0/internal/database"
+	"github.com/beganov/L0/internal/logger"
+)
+
+// cache warm|dump
+func runCache(args []string) {
+	sub, args := subcommand("cache", args)
+	fs := flag.NewFlagSet("cache "+sub, flag.ContinueOnError)
+
+	switch sub {
+	case "warm":
+		cacheWarm(fs, args)
+	case "dump":
+		cacheDump(fs, args)
+	default:
+		fmt.Fprintf(os.Stderr, "cache: unknown subcommand %q\n", sub)
+		os.Exit(2)
+	}
+}
+
+// load latest orders from DB, write snapshot and push them to L2
+// so that service instances start warm
+func cacheWarm(fs *flag.FlagSet, args []string) {
+	ctx := context.Background()
+	cfg := loadCommandConfig(fs, args, config.SectionPostgres, config.SectionCache)
+	if cfg.Cache.SnapshotPath == "" && cfg.Redis.URL == "" {
+		logger.Fatal(fmt.Errorf("neither cache.snapshot_path nor redis.url is set"), "Nothing to warm")
+	}
+
+	db := database.InitDB(ctx, cfg.Postgres.URL)
+	defer db.Close()
+
+	c := cache.NewOrderCache(cfg.Cache.Capacity)
+	if err := database.LoadCacheFromDB(ctx, db, c, cfg.Postgres.SelectTimeout); err != nil {
+		logger.Fatal(err, "Failed to load orders from DB")
+	}
+	logger.Info("Orders loaded from DB", "orders", c.Len())
+
+	if cfg.Cache.SnapshotPath != "" {
+		if err := c.SaveSnapshot(cfg.Cache.SnapshotPath); err != nil {
+			logger.Fatal(err, "Failed to save cache snapshot")
+		}
+		logger.Info("Cache snapshot saved", "path", cfg.Cache.SnapshotPath)
+	}
+
+	if cfg.Redis.URL != "" {
+		l2, err := cache.NewRedisCache(ctx, cfg.Redis.URL, cfg.Redis.Prefix, cfg.Redis.TTL)
+		if err != nil {
+			logger.Fatal(err, "L2 cache unavailable")
+		}
+		defer l2.Close()
+
+		for _, o := range c.Orders() {
+			if err := l2.Set(ctx, o); err != nil {
+				logger.Fatal(err, "Failed to write order to L2")
+			}
+		}
+		logger.Info("L2 cache warmed", "orders", c.Len())
+	}
+}
+
+// print snapshot content as NDJSON, least recently used first
+func cacheDump(fs *flag.FlagSet, args []string) {
+	cfg := loadCommandConfig(fs, args, config.SectionCache)
+	if cfg.Cache.SnapshotPath == "" {
+		logger.Fatal(fmt.Errorf("cache.snapshot_path is not set"), "Nothing to dump")
+	}
+
+	orders, err := cache.ReadSnapshot(cfg.Cache.SnapshotPath)
+	if err != nil {
+		logger.Fatal(err, "Failed to read cache snapshot")
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	for _, o := range orders {
+		if err := enc.Encode(o); err != nil {
+			logger.Fatal(err, "Failed to write order")
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/beganov/L0/internal/config"
+	"github.com/beganov/L0/internal/logger"
+)
+
+// config print|validate
+func runConfig(args []string) {
+	sub, args := subcommand("config", args)
+	fs := flag.NewFlagSet("config "+sub, flag.ContinueOnError)
+
+	switch sub {
+	case "print":
+		cfg := loadConfigOrExit(fs, args)
+		if err := cfg.Print(os.Stdout); err != nil {
+			logger.Fatal(err, "Cannot print configuration")
+		}
+	case "validate":
+		// all problems are reported at once, exit code is for CI
+		if _, err := config.LoadFlags(fs, args); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println("ok")
+	default:
+		fmt.Fprintf(os.Stderr, "config: unknown subcommand %q\n", sub)
+		os.Exit(2)
+	}
+}
@@ -1,128 +1,84 @@
 package main
 
 import (
-	"context"
-	"net/http"
+	"flag"
+	"fmt"
 	"os"
-	"os/signal"
-	"syscall"
-	"time"
+	"strings"
 
-	"github.com/beganov/L0/internal/api"
-	"github.com/beganov/L0/internal/broker"
-	"github.com/beganov/L0/internal/cache"
 	"github.com/beganov/L0/internal/config"
-	"github.com/beganov/L0/internal/database"
 	"github.com/beganov/L0/internal/logger"
-	"github.com/beganov/L0/internal/metrics"
-
-	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/joho/godotenv"
-	"github.com/segmentio/kafka-go"
 )
 
-func main() {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	loadEnvOrExit() // dotenv + config
-	metrics.Init()  // Prometheus
-	config.VarsInit()
-
-	handleSignals(cancel) // Ctrl+C/SIGTERM
-
-	database.RunMigrations(config.PostgresURL)
+const usage = `usage: L0-service <command> [flags]
 
-	db := database.InitDB(ctx, config.PostgresURL)
-	defer db.Close()
+commands:
+  serve [--api-only|--consumer-only] [--no-migrate]  run the service (default)
+  migrate up|down|status|create NAME                 manage DB schema
+  cache warm|dump                                    fill L2/snapshot from DB, dump snapshot as NDJSON
+  orders get ID|export|import|erase                  read and write orders as JSON/NDJSON, erase one customer
+  replay [--from T|--offsets P=O,..] [--dry-run]     re-ingest topic with a temporary group
+  config print|validate                              show or check effective config
 
-	reader := initKafkaReader()
-	defer reader.Close()
+every command accepts config flags, see "L0-service serve -h"
+`
 
-	orderCache := initCache(ctx, db)
-
-	httpSrv := startHTTPServer(orderCache, db)
-
-	// Kafka consumer
-	go broker.ConsumeKafka(ctx, reader, db, orderCache)
-
-	<-ctx.Done()
-	logger.Info("Shutting down services")
-
-	gracefulShutdown(httpSrv, db, reader)
-	logger.Info("App stopped")
-}
+func main() {
+	args := os.Args[1:]
 
-// Load environment variables or exit
-func loadEnvOrExit() {
-	if err := godotenv.Load(); err != nil {
-		logger.Fatal(err, "No .env file found")
+	// no command keeps the old "just run it" behaviour
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		runServe(args)
+		return
 	}
-}
-
-// Handle OS signals
-func handleSignals(cancel context.CancelFunc) {
-	go func() {
-		c := make(chan os.Signal, 1)
-		signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
-		sig := <-c
-		logger.Info("Caught signal", sig)
-		cancel()
-	}()
-}
-
-// Init Kafka consumer with basic logging
-func initKafkaReader() *kafka.Reader {
-	r := kafka.NewReader(kafka.ReaderConfig{
-		Brokers: []string{config.KafkaBroker},
-		Topic:   config.KafkaTopic,
-		GroupID: config.KafkaGroupID,
-	})
-	logger.Info("Kafka reader initialized for topic", config.KafkaTopic)
-	return r
-}
 
-// Init cache and try restoring from DB
-func initCache(ctx context.Context, db *pgxpool.Pool) *cache.OrderCache {
-	c := cache.NewOrderCache(config.CacheCap)
-	if err := database.LoadCacheFromDB(ctx, db, c); err != nil {
-		metrics.DBErrorsTotal.Inc()
-		logger.Error(err, "Failed to fully restore cache")
-	} else {
-		logger.Info("Cache restored from DB")
+	cmd, args := args[0], args[1:]
+	switch cmd {
+	case "serve":
+		runServe(args)
+	case "migrate":
+		runMigrate(args)
+	case "cache":
+		runCache(args)
+	case "orders":
+		runOrders(args)
+	case "replay":
+		runReplay(args)
+	case "config":
+		runConfig(args)
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", cmd, usage)
+		os.Exit(2)
 	}
-	return c
 }
 
-// Start HTTP server
-func startHTTPServer(orderCache *cache.OrderCache, db *pgxpool.Pool) *http.Server {
-	srv := &http.Server{
-		Addr:    config.HttpAddr,
-		Handler: api.SetupRouter(orderCache, db),
+// split "sub [flags...]" of a command group
+func subcommand(group string, args []string) (string, []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Fprintf(os.Stderr, "%s: subcommand required\n\n%s", group, usage)
+		os.Exit(2)
 	}
-	go func() {
-		logger.Info("HTTP server running at", config.HttpAddr)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logger.Fatal(err, "HTTP server failed")
-		}
-	}()
-	return srv
+	return args[0], args[1:]
 }
 
-// Graceful shutdown for all services
-func gracefulShutdown(srv *http.Server, db *pgxpool.Pool, reader *kafka.Reader) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	if err := srv.Shutdown(ctx); err != nil {
-		logger.Error(err, "HTTP server shutdown failed")
+// Load and validate config from file, env and flags or exit
+func loadConfigOrExit(fs *flag.FlagSet, args []string) *config.Config {
+	cfg, err := config.LoadFlags(fs, args)
+	if err != nil {
+		logger.Fatal(err, "Invalid configuration")
 	}
+	return cfg
+}
 
-	db.Close()
-
-	if err := reader.Close(); err != nil {
-		logger.Error(err, "Kafka reader shutdown failed")
+// config for one-shot commands, only the sections they use are validated.
+// logs go to stderr so stdout stays clean
+func loadCommandConfig(fs *flag.FlagSet, args []string, sections ...config.Section) *config.Config {
+	cfg, err := config.LoadSections(fs, args, sections...)
+	if err != nil {
+		logger.Fatal(err, "Invalid configuration")
 	}
-
-	logger.Info("All services stopped")
+	logger.Init(cfg.Log.Level)
+	return cfg
 }
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/beganov/L0/internal/config"
+	"github.com/beganov/L0/internal/database"
+	"github.com/beganov/L0/internal/logger"
+)
+
+// migrate up|down|status|create NAME
+func runMigrate(args []string) {
+	sub, args := subcommand("migrate", args)
+	fs := flag.NewFlagSet("migrate "+sub, flag.ContinueOnError)
+
+	var extra []string
+	sections := []config.Section{config.SectionPostgres}
+	switch sub {
+	case "up", "down", "status":
+	case "create":
+		// name goes before config flags
+		if len(args) == 0 {
+			fmt.Fprintln(os.Stderr, "migrate create: NAME required")
+			os.Exit(2)
+		}
+		extra, args = []string{args[0]}, args[1:]
+		// only writes a file, no connection settings needed
+		sections = nil
+	default:
+		fmt.Fprintf(os.Stderr, "migrate: unknown subcommand %q\n", sub)
+		os.Exit(2)
+	}
+
+	cfg := loadCommandConfig(fs, args, sections...)
+	err := database.Migrate(context.Background(), cfg.Postgres.URL, cfg.Postgres.MigrationPath, sub, os.Stdout, extra...)
+	if err != nil {
+		logger.Fatal(err, "Migration failed")
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/beganov/L0/internal/cache"
+	"github.com/beganov/L0/internal/config"
+	"github.com/beganov/L0/internal/database"
+	"github.com/beganov/L0/internal/erasure"
+	"github.com/beganov/L0/internal/logger"
+	"github.com/beganov/L0/internal/models"
+	"github.com/beganov/L0/internal/pii"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// orders get ID | export [--out FILE] | import [FILE] | erase --customer-id|--email|--phone V [--dry-run]
+func runOrders(args []string) {
+	sub, args := subcommand("orders", args)
+	fs := flag.NewFlagSet("orders "+sub, flag.ContinueOnError)
+
+	switch sub {
+	case "get":
+		if len(args) == 0 {
+			fmt.Fprintln(os.Stderr, "orders get: ID required")
+			os.Exit(2)
+		}
+		ordersGet(fs, args[0], args[1:])
+	case "export":
+		out := fs.String("out", "", "write NDJSON to file instead of stdout")
+		ordersExport(fs, args, out)
+	case "import":
+		ordersImport(fs, args)
+	case "erase":
+		ordersErase(fs, args)
+	default:
+		fmt.Fprintf(os.Stderr, "orders: unknown subcommand %q\n", sub)
+		os.Exit(2)
+	}
+}
+
+// print one order from DB as indented JSON
+func ordersGet(fs *flag.FlagSet, id string, args []string) {
+	ctx := context.Background()
+	cfg := loadCommandConfig(fs, args, config.SectionPostgres)
+
+	db := database.InitDB(ctx, cfg.Postgres.URL)
+	defer db.Close()
+
+	order, err := database.GetOrderFromDB(ctx, db, id, cfg.Postgres.SelectTimeout)
+	if errors.Is(err, pgx.ErrNoRows) {
+		fmt.Fprintf(os.Stderr, "order %s not found\n", id)
+		os.Exit(1)
+	}
+	if err != nil {
+		logger.Fatal(err, "Failed to get order")
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(order); err != nil {
+		logger.Fatal(err, "Failed to write order")
+	}
+}
+
+// write all orders as NDJSON, oldest first
+func ordersExport(fs *flag.FlagSet, args []string, out *string) {
+	ctx := context.Background()
+	cfg := loadCommandConfig(fs, args, config.SectionPostgres)
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			logger.Fatal(err, "Cannot create output file")
+		}
+		defer f.Close()
+		w = f
+	}
+	bw := bufio.NewWriter(w)
+
+	db := database.InitDB(ctx, cfg.Postgres.URL)
+	defer db.Close()
+
+	enc := json.NewEncoder(bw)
+	n := 0
+	err := database.ForEachOrder(ctx, db, cfg.Postgres.SelectTimeout, func(o models.Order) error {
+		n++
+		return enc.Encode(o)
+	})
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		logger.Fatal(err, "Export failed")
+	}
+	logger.Info("Orders exported", "orders", n)
+}
+
+// read NDJSON orders from file or stdin, invalid lines are reported and skipped
+func ordersImport(fs *flag.FlagSet, args []string) {
+	ctx := context.Background()
+	cfg := loadCommandConfig(fs, args, config.SectionPostgres)
+
+	r := io.Reader(os.Stdin)
+	if path := fs.Arg(0); path != "" && path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			logger.Fatal(err, "Cannot open input file")
+		}
+		defer f.Close()
+		r = f
+	}
+
+	db := database.InitDB(ctx, cfg.Postgres.URL)
+	defer db.Close()
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	accepted, rejected, line := 0, 0, 0
+	for sc.Scan() {
+		line++
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+
+		var order models.Order
+		if err := json.Unmarshal(sc.Bytes(), &order); err != nil {
+			rejected++
+			fmt.Fprintf(os.Stderr, "line %d: invalid JSON: %v\n", line, err)
+			continue
+		}
+		if err := order.Validate(); err != nil {
+			rejected++
+			fmt.Fprintf(os.Stderr, "line %d: invalid order %s: %v\n", line, order.OrderUID, err)
+			continue
+		}
+		if err := database.SaveOrder(ctx, db, order, cfg.Postgres.InsertTimeout); err != nil {
+			rejected++
+			fmt.Fprintf(os.Stderr, "line %d: save %s: %v\n", line, order.OrderUID, err)
+			continue
+		}
+		accepted++
+	}
+	if err := sc.Err(); err != nil {
+		logger.Fatal(err, "Failed to read input")
+	}
+
+	fmt.Printf("accepted %d, rejected %d\n", accepted, rejected)
+	if rejected > 0 {
+		os.Exit(1)
+	}
+}
+
+// anonymize one customer's orders, prints the result as JSON.
+// running instances keep in-memory copies, prefer POST /admin/erasure while they run
+func ordersErase(fs *flag.FlagSet, args []string) {
+	var req erasure.Request
+	fs.StringVar(&req.CustomerID, "customer-id", "", "customer whose orders are anonymized")
+	fs.StringVar(&req.Email, "email", "", "delivery email whose orders are anonymized")
+	fs.StringVar(&req.Phone, "phone", "", "delivery phone whose orders are anonymized, digits are compared")
+	fs.StringVar(&req.Reason, "reason", "", "ticket or legal basis kept in the audit")
+	fs.BoolVar(&req.DryRun, "dry-run", false, "only list the orders, nothing is changed")
+	ctx := context.Background()
+	cfg := loadCommandConfig(fs, args, config.SectionPostgres, config.SectionCache)
+	pii.SetHashKey(cfg.PII.HashKey)
+	if err := req.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	db := database.InitDB(ctx, cfg.Postgres.URL)
+	defer db.Close()
+	var l2 *cache.RedisCache
+	if !req.DryRun {
+		l2 = initL2Cache(ctx, cfg)
+		defer l2.Close()
+	}
+
+	// running instances evict their own copies once they see the audit record
+	actor := "cli:" + os.Getenv("USER")
+	res, err := erasure.Erase(ctx, cfg, erasure.Target{DB: db, L2: l2}, actor, req)
+	if err != nil && res.AuditID == 0 {
+		logger.Fatal(err, "Erasure failed")
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if encErr := enc.Encode(res); encErr != nil {
+		logger.Error(encErr, "Failed to write erasure result")
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
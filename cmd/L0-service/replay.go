@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/beganov/L0/internal/broker"
+	"github.com/beganov/L0/internal/cache"
+	"github.com/beganov/L0/internal/config"
+	"github.com/beganov/L0/internal/database"
+	"github.com/beganov/L0/internal/logger"
+)
+
+// replay [--from TIME] [--offsets P=OFF,...] [--partitions P,...] [--dry-run]
+func runReplay(args []string) {
+	var from, offsets, partitions string
+	var req broker.ReplayRequest
+
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	fs.StringVar(&from, "from", "", "start at messages written since RFC3339 time")
+	fs.StringVar(&offsets, "offsets", "", "start offsets by partition, e.g. 0=120,1=80")
+	fs.StringVar(&partitions, "partitions", "", "comma separated partitions, all by default")
+	fs.BoolVar(&req.DryRun, "dry-run", false, "only count, nothing is written")
+	cfg := loadCommandConfig(fs, args, config.SectionKafka, config.SectionPostgres, config.SectionCache)
+	if cfg.Broker.Type != config.BrokerKafka {
+		logger.Fatal(errors.New("replay needs broker.type kafka"), "Replay unavailable")
+	}
+
+	var err error
+	if from != "" {
+		if req.From, err = time.Parse(time.RFC3339, from); err != nil {
+			logger.Fatal(err, "Invalid --from")
+		}
+	}
+	if req.Offsets, err = parseOffsets(offsets); err != nil {
+		logger.Fatal(err, "Invalid --offsets")
+	}
+	if req.Partitions, err = parsePartitions(partitions); err != nil {
+		logger.Fatal(err, "Invalid --partitions")
+	}
+
+	kc, err := broker.NewKafka(cfg.Kafka)
+	if err != nil {
+		logger.Fatal(err, "Invalid Kafka settings")
+	}
+
+	ctx := context.Background()
+	db := database.InitDB(ctx, cfg.Postgres.URL)
+	defer db.Close()
+
+	// running service instances pick new orders up from L2 or DB
+	var l2 *cache.RedisCache
+	if !req.DryRun {
+		l2 = initL2Cache(ctx, cfg)
+		defer l2.Close()
+	}
+
+	res, err := broker.Replay(ctx, cfg, kc, broker.ReplayTarget{DB: db, L2: l2}, req)
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if encErr := enc.Encode(res); encErr != nil {
+		logger.Error(encErr, "Failed to write replay result")
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// "0=120,1=80" into partition -> offset
+func parseOffsets(s string) (map[int]int64, error) {
+	if s == "" {
+		return nil, nil
+	}
+	out := make(map[int]int64)
+	for _, pair := range strings.Split(s, ",") {
+		p, off, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("%q: expected PARTITION=OFFSET", pair)
+		}
+		partition, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", pair, err)
+		}
+		if out[partition], err = strconv.ParseInt(off, 10, 64); err != nil {
+			return nil, fmt.Errorf("%q: %w", pair, err)
+		}
+	}
+	return out, nil
+}
+
+func parsePartitions(s string) ([]int, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var out []int
+	for _, p := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
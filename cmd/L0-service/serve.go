@@ -0,0 +1,439 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+
+	"github.com/beganov/L0/internal/api"
+	"github.com/beganov/L0/internal/auth"
+	"github.com/beganov/L0/internal/broker"
+	"github.com/beganov/L0/internal/cache"
+	"github.com/beganov/L0/internal/config"
+	"github.com/beganov/L0/internal/database"
+	"github.com/beganov/L0/internal/erasure"
+	"github.com/beganov/L0/internal/events"
+	"github.com/beganov/L0/internal/health"
+	"github.com/beganov/L0/internal/lifecycle"
+	"github.com/beganov/L0/internal/logger"
+	"github.com/beganov/L0/internal/metrics"
+	"github.com/beganov/L0/internal/pii"
+	"github.com/beganov/L0/internal/rpc"
+	"github.com/beganov/L0/internal/storage"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type serveOptions struct {
+	apiOnly      bool
+	consumerOnly bool
+	noMigrate    bool
+}
+
+// flag set of serve command, fresh one is needed for every config load
+func serveFlags() (*flag.FlagSet, *serveOptions) {
+	opts := &serveOptions{}
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.BoolVar(&opts.apiOnly, "api-only", false, "serve HTTP API without consuming Kafka")
+	fs.BoolVar(&opts.consumerOnly, "consumer-only", false, "consume Kafka, HTTP serves only health and metrics")
+	fs.BoolVar(&opts.noMigrate, "no-migrate", false, "do not apply migrations on start")
+	return fs, opts
+}
+
+// serve [--api-only|--consumer-only] [--no-migrate]
+func runServe(args []string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fs, opts := serveFlags()
+	cfg := loadConfigOrExit(fs, args) // optional .env + file + env + flags
+	if opts.apiOnly && opts.consumerOnly {
+		logger.Fatal(errors.New("--api-only and --consumer-only are exclusive"), "Invalid flags")
+	}
+	logger.Init(cfg.Log.Level)
+	metrics.Init() // Prometheus
+
+	handleSignals(cancel) // Ctrl+C/SIGTERM
+
+	// live config, timeouts and cache size follow reloads
+	holder := config.NewHolder(cfg)
+
+	version := migrateOnStart(ctx, cfg, opts.noMigrate)
+
+	// closed by shutdown steps in dependency order
+	db := database.InitDB(ctx, cfg.Postgres.URL)
+	// group reader source is only used when offsets are committed to the broker,
+	// postgres offset store runs its own partition readers
+	consume := !opts.apiOnly
+	var kc *broker.Kafka
+	var src broker.Source
+	if consume {
+		src, kc = initSource(ctx, cfg)
+	}
+	l2 := initL2Cache(ctx, cfg)
+
+	orderCache := cache.NewOrderCache(cfg.Cache.Capacity)
+	handleReload(ctx, holder, orderCache, func() (*config.Config, error) {
+		fs, _ := serveFlags()
+		return config.LoadFlags(fs, args)
+	})
+
+	// HTTP server and consumer are supervised and restarted on failure
+	group := lifecycle.NewGroup()
+	// pause state outlives consumer restarts
+	var control *broker.Control
+	var admin *api.AdminHandler
+	if consume {
+		control = broker.NewControl()
+		go control.Run(ctx, broker.StatsInterval)
+		admin = api.NewAdminHandler(holder, kc, control, broker.ReplayTarget{DB: db, Cache: orderCache, L2: l2})
+	}
+	// partners submit orders over HTTP, they reach the DB through the broker
+	var sink broker.Sink
+	var ingest *api.IngestHandler
+	if !opts.consumerOnly && cfg.Ingest.Enabled {
+		if sink = initSink(ctx, cfg); sink != nil {
+			ingest = api.NewIngestHandler(holder, sink)
+		}
+	}
+	checker := health.NewChecker(holder, db, control, orderCache, group)
+	checker.SetMigrationVersion(version)
+
+	// stored orders reach stream clients and gRPC watchers of this instance only
+	hub := events.NewHub(cfg.Stream.History)
+
+	// same key across restarts and replicas keeps hashed values comparable
+	pii.SetHashKey(cfg.PII.HashKey)
+
+	// key files are read once, changing them needs a restart
+	authn, err := auth.New(cfg.Auth)
+	if err != nil {
+		logger.Fatal(err, "Failed to load auth keys")
+	}
+
+	// erasure evicts cached copies here, other instances follow the audit in their watcher
+	target := erasure.Target{DB: db, Cache: orderCache, L2: l2, Hub: hub}
+	erase := api.NewErasureHandler(holder, target)
+	if authn == nil {
+		logger.Warn("Auth is disabled, POST /admin/erasure is not served")
+	}
+	snapshotPath := cfg.Cache.SnapshotPath
+	if opts.consumerOnly {
+		snapshotPath = ""
+	}
+	watcher := erasure.NewWatcher(holder, target, snapshotPath)
+
+	// HTTP goes first so probes answer during warm-up
+	var router http.Handler
+	var stream *api.StreamHandler
+	if opts.consumerOnly {
+		router = api.SetupServiceRouter(checker, admin, erase, authn)
+	} else {
+		stream = api.NewStreamHandler(holder, hub)
+		router = api.SetupRouter(holder, orderCache, l2, db, checker, admin, ingest, stream, erase, authn)
+	}
+	group.Add(api.NewServer(cfg.HTTP.Addr, router), supervisorPolicy(cfg, "http"))
+	serveGRPC := !opts.consumerOnly && cfg.GRPC.Addr != ""
+	if serveGRPC {
+		store := storage.NewStorage(holder, orderCache, l2, db)
+		group.Add(rpc.NewServer(cfg.GRPC.Addr, holder, store, hub, authn), supervisorPolicy(cfg, "grpc"))
+	}
+	group.Start(context.Background())
+
+	// consumer-only instance serves no reads, its cache needs no warm-up
+	if !opts.consumerOnly {
+		warmCache(ctx, cfg, db, l2, orderCache)
+		// snapshot may predate erasures, they are evicted before the cache is served
+		if _, err := watcher.Sync(ctx); err != nil {
+			metrics.DBErrorsTotal.Inc()
+			logger.Error(err, "Failed to check erasure audit")
+		}
+		if cfg.Cache.SnapshotPath != "" && cfg.Cache.SnapshotInterval > 0 {
+			go orderCache.RunSnapshots(ctx, cfg.Cache.SnapshotPath, cfg.Cache.SnapshotInterval)
+		}
+	}
+
+	// own context, shutdown decides when fetching stops; added before the cache is marked warm,
+	// so /readyz never reports ready without it
+	if consume {
+		var consumer lifecycle.Component = broker.NewTxConsumer(holder, kc, db, orderCache, l2, control, hub)
+		if src != nil {
+			consumer = broker.NewConsumer(holder, src, db, orderCache, l2, control, hub)
+		}
+		group.Add(consumer, supervisorPolicy(cfg, "consumer"))
+		group.Start(context.Background())
+	}
+	checker.SetCacheWarm()
+	if cfg.PII.ErasurePoll > 0 {
+		go watcher.Run(ctx, cfg.PII.ErasurePoll)
+	}
+
+	var fatalErr error
+	select {
+	case <-ctx.Done():
+	case fatalErr = <-group.Fatal():
+		logger.Error(fatalErr, "Component failure is fatal")
+	}
+	logger.Info("Shutting down services")
+
+	shutdown := lifecycle.NewShutdown()
+	if consume {
+		shutdown.Add("consumer", cfg.Shutdown.ConsumerTimeout, group.Stopper("consumer"))
+		// replay handlers hold their requests open, they end before HTTP waits for them
+		shutdown.Add("replay", cfg.Shutdown.ConsumerTimeout, admin.StopReplays)
+	}
+	stopHTTP := group.Stopper("http")
+	shutdown.Add("http", cfg.Shutdown.HTTPTimeout, func(ctx context.Context) error {
+		// open streams never finish on their own
+		if stream != nil {
+			stream.Close()
+		}
+		return stopHTTP(ctx)
+	})
+	if serveGRPC {
+		shutdown.Add("grpc", cfg.Shutdown.HTTPTimeout, group.Stopper("grpc"))
+	}
+	shutdown.Add("cache", cfg.Shutdown.CacheTimeout, lifecycle.Blocking(func() error {
+		if cfg.Cache.SnapshotPath != "" && !opts.consumerOnly {
+			if err := orderCache.SaveSnapshot(cfg.Cache.SnapshotPath); err != nil {
+				l2.Close()
+				return err
+			}
+		}
+		return l2.Close()
+	}))
+	if src != nil || sink != nil {
+		shutdown.Add("broker", cfg.Shutdown.KafkaTimeout, lifecycle.Blocking(func() error {
+			var errs []error
+			if src != nil {
+				errs = append(errs, src.Close())
+			}
+			if sink != nil {
+				errs = append(errs, sink.Close())
+			}
+			return errors.Join(errs...)
+		}))
+	}
+	shutdown.Add("postgres", cfg.Shutdown.PostgresTimeout, lifecycle.Blocking(func() error {
+		db.Close()
+		return nil
+	}))
+
+	if err := shutdown.Run(); err != nil {
+		logger.Error(err, "App stopped with errors")
+	}
+	if fatalErr != nil {
+		os.Exit(1)
+	}
+	logger.Info("App stopped")
+}
+
+// Apply migrations unless they run separately, returns schema version
+func migrateOnStart(ctx context.Context, cfg *config.Config, skip bool) int64 {
+	if !skip {
+		return database.RunMigrations(ctx, cfg.Postgres.URL, cfg.Postgres.MigrationPath)
+	}
+	version, err := database.SchemaVersion(ctx, cfg.Postgres.URL, cfg.Postgres.MigrationPath)
+	if errors.Is(err, database.ErrSchemaTooNew) {
+		logger.Fatal(err, "Refusing to run against database schema")
+	}
+	if err != nil {
+		metrics.DBErrorsTotal.Inc()
+		logger.Error(err, "Failed to read migration version")
+		return -1
+	}
+	return version
+}
+
+// Restart policy for component from supervisor config
+func supervisorPolicy(cfg *config.Config, name string) lifecycle.Policy {
+	return lifecycle.Policy{
+		MaxRestarts: cfg.Supervisor.MaxRestarts,
+		BackoffMin:  cfg.Supervisor.BackoffMin,
+		BackoffMax:  cfg.Supervisor.BackoffMax,
+		Fatal:       slices.Contains(cfg.Supervisor.Fatal, name),
+	}
+}
+
+// Handle OS signals
+func handleSignals(cancel context.CancelFunc) {
+	go func() {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+		sig := <-c
+		logger.Info("Caught signal", sig)
+		cancel()
+	}()
+}
+
+// Reload config on SIGHUP and, if enabled, on config file change
+func handleReload(ctx context.Context, holder *config.Holder, orderCache *cache.OrderCache, load func() (*config.Config, error)) {
+	reload := make(chan struct{}, 1)
+	trigger := func() {
+		select {
+		case reload <- struct{}{}:
+		default: // reload already pending
+		}
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				signal.Stop(hup)
+				return
+			case <-hup:
+				trigger()
+			}
+		}
+	}()
+
+	if cfg := holder.Get(); cfg.File != "" && cfg.Reload.WatchInterval > 0 {
+		go config.Watch(ctx, cfg.File, cfg.Reload.WatchInterval, trigger)
+	}
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-reload:
+				reloadConfig(holder, orderCache, load)
+			}
+		}
+	}()
+}
+
+// Load config again and apply what can change without restart
+func reloadConfig(holder *config.Holder, orderCache *cache.OrderCache, load func() (*config.Config, error)) {
+	next, err := load()
+	if err != nil {
+		metrics.ConfigReloadsTotal.WithLabelValues("error").Inc()
+		logger.Error(err, "Config reload rejected, keeping current config")
+		return
+	}
+
+	cur := holder.Get()
+	res := config.ApplyLive(cur, next)
+
+	if res.Config.Cache.Capacity != cur.Cache.Capacity {
+		evicted := orderCache.Resize(res.Config.Cache.Capacity)
+		logger.Info("Cache resized", "capacity", res.Config.Cache.Capacity, "evicted", evicted)
+	}
+	if res.Config.Log.Level != cur.Log.Level {
+		if err := logger.SetLevel(res.Config.Log.Level); err != nil {
+			logger.Error(err, "Log level change failed")
+		}
+	}
+	holder.Set(res.Config)
+
+	metrics.ConfigRestartPending.Set(float64(len(res.Restart)))
+	if len(res.Restart) > 0 {
+		metrics.ConfigReloadsTotal.WithLabelValues("partial").Inc()
+		logger.Warn("Config reloaded, some changes need a restart", "applied", res.Applied, "restart_required", res.Restart)
+		return
+	}
+	metrics.ConfigReloadsTotal.WithLabelValues("ok").Inc()
+	logger.Info("Config reloaded", "applied", res.Applied)
+}
+
+// Order source of the configured broker, kc is nil unless it is Kafka
+func initSource(ctx context.Context, cfg *config.Config) (broker.Source, *broker.Kafka) {
+	if cfg.Broker.Type == config.BrokerNATS {
+		src, err := broker.NewNATSSource(ctx, cfg.NATS)
+		if err != nil {
+			logger.Fatal(err, "Unable to connect to NATS JetStream")
+		}
+		logger.Info("NATS consumer initialized", "stream", cfg.NATS.Stream, "subject", cfg.NATS.Subject)
+		return src, nil
+	}
+
+	kc := initKafka(cfg)
+	if cfg.Kafka.OffsetStore != config.OffsetStoreKafka {
+		return nil, kc
+	}
+	logger.Info("Kafka reader initialized for topic", "topic", cfg.Kafka.Topic)
+	return broker.NewKafkaSource(kc), kc
+}
+
+// Publisher for submitted orders, nil disables POST /orders
+func initSink(ctx context.Context, cfg *config.Config) broker.Sink {
+	sink, err := broker.NewSink(ctx, cfg)
+	if err != nil {
+		logger.Error(err, "Order submission unavailable, running without it")
+		return nil
+	}
+	return sink
+}
+
+// Kafka connection settings, TLS and SASL problems stop the start
+func initKafka(cfg *config.Config) *broker.Kafka {
+	kc, err := broker.NewKafka(cfg.Kafka)
+	if err != nil {
+		logger.Fatal(err, "Invalid Kafka settings")
+	}
+	return kc
+}
+
+// Init optional Redis L2 cache, nil when disabled or unreachable
+func initL2Cache(ctx context.Context, cfg *config.Config) *cache.RedisCache {
+	if cfg.Redis.URL == "" {
+		return nil
+	}
+	l2, err := cache.NewRedisCache(ctx, cfg.Redis.URL, cfg.Redis.Prefix, cfg.Redis.TTL)
+	if err != nil {
+		logger.Error(err, "L2 cache unavailable, running without it")
+		return nil
+	}
+	logger.Info("L2 cache connected")
+	return l2
+}
+
+// Warm cache from snapshot, L2, then from DB
+func warmCache(ctx context.Context, cfg *config.Config, db *pgxpool.Pool, l2 *cache.RedisCache, c *cache.OrderCache) {
+	// snapshot + reconcile of newer orders is the fastest path
+	if cfg.Cache.SnapshotPath != "" {
+		n, newest, err := c.LoadSnapshot(cfg.Cache.SnapshotPath)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			logger.Info("No cache snapshot found", "path", cfg.Cache.SnapshotPath)
+		case err != nil:
+			logger.Error(err, "Failed to load cache snapshot")
+		default:
+			logger.Info("Cache restored from snapshot", "orders", n)
+			if err := database.LoadCacheSince(ctx, db, c, newest, cfg.Postgres.SelectTimeout); err != nil {
+				metrics.DBErrorsTotal.Inc()
+				logger.Error(err, "Failed to reconcile cache snapshot with DB")
+			}
+			return
+		}
+	}
+
+	// warm L2 spares the DB from a full reload on every restart,
+	// but only when it fills L1: expired or evicted keys may hide orders the DB still has
+	n, err := l2.Warm(ctx, c)
+	if err != nil {
+		logger.Error(err, "Failed to restore cache from L2")
+	}
+	if err == nil && n >= c.Cap() {
+		logger.Info("Cache restored from L2", "orders", n)
+		return
+	}
+	if n > 0 {
+		logger.Info("Cache partly restored from L2, loading the rest from DB", "orders", n, "capacity", c.Cap())
+	}
+
+	if err := database.LoadCacheFromDB(ctx, db, c, cfg.Postgres.SelectTimeout); err != nil {
+		metrics.DBErrorsTotal.Inc()
+		logger.Error(err, "Failed to fully restore cache")
+	} else {
+		logger.Info("Cache restored from DB")
+	}
+}
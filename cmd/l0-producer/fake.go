@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/beganov/L0/internal/models"
+)
+
+var (
+	firstNames = []string{"Ivan", "Anna", "Pavel", "Olga", "Sergey", "Maria", "Dmitry", "Elena", "Alexey", "Natalia", "Test"}
+	lastNames  = []string{"Ivanov", "Petrova", "Smirnov", "Kuznetsova", "Popov", "Vasilieva", "Sokolov", "Mikhailova", "Testov"}
+	cities     = []struct{ city, region string }{
+		{"Moscow", "Moscow"}, {"Saint Petersburg", "Leningrad Oblast"}, {"Kazan", "Tatarstan"},
+		{"Novosibirsk", "Novosibirsk Oblast"}, {"Yekaterinburg", "Sverdlovsk Oblast"}, {"Kiryat Mozkin", "Kraiot"},
+	}
+	streets  = []string{"Lenina", "Tverskaya", "Sadovaya", "Mira", "Gagarina", "Ploshad Mira"}
+	products = []struct{ name, brand string }{
+		{"Mascaras", "Vivienne Sabo"}, {"T-shirt", "Gloria Jeans"}, {"Sneakers", "Demix"}, {"Backpack", "Xiaomi"},
+		{"Headphones", "JBL"}, {"Mug", "Luminarc"}, {"Notebook", "Erich Krause"}, {"Umbrella", "Zest"},
+	}
+	sizes            = []string{"0", "S", "M", "L", "XL", "42"}
+	banks            = []string{"alpha", "sber", "tinkoff", "vtb"}
+	currencies       = []string{"RUB", "USD", "EUR"}
+	deliveryServices = []string{"meest", "cdek", "dhl", "boxberry"}
+	locales          = []string{"en", "ru"}
+)
+
+// what a generated message is meant to test
+type kind int
+
+const (
+	kindValid kind = iota
+	kindInvalidJSON
+	kindInvalidOrder
+	kindDuplicate
+)
+
+func (k kind) String() string {
+	return [...]string{"valid", "invalid_json", "invalid_order", "duplicate"}[k]
+}
+
+// share of each broken kind in percent, the rest is valid
+type mix struct {
+	InvalidJSON  float64
+	InvalidOrder float64
+	Duplicates   float64
+}
+
+// duplicates are drawn from this many most recent valid orders
+const recentOrders = 1000
+
+// deterministic order generator, same seed gives the same sequence
+type faker struct {
+	r    *rand.Rand
+	mix  mix
+	sent []models.Order // ring of recent valid orders, source of duplicates
+	pos  int            // next slot to overwrite once the ring is full
+}
+
+func newFaker(seed int64, m mix) *faker {
+	return &faker{r: rand.New(rand.NewSource(seed)), mix: m}
+}
+
+// next message value, order is set for everything that carries an order_uid
+func (f *faker) next(now time.Time) (kind, []byte, models.Order) {
+	p := f.r.Float64() * 100
+	switch {
+	case p < f.mix.InvalidJSON:
+		// valid order cut in the middle
+		o := f.order(now)
+		b, _ := json.Marshal(o)
+		return kindInvalidJSON, b[:len(b)/2], models.Order{}
+	case p < f.mix.InvalidJSON+f.mix.InvalidOrder:
+		o := f.breakOrder(f.order(now))
+		b, _ := json.Marshal(o)
+		return kindInvalidOrder, b, o
+	case p < f.mix.InvalidJSON+f.mix.InvalidOrder+f.mix.Duplicates && len(f.sent) > 0:
+		o := f.sent[f.r.Intn(len(f.sent))]
+		b, _ := json.Marshal(o)
+		return kindDuplicate, b, o
+	}
+	o := f.order(now)
+	f.remember(o)
+	b, _ := json.Marshal(o)
+	return kindValid, b, o
+}
+
+// a long run keeps only the last recentOrders, memory stays flat
+func (f *faker) remember(o models.Order) {
+	if len(f.sent) < recentOrders {
+		f.sent = append(f.sent, o)
+		return
+	}
+	f.sent[f.pos] = o
+	f.pos = (f.pos + 1) % recentOrders
+}
+
+// one of the fields Validate requires is missing
+func (f *faker) breakOrder(o models.Order) models.Order {
+	switch f.r.Intn(4) {
+	case 0:
+		o.Payment.Transaction = ""
+	case 1:
+		o.Delivery.Name = ""
+	case 2:
+		o.Items = nil
+	default:
+		o.Items[0].ChrtID = 0
+	}
+	return o
+}
+
+func (f *faker) order(now time.Time) models.Order {
+	uid := f.hex(16) + "test"
+	track := "WBIL" + f.upper(10)
+
+	first, last := pick(f.r, firstNames), pick(f.r, lastNames)
+	place := cities[f.r.Intn(len(cities))]
+
+	items := make([]models.Items, 1+f.r.Intn(5))
+	goods := 0
+	for i := range items {
+		p := products[f.r.Intn(len(products))]
+		price := 100 + f.r.Intn(5000)
+		sale := f.r.Intn(6) * 10
+		total := price * (100 - sale) / 100
+		goods += total
+		items[i] = models.Items{
+			ChrtID:      1000000 + f.r.Intn(9000000),
+			TrackNumber: track,
+			Price:       price,
+			Rid:         f.hex(16) + "test",
+			Name:        p.name,
+			Sale:        sale,
+			Size:        pick(f.r, sizes),
+			TotalPrice:  total,
+			NmID:        1000000 + f.r.Intn(9000000),
+			Brand:       p.brand,
+			Status:      202,
+		}
+	}
+	deliveryCost := 100 * f.r.Intn(20)
+
+	return models.Order{
+		OrderUID:    uid,
+		TrackNumber: track,
+		Entry:       "WBIL",
+		Delivery: models.Delivery{
+			Name:    first + " " + last,
+			Phone:   "+7" + f.digits(10),
+			Zip:     f.digits(6),
+			City:    place.city,
+			Address: fmt.Sprintf("%s %d", pick(f.r, streets), 1+f.r.Intn(150)),
+			Region:  place.region,
+			Email:   strings.ToLower(fmt.Sprintf("%s.%s%d@example.com", first, last, f.r.Intn(100))),
+		},
+		Payment: models.Payment{
+			Transaction:  uid,
+			Currency:     pick(f.r, currencies),
+			Provider:     "wbpay",
+			Amount:       goods + deliveryCost,
+			PaymentDT:    now.Unix(),
+			Bank:         pick(f.r, banks),
+			DeliveryCost: deliveryCost,
+			GoodsTotal:   goods,
+		},
+		Items:           items,
+		Locale:          pick(f.r, locales),
+		CustomerID:      fmt.Sprintf("customer-%d", f.r.Intn(1000)),
+		DeliveryService: pick(f.r, deliveryServices),
+		Shardkey:        fmt.Sprint(f.r.Intn(10)),
+		SmID:            f.r.Intn(100),
+		DateCreated:     now.UTC().Truncate(time.Second),
+		OofShard:        fmt.Sprint(1 + f.r.Intn(2)),
+	}
+}
+
+func (f *faker) hex(n int) string {
+	return f.chars(n, "0123456789abcdef")
+}
+
+func (f *faker) upper(n int) string {
+	return f.chars(n, "ABCDEFGHIJKLMNOPQRSTUVWXYZ")
+}
+
+func (f *faker) digits(n int) string {
+	return f.chars(n, "0123456789")
+}
+
+func (f *faker) chars(n int, set string) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = set[f.r.Intn(len(set))]
+	}
+	return string(b)
+}
+
+func pick(r *rand.Rand, s []string) string {
+	return s[r.Intn(len(s))]
+}
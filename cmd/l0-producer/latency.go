@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/beganov/L0/internal/logger"
+)
+
+// end-to-end latency: time from publish until GET /order/{id} returns 200
+type tracker struct {
+	baseURL  string
+	header   http.Header // credentials of the API, when auth is enabled
+	client   *http.Client
+	timeout  time.Duration // order not seen by then is counted as lost
+	interval time.Duration
+	workers  int
+
+	mu      sync.Mutex
+	pending map[string]time.Time // order_uid -> publish time
+	seen    []time.Duration
+	lost    int
+
+	denied sync.Once
+}
+
+func newTracker(baseURL string, header http.Header, timeout, interval time.Duration, workers int) *tracker {
+	return &tracker{
+		baseURL:  baseURL,
+		header:   header,
+		client:   &http.Client{Timeout: interval + time.Second},
+		timeout:  timeout,
+		interval: interval,
+		workers:  workers,
+		pending:  make(map[string]time.Time),
+	}
+}
+
+// start waiting for order, repeated ids keep the first publish time
+func (t *tracker) add(id string, sent time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.pending[id]; !ok {
+		t.pending[id] = sent
+	}
+}
+
+// poll pending orders every interval until ctx is done
+func (t *tracker) run(ctx context.Context) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.poll(ctx)
+		}
+	}
+}
+
+// after publishing stopped, poll until nothing is pending or everything timed out
+func (t *tracker) drain(ctx context.Context) {
+	for t.pendingCount() > 0 && ctx.Err() == nil {
+		t.poll(ctx)
+		time.Sleep(t.interval)
+	}
+}
+
+func (t *tracker) pendingCount() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.pending)
+}
+
+func (t *tracker) poll(ctx context.Context) {
+	t.mu.Lock()
+	ids := make([]string, 0, len(t.pending))
+	for id := range t.pending {
+		ids = append(ids, id)
+	}
+	t.mu.Unlock()
+
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for range min(t.workers, len(ids)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range jobs {
+				t.check(ctx, id)
+			}
+		}()
+	}
+	for _, id := range ids {
+		jobs <- id
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+func (t *tracker) check(ctx context.Context, id string) {
+	found := t.exists(ctx, id)
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	sent, ok := t.pending[id]
+	if !ok {
+		return
+	}
+	switch {
+	case found:
+		t.seen = append(t.seen, now.Sub(sent))
+		delete(t.pending, id)
+	case now.Sub(sent) > t.timeout:
+		t.lost++
+		delete(t.pending, id)
+	}
+}
+
+func (t *tracker) exists(ctx context.Context, id string) bool {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.baseURL+"/order/"+id, nil)
+	if err != nil {
+		return false
+	}
+	for k, vs := range t.header {
+		req.Header[k] = vs
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	// otherwise every order ends up lost without a hint why
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		t.denied.Do(func() {
+			logger.Warn("API rejected latency checks, set -check-api-key or -check-token", "status", resp.StatusCode)
+		})
+	}
+	return resp.StatusCode == http.StatusOK
+}
+
+// X-API-Key or bearer token for GET /order/{id}, empty when none is given
+func checkHeader(apiKey, token string) http.Header {
+	h := http.Header{}
+	if apiKey != "" {
+		h.Set("X-API-Key", apiKey)
+	}
+	if token != "" {
+		h.Set("Authorization", "Bearer "+token)
+	}
+	return h
+}
+
+type latencyReport struct {
+	Seen    int    `json:"seen"`
+	Lost    int    `json:"lost"`
+	Pending int    `json:"pending"` // still waiting when the producer was stopped
+	P50     string `json:"p50,omitempty"`
+	P90     string `json:"p90,omitempty"`
+	P99     string `json:"p99,omitempty"`
+	Max     string `json:"max,omitempty"`
+}
+
+func (t *tracker) report() latencyReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	r := latencyReport{Seen: len(t.seen), Lost: t.lost, Pending: len(t.pending)}
+	if len(t.seen) == 0 {
+		return r
+	}
+	d := slices.Clone(t.seen)
+	slices.Sort(d)
+	r.P50, r.P90, r.P99 = percentile(d, 50), percentile(d, 90), percentile(d, 99)
+	r.Max = d[len(d)-1].Round(time.Millisecond).String()
+	return r
+}
+
+// nearest-rank percentile of sorted durations
+func percentile(sorted []time.Duration, p int) string {
+	i := (len(sorted)*p + 99) / 100
+	return sorted[max(i-1, 0)].Round(time.Millisecond).String()
+}
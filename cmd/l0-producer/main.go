@@ -0,0 +1,231 @@
+// l0-producer publishes generated or recorded orders to the service topic at a
+// target rate and measures how long they take to show up in the HTTP API.
+//
+//	l0-producer [-rate 50] [-count 1000] [-seed 1] [-invalid-json 2] [-invalid-order 3] [-duplicates 5]
+//	            [-replay orders.ndjson] [-check-url http://localhost:8081 [-check-api-key k | -check-token t]]
+//	            [config flags]
+//
+// broker settings are the ones of L0-service: .env, -config file, env and flags
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/beganov/L0/internal/broker"
+	"github.com/beganov/L0/internal/config"
+	"github.com/beganov/L0/internal/logger"
+	"github.com/beganov/L0/internal/models"
+)
+
+type options struct {
+	rate   float64
+	count  int
+	seed   int64
+	mix    mix
+	replay string
+
+	checkURL      string
+	checkAPIKey   string
+	checkToken    string
+	checkTimeout  time.Duration
+	checkInterval time.Duration
+	checkWorkers  int
+}
+
+// one message to publish
+type payload struct {
+	kind  string
+	value []byte
+	id    string // order_uid, empty for unparsable messages
+	track bool   // a new valid order, expected to appear in the API
+}
+
+// summary printed on exit
+type report struct {
+	Sent    map[string]int `json:"sent"`
+	Errors  int            `json:"publish_errors"`
+	Elapsed string         `json:"elapsed"`
+	Rate    float64        `json:"messages_per_sec"`
+	Latency *latencyReport `json:"latency,omitempty"`
+}
+
+func main() {
+	opts := &options{}
+	fs := flag.NewFlagSet("l0-producer", flag.ContinueOnError)
+	fs.Float64Var(&opts.rate, "rate", 10, "messages per second")
+	fs.IntVar(&opts.count, "count", 100, "messages to send, 0 sends until interrupted (replay sends the whole file by default)")
+	fs.Int64Var(&opts.seed, "seed", 1, "generator seed, same seed gives the same orders")
+	fs.Float64Var(&opts.mix.InvalidJSON, "invalid-json", 0, "percent of truncated JSON messages")
+	fs.Float64Var(&opts.mix.InvalidOrder, "invalid-order", 0, "percent of orders failing validation")
+	fs.Float64Var(&opts.mix.Duplicates, "duplicates", 0, "percent of already sent orders sent again")
+	fs.StringVar(&opts.replay, "replay", "", "NDJSON file to send line by line instead of generated orders, - for stdin")
+	fs.StringVar(&opts.checkURL, "check-url", "", "service base URL, polls GET /order/{id} to measure end-to-end latency")
+	fs.StringVar(&opts.checkAPIKey, "check-api-key", os.Getenv("CHECK_API_KEY"), "X-API-Key for the API polls (env CHECK_API_KEY)")
+	fs.StringVar(&opts.checkToken, "check-token", os.Getenv("CHECK_TOKEN"), "bearer token for the API polls (env CHECK_TOKEN)")
+	fs.DurationVar(&opts.checkTimeout, "check-timeout", 30*time.Second, "order not visible in the API by then is lost")
+	fs.DurationVar(&opts.checkInterval, "check-interval", 100*time.Millisecond, "API poll interval")
+	fs.IntVar(&opts.checkWorkers, "check-workers", 16, "concurrent API polls")
+
+	cfg, err := config.LoadFlags(fs, os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		logger.Fatal(err, "Invalid configuration")
+	}
+	logger.Init(cfg.Log.Level)
+	if opts.replay != "" && !flagSet(fs, "count") {
+		opts.count = 0
+	}
+	if opts.rate <= 0 {
+		logger.Fatal(errors.New("-rate must be positive"), "Invalid flags")
+	}
+	if opts.mix.InvalidJSON+opts.mix.InvalidOrder+opts.mix.Duplicates > 100 {
+		logger.Fatal(errors.New("percentages add up to more than 100"), "Invalid flags")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	next, closeSource := generated(opts)
+	if opts.replay != "" {
+		next, closeSource = replayed(opts.replay)
+	}
+	defer closeSource()
+
+	sink, err := broker.NewSink(ctx, cfg)
+	if err != nil {
+		logger.Fatal(err, "Unable to connect to broker")
+	}
+	defer sink.Close()
+
+	var t *tracker
+	if opts.checkURL != "" {
+		t = newTracker(opts.checkURL, checkHeader(opts.checkAPIKey, opts.checkToken), opts.checkTimeout, opts.checkInterval, opts.checkWorkers)
+		pollCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go t.run(pollCtx)
+	}
+
+	r := produce(ctx, sink, opts, next, t)
+	if t != nil {
+		t.drain(ctx)
+		lr := t.report()
+		r.Latency = &lr
+	}
+
+	out, _ := json.MarshalIndent(r, "", "  ")
+	fmt.Println(string(out))
+	if r.Errors > 0 {
+		os.Exit(1)
+	}
+}
+
+func flagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) { set = set || f.Name == name })
+	return set
+}
+
+// publish at the target rate until count is reached, source ends or ctx is done
+func produce(ctx context.Context, sink broker.Sink, opts *options, next func() (payload, bool), t *tracker) report {
+	r := report{Sent: make(map[string]int)}
+	interval := time.Duration(float64(time.Second) / opts.rate)
+	start := time.Now()
+
+	for seq := 0; opts.count == 0 || seq < opts.count; seq++ {
+		// fixed schedule, a slow publish is caught up by the next ones
+		if wait := time.Until(start.Add(time.Duration(seq) * interval)); wait > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(wait):
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		p, ok := next()
+		if !ok {
+			break
+		}
+		// unique key per publish, NATS would otherwise drop duplicates by message id
+		key := strconv.Itoa(seq)
+		if p.id != "" {
+			key = p.id + "-" + key
+		}
+		sent := time.Now()
+		if err := sink.Publish(ctx, broker.Message{Key: []byte(key), Value: p.value}); err != nil {
+			r.Errors++
+			logger.Error(err, "publish failed")
+			continue
+		}
+		r.Sent[p.kind]++
+		if t != nil && p.track {
+			t.add(p.id, sent)
+		}
+	}
+
+	elapsed := time.Since(start)
+	total := 0
+	for _, n := range r.Sent {
+		total += n
+	}
+	r.Elapsed = elapsed.Round(time.Millisecond).String()
+	r.Rate = float64(total) / elapsed.Seconds()
+	return r
+}
+
+// orders from the seeded faker
+func generated(opts *options) (func() (payload, bool), func()) {
+	f := newFaker(opts.seed, opts.mix)
+	return func() (payload, bool) {
+		k, value, o := f.next(time.Now())
+		return payload{kind: k.String(), value: value, id: o.OrderUID, track: k == kindValid}, true
+	}, func() {}
+}
+
+// lines of an NDJSON file as they are, valid orders are tracked
+func replayed(path string) (func() (payload, bool), func()) {
+	var in io.ReadCloser = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			logger.Fatal(err, "Unable to open replay file")
+		}
+		in = f
+	}
+
+	sc := bufio.NewScanner(in)
+	sc.Buffer(make([]byte, 1<<20), 16<<20)
+	return func() (payload, bool) {
+		for sc.Scan() {
+			line := sc.Bytes()
+			if len(line) == 0 {
+				continue
+			}
+			p := payload{kind: "replayed", value: append([]byte(nil), line...)}
+			var o models.Order
+			if json.Unmarshal(line, &o) == nil {
+				p.id = o.OrderUID
+				p.track = o.Validate() == nil
+			}
+			return p, true
+		}
+		if err := sc.Err(); err != nil {
+			logger.Error(err, "replay file read failed")
+		}
+		return payload{}, false
+	}, func() { in.Close() }
+}
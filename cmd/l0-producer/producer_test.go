@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beganov/L0/internal/broker"
+	"github.com/beganov/L0/internal/models"
+)
+
+// --- Тест генератора: один seed — одни и те же заказы, доли битых сообщений соблюдаются ---
+func TestFaker_SeedAndMix(t *testing.T) {
+	now := time.Date(2025, 8, 20, 12, 0, 0, 0, time.UTC)
+	m := mix{InvalidJSON: 10, InvalidOrder: 10, Duplicates: 10}
+	a, b := newFaker(7, m), newFaker(7, m)
+
+	counts := map[kind]int{}
+	for range 1000 {
+		ka, va, _ := a.next(now)
+		kb, vb, _ := b.next(now)
+		if ka != kb || string(va) != string(vb) {
+			t.Fatal("same seed must give the same messages")
+		}
+		counts[ka]++
+
+		var o models.Order
+		err := json.Unmarshal(va, &o)
+		switch ka {
+		case kindInvalidJSON:
+			if err == nil {
+				t.Fatal("invalid_json message must not parse")
+			}
+		case kindInvalidOrder:
+			if err != nil || o.Validate() == nil {
+				t.Fatalf("invalid_order message must parse and fail validation: %s", va)
+			}
+		default:
+			if err != nil || o.Validate() != nil {
+				t.Fatalf("%s message must be a valid order: %s", ka, va)
+			}
+		}
+	}
+	for _, k := range []kind{kindInvalidJSON, kindInvalidOrder, kindDuplicate} {
+		if counts[k] < 60 || counts[k] > 140 {
+			t.Errorf("expected about 100 %s messages, got %d", k, counts[k])
+		}
+	}
+}
+
+// --- Тест генератора: дубликаты берутся из ограниченного окна последних заказов ---
+func TestFaker_RecentOrdersBounded(t *testing.T) {
+	now := time.Date(2025, 8, 20, 12, 0, 0, 0, time.UTC)
+	f := newFaker(7, mix{})
+	var last models.Order
+	for range 3*recentOrders + 10 {
+		_, _, last = f.next(now)
+	}
+	if len(f.sent) != recentOrders {
+		t.Fatalf("expected %d remembered orders, got %d", recentOrders, len(f.sent))
+	}
+	found := false
+	for _, o := range f.sent {
+		found = found || o.OrderUID == last.OrderUID
+	}
+	if !found {
+		t.Error("latest order must be remembered")
+	}
+}
+
+// --- Тест отправки с измерением задержки через HTTP API ---
+func TestProduce_TracksLatency(t *testing.T) {
+	mb := broker.NewMemoryBroker("orders")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// API с включённой аутентификацией
+		if r.Header.Get("X-API-Key") != "k-view" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		// заказ «появляется» в API, как только сообщение лежит в брокере
+		if !strings.HasSuffix(r.URL.Path, "test") {
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	opts := &options{rate: 1000, count: 20, seed: 1, mix: mix{InvalidJSON: 50}}
+	tr := newTracker(srv.URL, checkHeader("k-view", ""), time.Second, 5*time.Millisecond, 4)
+	next, _ := generated(opts)
+	r := produce(context.Background(), mb, opts, next, tr)
+	tr.drain(context.Background())
+
+	if r.Errors != 0 || r.Sent["valid"]+r.Sent["invalid_json"] != 20 {
+		t.Fatalf("unexpected report: %+v", r)
+	}
+	lr := tr.report()
+	if lr.Seen != r.Sent["valid"] || lr.Lost != 0 || lr.P99 == "" {
+		t.Errorf("every valid order must be seen: %+v", lr)
+	}
+}
@@ -17,6 +17,14 @@ const docTemplate = `{
     "paths": {
         "/order/{id}": {
             "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
                 "description": "Возвращает заказ по его уникальному идентификатору",
                 "consumes": [
                     "application/json"
@@ -35,6 +43,18 @@ const docTemplate = `{
                         "name": "id",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Оставить только эти поля через запятую, например order_uid,payment.amount,items.name",
+                        "name": "fields",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Убрать эти поля через запятую",
+                        "name": "exclude",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -44,6 +64,24 @@ const docTemplate = `{
                             "$ref": "#/definitions/models.Order"
                         }
                     },
+                    "400": {
+                        "description": "Field may not be projected",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Credentials required",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Role too low",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
                     "404": {
                         "description": "Order not found",
                         "schema": {
@@ -204,6 +242,20 @@ const docTemplate = `{
                 }
             }
         }
+    },
+    "securityDefinitions": {
+        "ApiKeyAuth": {
+            "description": "Ключ из auth.api_keys_file, роль viewer и выше",
+            "type": "apiKey",
+            "name": "X-API-Key",
+            "in": "header"
+        },
+        "BearerAuth": {
+            "description": "JWT, проверяемый по auth.jwks_file: Bearer \u003ctoken\u003e",
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
+        }
     }
 }`
 
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/beganov/L0/internal/broker"
+	"github.com/beganov/L0/internal/config"
+	"github.com/beganov/L0/internal/lifecycle"
+	"github.com/beganov/L0/internal/logger"
+)
+
+// consumer controls for operators
+type AdminHandler struct {
+	cfg     *config.Holder
+	kafka   *broker.Kafka
+	control *broker.Control
+	target  broker.ReplayTarget
+
+	// replays outlive their request but not the service
+	replayCtx   context.Context
+	stopReplays context.CancelFunc
+	mu          sync.Mutex
+	stopped     bool
+	replays     sync.WaitGroup
+}
+
+// kc is nil when orders do not come from Kafka, replay is unavailable then
+func NewAdminHandler(cfg *config.Holder, kc *broker.Kafka, control *broker.Control, target broker.ReplayTarget) *AdminHandler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &AdminHandler{cfg: cfg, kafka: kc, control: control, target: target, replayCtx: ctx, stopReplays: cancel}
+}
+
+// StopReplays cancels running replays and waits for them, shutdown runs it
+// before the stores they write to are closed. later replay requests get 503
+func (h *AdminHandler) StopReplays(ctx context.Context) error {
+	h.mu.Lock()
+	h.stopped = true
+	h.mu.Unlock()
+	h.stopReplays()
+
+	done := make(chan struct{})
+	go func() {
+		h.replays.Wait()
+		close(done)
+	}()
+	return lifecycle.Wait(done)(ctx)
+}
+
+// false once shutdown stopped replays
+func (h *AdminHandler) startReplay() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.stopped {
+		return false
+	}
+	h.replays.Add(1)
+	return true
+}
+
+// PauseConsumer stops ingestion after the in-flight message, e.g. for DB maintenance
+func (h *AdminHandler) PauseConsumer(w http.ResponseWriter, r *http.Request) {
+	if h.control.Pause() {
+		logger.Info("Kafka consumer paused via admin API", "remote", r.RemoteAddr)
+	}
+	writeJSON(w, h.control.Report())
+}
+
+// ResumeConsumer continues ingestion from where it was paused
+func (h *AdminHandler) ResumeConsumer(w http.ResponseWriter, r *http.Request) {
+	if h.control.Resume() {
+		logger.Info("Kafka consumer resumed via admin API", "remote", r.RemoteAddr)
+	}
+	writeJSON(w, h.control.Report())
+}
+
+// Assignment returns pause state and assigned partitions with offset, lag and rate
+func (h *AdminHandler) Assignment(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, h.control.Report())
+}
+
+type replayResponse struct {
+	broker.ReplayResult
+	Error string `json:"error,omitempty"`
+}
+
+// Replay re-reads the topic with a temporary group and reports accepted, rejected and present orders.
+// runs synchronously, partial counts are returned along with the error
+func (h *AdminHandler) Replay(w http.ResponseWriter, r *http.Request) {
+	if h.kafka == nil {
+		http.Error(w, "replay needs broker.type kafka", http.StatusNotImplemented)
+		return
+	}
+
+	var req broker.ReplayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid replay request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !h.startReplay() {
+		http.Error(w, "service is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	defer h.replays.Done()
+
+	logger.Info("Replay requested via admin API", "remote", r.RemoteAddr, "dry_run", req.DryRun)
+	// a client that gave up waiting must not leave the replay half done, only shutdown stops it.
+	// the outcome is logged either way
+	res, err := broker.Replay(h.replayCtx, h.cfg.Get(), h.kafka, h.target, req)
+	resp := replayResponse{ReplayResult: res}
+	if err != nil {
+		logger.Error(err, "Replay failed")
+		resp.Error = err.Error()
+		writeJSONStatus(w, http.StatusBadGateway, resp)
+		return
+	}
+	writeJSON(w, resp)
+}
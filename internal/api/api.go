@@ -1,16 +1,21 @@
 package api
 
 import (
-	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
-	"time"
 
+	"github.com/beganov/L0/internal/auth"
 	"github.com/beganov/L0/internal/cache"
 	"github.com/beganov/L0/internal/config"
-	"github.com/beganov/L0/internal/database"
+	"github.com/beganov/L0/internal/gql"
+	"github.com/beganov/L0/internal/health"
 	"github.com/beganov/L0/internal/logger"
 	"github.com/beganov/L0/internal/metrics"
+	"github.com/beganov/L0/internal/models"
+	"github.com/beganov/L0/internal/pii"
+	"github.com/beganov/L0/internal/projection"
+	"github.com/beganov/L0/internal/storage"
 
 	_ "github.com/beganov/L0/docs"
 
@@ -21,29 +26,66 @@ import (
 	httpSwagger "github.com/swaggo/http-swagger"
 )
 
-func SetupRouter(cache *cache.OrderCache, db *pgxpool.Pool) http.Handler {
+// ingest is nil when order submission is disabled, stream is nil without live stream,
+// authn is nil when auth is disabled
+func SetupRouter(cfg *config.Holder, cache *cache.OrderCache, l2 *cache.RedisCache, db *pgxpool.Pool, checker *health.Checker, admin *AdminHandler, ingest *IngestHandler, stream *StreamHandler, erase *ErasureHandler, authn *auth.Auth) http.Handler {
 	r := mux.NewRouter()
-	handler := NewOrderHandler(cache, db)
+	store := storage.NewStorage(cfg, cache, l2, db)
+	handler := NewOrderHandler(cfg, store)
+
+	r.Handle("/order/{id}", authn.RequireFunc(auth.RoleViewer, handler.GetOrder)).Methods("GET")
+	r.Handle("/orders/{id}/status", authn.RequireFunc(auth.RoleViewer, handler.GetOrderStatus)).Methods("GET")
+	r.Handle("/orders:batchGet", authn.RequireFunc(auth.RoleViewer, handler.BatchGetOrders)).Methods("POST")
+	if ingest != nil {
+		r.Handle("/orders", authn.RequireBody(auth.RoleSupport, maxIngestBody, ingest.CreateOrders)).Methods("POST")
+	}
+	if cfg.Get().GraphQL.Enabled {
+		r.Handle("/graphql", authn.Require(auth.RoleViewer, gql.NewHandler(cfg, cache, store, db))).Methods("GET", "POST")
+	}
+	if stream != nil {
+		r.Handle("/orders/stream", authn.RequireFunc(auth.RoleViewer, stream.Orders)).Methods("GET")
+		r.Handle("/orders/ws", authn.RequireFunc(auth.RoleViewer, stream.OrdersWS)).Methods("GET")
+	}
+	r.PathPrefix("/swagger/").Handler(authn.Require(auth.RoleAdmin, httpSwagger.WrapHandler))
+	setupServiceRoutes(r, checker, admin, erase, authn)
 
-	r.HandleFunc("/order/{id}", handler.GetOrder).Methods("GET")
-	r.PathPrefix("/swagger/").Handler(httpSwagger.WrapHandler)
-	r.Handle("/metrics", promhttp.Handler())
+	return r
+}
 
+// health and metrics only, for instances that do not serve the API
+func SetupServiceRouter(checker *health.Checker, admin *AdminHandler, erase *ErasureHandler, authn *auth.Auth) http.Handler {
+	r := mux.NewRouter()
+	setupServiceRoutes(r, checker, admin, erase, authn)
 	return r
 }
 
+// admin is nil when this instance does not consume.
+// probes stay open, orchestrators do not send credentials
+func setupServiceRoutes(r *mux.Router, checker *health.Checker, admin *AdminHandler, erase *ErasureHandler, authn *auth.Auth) {
+	r.HandleFunc("/livez", checker.Livez).Methods("GET")
+	r.HandleFunc("/readyz", checker.Readyz).Methods("GET")
+	r.Handle("/healthz", authn.RequireFunc(auth.RoleViewer, checker.Healthz)).Methods("GET")
+	r.Handle("/metrics", authn.Require(auth.RoleAdmin, promhttp.Handler()))
+
+	if admin != nil {
+		r.Handle("/admin/consumer/pause", authn.RequireFunc(auth.RoleAdmin, admin.PauseConsumer)).Methods("POST")
+		r.Handle("/admin/consumer/resume", authn.RequireFunc(auth.RoleAdmin, admin.ResumeConsumer)).Methods("POST")
+		r.Handle("/admin/consumer/assignment", authn.RequireFunc(auth.RoleAdmin, admin.Assignment)).Methods("GET")
+		r.Handle("/admin/replay", authn.RequireFunc(auth.RoleAdmin, admin.Replay)).Methods("POST")
+	}
+	// erasing needs a known actor for the audit, without auth only the CLI erases
+	if erase != nil && authn != nil {
+		r.Handle("/admin/erasure", authn.RequireFunc(auth.RoleAdmin, erase.Erase)).Methods("POST")
+	}
+}
+
 type OrderHandler struct {
-	cache       *cache.OrderCache
-	db          *pgxpool.Pool
-	httpTimeOut time.Duration
+	cfg   *config.Holder // batch limit may change on reload
+	store *storage.Storage
 }
 
-func NewOrderHandler(cache *cache.OrderCache, db *pgxpool.Pool) *OrderHandler {
-	return &OrderHandler{
-		cache:       cache,
-		db:          db,
-		httpTimeOut: config.HttpTimeOut,
-	}
+func NewOrderHandler(cfg *config.Holder, store *storage.Storage) *OrderHandler {
+	return &OrderHandler{cfg: cfg, store: store}
 }
 
 // GetOrder return order by id
@@ -55,17 +97,18 @@ func (h *OrderHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
 
 	orderID := mux.Vars(r)["id"]
 
-	// check cache
-	if order, ok := h.cache.Get(orderID); ok {
-		writeJSON(w, order)
+	// sparse fieldsets, rejected before any lookup
+	q := r.URL.Query()
+	proj, err := projection.Parse(q.Get("fields"), q.Get("exclude"), h.cfg.Get().HTTP.ProjectionAllow)
+	if err != nil {
+		metrics.HttpErrorsTotal.Inc()
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// get from db with timeout
-	dbCtx, cancel := context.WithTimeout(r.Context(), h.httpTimeOut)
-	defer cancel()
-
-	order, err := database.GetOrderFromDB(dbCtx, h.db, orderID, config.SelectTimeOut)
+	// cache, L2, then db with timeout
+	order, err := h.store.Get(r.Context(), orderID)
 	if err != nil {
 		metrics.HttpErrorsTotal.Inc()
 		logger.Error(err, "order not found")
@@ -74,16 +117,108 @@ func (h *OrderHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// save in cache
-	h.cache.Set(orderID, order)
+	// personal data as the caller role may see it, the cache keeps it in full
+	order = pii.Mask(order, auth.CallerRole(r.Context()).String())
+	if proj.Empty() {
+		writeJSON(w, order)
+		return
+	}
+	doc, err := proj.Apply(order)
+	if err != nil {
+		metrics.HttpErrorsTotal.Inc()
+		logger.Error(err, "order projection failed")
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, doc)
+}
+
+type batchGetRequest struct {
+	IDs []string `json:"ids"`
+}
+
+type batchGetResponse struct {
+	Orders  map[string]models.Order `json:"orders"`
+	Missing []string                `json:"missing"`
+}
+
+// BatchGetOrders returns up to http.batch_max orders by id. cache hits are answered
+// from memory, all misses are read from DB in one round trip
+func (h *OrderHandler) BatchGetOrders(w http.ResponseWriter, r *http.Request) {
+	timer := prometheus.NewTimer(metrics.HttpDuration)
+	defer timer.ObserveDuration()
+
+	metrics.HttpRequestsTotal.Inc()
+	max := h.cfg.Get().HTTP.BatchMax
+
+	var req batchGetRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		metrics.HttpErrorsTotal.Inc()
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.IDs) == 0 {
+		metrics.HttpErrorsTotal.Inc()
+		http.Error(w, "ids are required", http.StatusBadRequest)
+		return
+	}
+	if len(req.IDs) > max {
+		metrics.HttpErrorsTotal.Inc()
+		http.Error(w, fmt.Sprintf("at most %d ids in one request", max), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	found, missing, err := h.store.GetMany(r.Context(), req.IDs)
+	if err != nil {
+		metrics.HttpErrorsTotal.Inc()
+		logger.Error(err, "bulk order lookup failed")
+		http.Error(w, "Orders unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if missing == nil {
+		missing = []string{}
+	}
+	role := auth.CallerRole(r.Context()).String()
+	for id, o := range found {
+		found[id] = pii.Mask(o, role)
+	}
+	writeJSON(w, batchGetResponse{Orders: found, Missing: missing})
+}
 
-	writeJSON(w, order)
+type orderStatus struct {
+	OrderUID string `json:"order_uid"`
+	Status   string `json:"status"` // persisted or pending
+}
+
+// GetOrderStatus reports whether a submitted order is already stored.
+// pending also covers ids that were never submitted
+func (h *OrderHandler) GetOrderStatus(w http.ResponseWriter, r *http.Request) {
+	metrics.HttpRequestsTotal.Inc()
+	orderID := mux.Vars(r)["id"]
+
+	exists, err := h.store.Exists(r.Context(), orderID)
+	if err != nil {
+		metrics.HttpErrorsTotal.Inc()
+		logger.Error(err, "order status check failed")
+		http.Error(w, "Status unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	status := "pending"
+	if exists {
+		status = "persisted"
+	}
+	writeJSON(w, orderStatus{OrderUID: orderID, Status: status})
 }
 
 // writeJSON send json to client
 func writeJSON(w http.ResponseWriter, data interface{}) {
+	writeJSONStatus(w, http.StatusOK, data)
+}
+
+func writeJSONStatus(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(status)
 	if err := json.NewEncoder(w).Encode(data); err != nil {
 		logger.Error(err, "cannot encode json")
 	}
@@ -0,0 +1,181 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/beganov/L0/internal/auth"
+	"github.com/beganov/L0/internal/broker"
+	"github.com/beganov/L0/internal/cache"
+	"github.com/beganov/L0/internal/config"
+	"github.com/beganov/L0/internal/erasure"
+	"github.com/beganov/L0/internal/models"
+	"github.com/beganov/L0/internal/storage"
+)
+
+func batchGet(h *OrderHandler, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/orders:batchGet", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	h.BatchGetOrders(w, req)
+	return w
+}
+
+// --- Тест пакетного получения: заказы из кеша без обращения к БД и лимит на число id ---
+func TestBatchGetOrders_FromCache(t *testing.T) {
+	cfg := config.Default()
+	cfg.HTTP.BatchMax = 3
+	holder := config.NewHolder(cfg)
+	oc := cache.NewOrderCache(10)
+	oc.Set("o1", models.Order{OrderUID: "o1"})
+	oc.Set("o2", models.Order{OrderUID: "o2"})
+	h := NewOrderHandler(holder, storage.NewStorage(holder, oc, nil, nil))
+
+	w := batchGet(h, `{"ids":["o1","o2","o1"]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", w.Code, w.Body)
+	}
+	var resp batchGetResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Orders) != 2 || resp.Orders["o2"].OrderUID != "o2" || len(resp.Missing) != 0 {
+		t.Errorf("unexpected response %+v", resp)
+	}
+
+	if w := batchGet(h, `{"ids":["a","b","c","d"]}`); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("too many ids must give 413, got %d", w.Code)
+	}
+	if w := batchGet(h, `{"ids":[]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("empty ids must give 400, got %d", w.Code)
+	}
+}
+
+// --- Тест маскирования: support видит последние 4 цифры телефона, кеш хранит полные данные ---
+func TestBatchGetOrders_MasksForRole(t *testing.T) {
+	holder := config.NewHolder(config.Default())
+	oc := cache.NewOrderCache(10)
+	oc.Set("o1", models.Order{OrderUID: "o1", Delivery: models.Delivery{Phone: "+9720000000"}})
+	h := NewOrderHandler(holder, storage.NewStorage(holder, oc, nil, nil))
+
+	req := httptest.NewRequest(http.MethodPost, "/orders:batchGet", strings.NewReader(`{"ids":["o1"]}`))
+	req = req.WithContext(auth.WithPrincipal(req.Context(), auth.Principal{Subject: "s", Role: auth.RoleSupport}))
+	w := httptest.NewRecorder()
+	h.BatchGetOrders(w, req)
+
+	var resp batchGetResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Orders["o1"].Delivery.Phone; got != "*******0000" {
+		t.Errorf("support phone: %q", got)
+	}
+	if cached, _ := oc.Get("o1"); cached.Delivery.Phone != "+9720000000" {
+		t.Errorf("cached order masked: %q", cached.Delivery.Phone)
+	}
+}
+
+// --- Тест удаления данных: без аутентификации эндпоинта нет, без ключа 401 ---
+func TestErasureRoute_NeedsAuth(t *testing.T) {
+	holder := config.NewHolder(config.Default())
+	erase := NewErasureHandler(holder, erasure.Target{})
+	post := func(h http.Handler) int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/erasure", strings.NewReader(`{"email":"a@b.c"}`)))
+		return w.Code
+	}
+
+	if code := post(SetupServiceRouter(nil, nil, erase, nil)); code != http.StatusNotFound {
+		t.Errorf("auth disabled: got %d, want 404", code)
+	}
+
+	keys := filepath.Join(t.TempDir(), "keys")
+	if err := os.WriteFile(keys, []byte("ops admin "+strings.Repeat("0", 64)+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	authn, err := auth.New(config.AuthConfig{Enabled: true, APIKeysFile: keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := post(SetupServiceRouter(nil, nil, erase, authn)); code != http.StatusUnauthorized {
+		t.Errorf("no credentials: got %d, want 401", code)
+	}
+}
+
+// --- Тест остановки: повторная обработка прерывается при остановке сервиса, новые не запускаются ---
+func TestReplay_StoppedByShutdown(t *testing.T) {
+	// broker that accepts connections and never answers, the replay waits for its group
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var conns []net.Conn
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+		}
+	}()
+	// hanging requests would hold the group close for its request timeout
+	gone := func() {
+		lis.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		for _, c := range conns {
+			c.Close()
+		}
+	}
+	defer gone()
+
+	cfg := config.Default()
+	cfg.Kafka.Brokers = []string{lis.Addr().String()}
+	kc, err := broker.NewKafka(cfg.Kafka)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewAdminHandler(config.NewHolder(cfg), kc, broker.NewControl(), broker.ReplayTarget{})
+	replay := func() chan int {
+		code := make(chan int, 1)
+		go func() {
+			w := httptest.NewRecorder()
+			h.Replay(w, httptest.NewRequest(http.MethodPost, "/admin/replay", strings.NewReader(`{"dry_run":true}`)))
+			code <- w.Code
+		}()
+		return code
+	}
+
+	running := replay()
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case c := <-running:
+		t.Fatalf("replay ended before shutdown with %d", c)
+	default:
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	gone()
+	if err := h.StopReplays(ctx); err != nil {
+		t.Fatalf("running replay not stopped: %v", err)
+	}
+	if c := <-running; c != http.StatusBadGateway {
+		t.Errorf("stopped replay: got %d, want 502", c)
+	}
+	if c := <-replay(); c != http.StatusServiceUnavailable {
+		t.Errorf("replay after shutdown: got %d, want 503", c)
+	}
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/beganov/L0/internal/auth"
+	"github.com/beganov/L0/internal/config"
+	"github.com/beganov/L0/internal/erasure"
+	"github.com/beganov/L0/internal/logger"
+)
+
+// erasure of customer data for operators
+type ErasureHandler struct {
+	cfg    *config.Holder
+	target erasure.Target
+}
+
+func NewErasureHandler(cfg *config.Holder, target erasure.Target) *ErasureHandler {
+	return &ErasureHandler{cfg: cfg, target: target}
+}
+
+type erasureResponse struct {
+	erasure.Result
+	Error string `json:"error,omitempty"`
+}
+
+// Erase anonymizes orders of one customer found by customer_id, email or phone.
+// dry_run only lists the orders, both are audited
+func (h *ErasureHandler) Erase(w http.ResponseWriter, r *http.Request) {
+	var req erasure.Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid erasure request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	p, _ := auth.FromContext(r.Context())
+	actor := p.Method + ":" + p.Subject
+	res, err := erasure.Erase(r.Context(), h.cfg.Get(), h.target, actor, req)
+	switch {
+	case errors.Is(err, erasure.ErrInvalidRequest):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case err != nil && res.AuditID == 0:
+		logger.Error(err, "Erasure failed")
+		http.Error(w, "Erasure failed", http.StatusServiceUnavailable)
+	case err != nil:
+		// DB is anonymized, only some cached copies are left to expire
+		logger.Error(err, "Erasure cache eviction incomplete")
+		writeJSONStatus(w, http.StatusBadGateway, erasureResponse{Result: res, Error: err.Error()})
+	default:
+		writeJSON(w, erasureResponse{Result: res})
+	}
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/beganov/L0/internal/broker"
+	"github.com/beganov/L0/internal/config"
+	"github.com/beganov/L0/internal/logger"
+	"github.com/beganov/L0/internal/metrics"
+	"github.com/beganov/L0/internal/models"
+)
+
+// request body limit of POST /orders
+const maxIngestBody = 32 << 20
+
+// order submission for partners without broker access
+type IngestHandler struct {
+	cfg  *config.Holder
+	sink broker.Sink
+}
+
+func NewIngestHandler(cfg *config.Holder, sink broker.Sink) *IngestHandler {
+	return &IngestHandler{cfg: cfg, sink: sink}
+}
+
+type acceptedOrder struct {
+	OrderUID  string `json:"order_uid"`
+	StatusURL string `json:"status_url"`
+}
+
+type batchAccepted struct {
+	Accepted []acceptedOrder `json:"accepted"`
+}
+
+type rejectedOrder struct {
+	Index    int                 `json:"index"`
+	OrderUID string              `json:"order_uid,omitempty"`
+	Fields   []models.FieldError `json:"fields"`
+}
+
+type ingestError struct {
+	Error  string              `json:"error"`
+	Fields []models.FieldError `json:"fields,omitempty"` // single order
+	Orders []rejectedOrder     `json:"orders,omitempty"` // batch
+}
+
+// CreateOrders accepts one order or a JSON array of orders. All orders are validated
+// before anything is published, one invalid order rejects the whole batch with 422.
+// Accepted orders are published to the consumed topic and answered with 202
+func (h *IngestHandler) CreateOrders(w http.ResponseWriter, r *http.Request) {
+	metrics.HttpRequestsTotal.Inc()
+	cfg := h.cfg.Get()
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIngestBody))
+	if err != nil {
+		ingestFail(w, http.StatusRequestEntityTooLarge, ingestError{Error: err.Error()})
+		return
+	}
+	raws, batch, err := splitOrders(body)
+	if err != nil {
+		ingestFail(w, http.StatusBadRequest, ingestError{Error: "invalid JSON: " + err.Error()})
+		return
+	}
+	if len(raws) == 0 {
+		ingestFail(w, http.StatusBadRequest, ingestError{Error: "empty batch"})
+		return
+	}
+	if len(raws) > cfg.Ingest.MaxBatch {
+		ingestFail(w, http.StatusRequestEntityTooLarge, ingestError{Error: "too many orders in one request"})
+		return
+	}
+
+	orders := make([]models.Order, len(raws))
+	var rejected []rejectedOrder
+	for i, raw := range raws {
+		if err := json.Unmarshal(raw, &orders[i]); err != nil {
+			rejected = append(rejected, rejectedOrder{Index: i, Fields: []models.FieldError{{Field: "order", Message: err.Error()}}})
+			continue
+		}
+		var verr *models.ValidationError
+		if errors.As(orders[i].Validate(), &verr) {
+			rejected = append(rejected, rejectedOrder{Index: i, OrderUID: orders[i].OrderUID, Fields: verr.Fields})
+		}
+	}
+	if len(rejected) > 0 {
+		metrics.IngestOrdersTotal.WithLabelValues("invalid").Add(float64(len(rejected)))
+		resp := ingestError{Error: "validation failed", Orders: rejected}
+		if !batch {
+			resp = ingestError{Error: "validation failed", Fields: rejected[0].Fields}
+		}
+		ingestFail(w, http.StatusUnprocessableEntity, resp)
+		return
+	}
+
+	// message key keeps all versions of an order in one partition.
+	// only JetStream drops repeats by the idempotency key (Nats-Msg-Id),
+	// Kafka just carries the header and the order_uid conflict in the DB absorbs them
+	idem := r.Header.Get(broker.IdempotencyKeyHeader)
+	msgs := make([]broker.Message, len(orders))
+	accepted := make([]acceptedOrder, len(orders))
+	for i, o := range orders {
+		key := o.OrderUID
+		switch {
+		case idem != "" && batch:
+			key = idem + ":" + o.OrderUID
+		case idem != "":
+			key = idem
+		}
+		msgs[i] = broker.Message{
+			Key:     []byte(o.OrderUID),
+			Value:   raws[i],
+			Headers: map[string]string{broker.IdempotencyKeyHeader: key},
+		}
+		accepted[i] = acceptedOrder{OrderUID: o.OrderUID, StatusURL: "/orders/" + url.PathEscape(o.OrderUID) + "/status"}
+	}
+
+	// all orders go in one synchronous publish, the writer flushes it right away
+	ctx, cancel := context.WithTimeout(r.Context(), cfg.Ingest.Timeout)
+	defer cancel()
+	if err := h.sink.Publish(ctx, msgs...); err != nil {
+		metrics.IngestOrdersTotal.WithLabelValues("failed").Add(float64(len(msgs)))
+		logger.Error(err, "publish of submitted orders failed")
+		ingestFail(w, http.StatusServiceUnavailable, ingestError{Error: "orders not accepted, try again"})
+		return
+	}
+	metrics.IngestOrdersTotal.WithLabelValues("accepted").Add(float64(len(msgs)))
+
+	if !batch {
+		w.Header().Set("Location", accepted[0].StatusURL)
+		writeJSONStatus(w, http.StatusAccepted, accepted[0])
+		return
+	}
+	writeJSONStatus(w, http.StatusAccepted, batchAccepted{Accepted: accepted})
+}
+
+// body is one order object or an array of them, raw orders are published as sent
+func splitOrders(body []byte) ([]json.RawMessage, bool, error) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var raws []json.RawMessage
+		err := json.Unmarshal(trimmed, &raws)
+		return raws, true, err
+	}
+	var raw json.RawMessage
+	if err := json.Unmarshal(trimmed, &raw); err != nil {
+		return nil, false, err
+	}
+	return []json.RawMessage{raw}, false, nil
+}
+
+func ingestFail(w http.ResponseWriter, status int, resp ingestError) {
+	metrics.HttpErrorsTotal.Inc()
+	writeJSONStatus(w, status, resp)
+}
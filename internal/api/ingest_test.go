@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/beganov/L0/internal/broker"
+	"github.com/beganov/L0/internal/config"
+	"github.com/beganov/L0/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const validOrder = `{"order_uid":"o1","delivery":{"name":"Ivan"},"payment":{"transaction":"o1"},"items":[{"chrt_id":1}]}`
+
+func postOrders(h *IngestHandler, body, idem string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+	if idem != "" {
+		req.Header.Set("Idempotency-Key", idem)
+	}
+	w := httptest.NewRecorder()
+	h.CreateOrders(w, req)
+	return w
+}
+
+// --- Тест приёма одного заказа: 202, ссылка на статус, ключ идемпотентности ---
+func TestCreateOrders_Single(t *testing.T) {
+	mb := broker.NewMemoryBroker("orders")
+	h := NewIngestHandler(config.NewHolder(config.Default()), mb)
+
+	w := postOrders(h, validOrder, "req-1")
+	if w.Code != http.StatusAccepted || w.Header().Get("Location") != "/orders/o1/status" {
+		t.Fatalf("unexpected response %d %s", w.Code, w.Body)
+	}
+
+	msg, err := mb.Fetch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(msg.Key) != "o1" || msg.Headers[broker.IdempotencyKeyHeader] != "req-1" || string(msg.Value) != validOrder {
+		t.Errorf("unexpected published message %+v", msg)
+	}
+}
+
+// --- Тест пакета: один невалидный заказ отклоняет весь пакет с ошибками по полям ---
+func TestCreateOrders_BatchValidation(t *testing.T) {
+	mb := broker.NewMemoryBroker("orders")
+	h := NewIngestHandler(config.NewHolder(config.Default()), mb)
+
+	invalid := metrics.IngestOrdersTotal.WithLabelValues("invalid")
+	before := testutil.ToFloat64(invalid)
+	w := postOrders(h, `[`+validOrder+`, {"order_uid":"o2","items":[{"chrt_id":0}]}]`, "")
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d %s", w.Code, w.Body)
+	}
+	// the valid order of a rejected batch is not counted as invalid
+	if got := testutil.ToFloat64(invalid) - before; got != 1 {
+		t.Errorf("expected 1 invalid order counted, got %v", got)
+	}
+	var resp ingestError
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Orders) != 1 || resp.Orders[0].Index != 1 || len(resp.Orders[0].Fields) != 3 {
+		t.Errorf("expected 3 field errors of order 1, got %+v", resp.Orders)
+	}
+	if resp.Orders[0].Fields[2].Field != "items[0].chrt_id" {
+		t.Errorf("unexpected field path %q", resp.Orders[0].Fields[2].Field)
+	}
+
+	w = postOrders(h, `[`+validOrder+`,`+strings.ReplaceAll(validOrder, "o1", "o2")+`]`, "req-2")
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d %s", w.Code, w.Body)
+	}
+	for _, want := range []string{"req-2:o1", "req-2:o2"} {
+		msg, _ := mb.Fetch(context.Background())
+		if got := msg.Headers[broker.IdempotencyKeyHeader]; got != want {
+			t.Errorf("idempotency key %q, want %q", got, want)
+		}
+	}
+
+	if w := postOrders(h, `{"order_uid":`, ""); w.Code != http.StatusBadRequest {
+		t.Errorf("broken JSON must give 400, got %d", w.Code)
+	}
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/beganov/L0/internal/logger"
+)
+
+// HTTP server as supervised component
+type Server struct {
+	srv *http.Server
+}
+
+// constructor
+func NewServer(addr string, handler http.Handler) *Server {
+	return &Server{srv: &http.Server{Addr: addr, Handler: handler}}
+}
+
+func (s *Server) Name() string {
+	return "http"
+}
+
+// listen until Shutdown, listen errors are returned for restart
+func (s *Server) Start(ctx context.Context) error {
+	logger.Info("HTTP server running at", "addr", s.srv.Addr)
+	if err := s.srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// wait for in-flight requests
+func (s *Server) Stop(ctx context.Context) error {
+	return s.srv.Shutdown(ctx)
+}
+
+// serving requests is all the server has to do
+func (s *Server) Health(ctx context.Context) error {
+	return nil
+}
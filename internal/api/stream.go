@@ -0,0 +1,231 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/beganov/L0/internal/auth"
+	"github.com/beganov/L0/internal/config"
+	"github.com/beganov/L0/internal/events"
+	"github.com/beganov/L0/internal/logger"
+	"github.com/beganov/L0/internal/metrics"
+	"github.com/beganov/L0/internal/models"
+	"github.com/beganov/L0/internal/pii"
+
+	"github.com/gorilla/websocket"
+)
+
+// live stream of orders stored by this instance, over SSE and WebSocket
+type StreamHandler struct {
+	cfg  *config.Holder // buffer, heartbeat and write timeout may change on reload
+	hub  *events.Hub
+	done chan struct{}
+	once sync.Once
+}
+
+func NewStreamHandler(cfg *config.Holder, hub *events.Hub) *StreamHandler {
+	return &StreamHandler{cfg: cfg, hub: hub, done: make(chan struct{})}
+}
+
+// end all open streams, HTTP shutdown would wait for them otherwise
+func (h *StreamHandler) Close() {
+	h.once.Do(func() { close(h.done) })
+}
+
+// browsers cannot set headers on WebSocket, stream is as public as GET /order
+var upgrader = websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+
+// query of a stream request, empty filter fields match any order
+type streamRequest struct {
+	customerID      string
+	deliveryService string
+	lastID          string
+}
+
+func parseStreamRequest(r *http.Request) streamRequest {
+	q := r.URL.Query()
+	req := streamRequest{customerID: q.Get("customer_id"), deliveryService: q.Get("delivery_service")}
+	// EventSource sends the header on reconnect, WebSocket clients use the query
+	last := r.Header.Get("Last-Event-ID")
+	if last == "" {
+		last = q.Get("last_event_id")
+	}
+	req.lastID = last
+	return req
+}
+
+// o is masked for the caller, a role that sees customer_id hashed filters by
+// the hash and cannot probe raw ids
+func (req streamRequest) match(o models.Order) bool {
+	return (req.customerID == "" || req.customerID == o.CustomerID) &&
+		(req.deliveryService == "" || req.deliveryService == o.DeliveryService)
+}
+
+// false when events after the requested id were lost
+func (h *StreamHandler) subscribe(req streamRequest, buffer int) (*events.Subscription, bool) {
+	if req.lastID == "" {
+		return h.hub.Subscribe(buffer), true
+	}
+	id, ok := h.hub.ParseID(req.lastID)
+	if !ok {
+		// id of an earlier process or garbage, nothing to continue from
+		return h.hub.Subscribe(buffer), false
+	}
+	return h.hub.Resume(id, buffer)
+}
+
+// Orders streams stored orders as Server-Sent Events: "order" events with the
+// order JSON and its id, "reset" when resuming lost events, "dropped" before
+// a client that fell behind is disconnected
+func (h *StreamHandler) Orders(w http.ResponseWriter, r *http.Request) {
+	metrics.HttpRequestsTotal.Inc()
+	req := parseStreamRequest(r)
+	cfg := h.cfg.Get().Stream
+	sub, complete := h.subscribe(req, cfg.Buffer)
+	defer sub.Close()
+	metrics.StreamClients.WithLabelValues("sse").Inc()
+	defer metrics.StreamClients.WithLabelValues("sse").Dec()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx must not buffer the stream
+	// no CORS header, the stream is authenticated like the rest of the read API
+	w.WriteHeader(http.StatusOK)
+
+	// stalled client fails the write instead of holding the handler
+	rc := http.NewResponseController(w)
+	write := func(format string, args ...any) error {
+		_ = rc.SetWriteDeadline(time.Now().Add(cfg.WriteTimeout))
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	role := auth.CallerRole(r.Context()).String()
+	first := ": connected\n\n"
+	if !complete {
+		first = "event: reset\ndata: {}\n\n"
+	}
+	if err := write("%s", first); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(cfg.Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-h.done:
+			return
+		case <-heartbeat.C:
+			if err := write(": ping\n\n"); err != nil {
+				return
+			}
+		case ev, ok := <-sub.C():
+			if !ok {
+				metrics.StreamDroppedTotal.WithLabelValues("sse").Inc()
+				_ = write("event: dropped\ndata: {}\n\n")
+				return
+			}
+			order := pii.Mask(ev.Order, role)
+			if !req.match(order) {
+				continue
+			}
+			data, err := json.Marshal(order)
+			if err != nil {
+				logger.Error(err, "cannot encode json")
+				continue
+			}
+			if err := write("id: %s\nevent: order\ndata: %s\n\n", h.hub.FormatID(ev.ID), data); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// message of the WebSocket stream
+type streamMessage struct {
+	Type  string        `json:"type"` // order or reset
+	ID    string        `json:"id,omitempty"`
+	Order *models.Order `json:"order,omitempty"`
+}
+
+// OrdersWS is the WebSocket variant of Orders. client that fell behind is
+// closed with 1013 (try again later), resume with ?last_event_id=
+func (h *StreamHandler) OrdersWS(w http.ResponseWriter, r *http.Request) {
+	metrics.HttpRequestsTotal.Inc()
+	req := parseStreamRequest(r)
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		metrics.HttpErrorsTotal.Inc()
+		return // upgrader already answered
+	}
+	defer conn.Close()
+
+	cfg := h.cfg.Get().Stream
+	sub, complete := h.subscribe(req, cfg.Buffer)
+	defer sub.Close()
+	metrics.StreamClients.WithLabelValues("websocket").Inc()
+	defer metrics.StreamClients.WithLabelValues("websocket").Dec()
+
+	// client sends nothing, reading only notices close and answers pings
+	gone := make(chan struct{})
+	conn.SetReadLimit(512)
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(msg streamMessage) error {
+		_ = conn.SetWriteDeadline(time.Now().Add(cfg.WriteTimeout))
+		return conn.WriteJSON(msg)
+	}
+	closeWith := func(code int, text string) {
+		_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(cfg.WriteTimeout))
+	}
+
+	role := auth.CallerRole(r.Context()).String()
+	if !complete {
+		if err := send(streamMessage{Type: "reset"}); err != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(cfg.Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-gone:
+			return
+		case <-h.done:
+			closeWith(websocket.CloseGoingAway, "server is stopping")
+			return
+		case <-heartbeat.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(cfg.WriteTimeout)); err != nil {
+				return
+			}
+		case ev, ok := <-sub.C():
+			if !ok {
+				metrics.StreamDroppedTotal.WithLabelValues("websocket").Inc()
+				closeWith(websocket.CloseTryAgainLater, "client fell behind")
+				return
+			}
+			order := pii.Mask(ev.Order, role)
+			if !req.match(order) {
+				continue
+			}
+			if err := send(streamMessage{Type: "order", ID: h.hub.FormatID(ev.ID), Order: &order}); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beganov/L0/internal/auth"
+	"github.com/beganov/L0/internal/config"
+	"github.com/beganov/L0/internal/events"
+	"github.com/beganov/L0/internal/models"
+	"github.com/beganov/L0/internal/pii"
+
+	"github.com/gorilla/websocket"
+)
+
+// streams as served without auth, the caller is the anonymous admin
+func startStream(t *testing.T, cfg *config.Config, hub *events.Hub) *httptest.Server {
+	return startStreamAs(t, cfg, hub, auth.Principal{Subject: "anonymous", Role: auth.RoleAdmin, Method: "none"})
+}
+
+func startStreamAs(t *testing.T, cfg *config.Config, hub *events.Hub, p auth.Principal) *httptest.Server {
+	h := NewStreamHandler(config.NewHolder(cfg), hub)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/orders/stream", h.Orders)
+	mux.HandleFunc("/orders/ws", h.OrdersWS)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), p)))
+	}))
+	t.Cleanup(func() {
+		h.Close()
+		srv.Close()
+	})
+	return srv
+}
+
+// read SSE frames until one of the given event type, returns its id and data lines
+func readEvent(t *testing.T, r *bufio.Reader, event string) (string, string) {
+	t.Helper()
+	var id, typ, data string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("stream ended: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			typ = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		case line == "":
+			if typ == event {
+				return id, data
+			}
+			id, typ, data = "", "", ""
+		}
+	}
+}
+
+// --- Тест SSE: фильтр по клиенту и продолжение с Last-Event-ID ---
+func TestStream_SSE(t *testing.T) {
+	hub := events.NewHub(10)
+	srv := startStream(t, config.Default(), hub)
+
+	resp, err := http.Get(srv.URL + "/orders/stream?customer_id=c1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	if origin := resp.Header.Get("Access-Control-Allow-Origin"); origin != "" {
+		t.Errorf("unexpected CORS header %q", origin)
+	}
+	waitSubscribers(t, hub, 1)
+
+	hub.Publish(models.Order{OrderUID: "o1", CustomerID: "c2"})
+	hub.Publish(models.Order{OrderUID: "o2", CustomerID: "c1"})
+	id, data := readEvent(t, bufio.NewReader(resp.Body), "order")
+	if id != hub.FormatID(2) || !strings.Contains(data, `"order_uid":"o2"`) {
+		t.Errorf("expected order o2 with id 2, got %s %s", id, data)
+	}
+
+	// reconnect after event 1 gets event 2 from the ring
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/orders/stream", nil)
+	req.Header.Set("Last-Event-ID", hub.FormatID(1))
+	resumed, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resumed.Body.Close()
+	if id, _ := readEvent(t, bufio.NewReader(resumed.Body), "order"); id != hub.FormatID(2) {
+		t.Errorf("resumed stream must start with event 2, got %s", id)
+	}
+
+	// same number issued before a restart is not resumable
+	for _, last := range []string{"1", "0-1"} {
+		req.Header.Set("Last-Event-ID", last)
+		restarted, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		readEvent(t, bufio.NewReader(restarted.Body), "reset")
+		restarted.Body.Close()
+	}
+}
+
+// --- Тест фильтра для viewer: настоящий customer_id не находит заказов, хеш находит ---
+func TestStream_ViewerFiltersByHash(t *testing.T) {
+	hub := events.NewHub(10)
+	srv := startStreamAs(t, config.Default(), hub, auth.Principal{Subject: "board", Role: auth.RoleViewer, Method: "apikey"})
+	hashed := pii.Apply(pii.Hash, "c1")
+
+	byHash, err := http.Get(srv.URL + "/orders/stream?customer_id=" + url.QueryEscape(hashed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer byHash.Body.Close()
+	waitSubscribers(t, hub, 1)
+
+	hub.Publish(models.Order{OrderUID: "o1", CustomerID: "c1"})
+	hub.Publish(models.Order{OrderUID: "o2", CustomerID: "c2"})
+	if _, data := readEvent(t, bufio.NewReader(byHash.Body), "order"); !strings.Contains(data, `"customer_id":"`+hashed+`"`) {
+		t.Errorf("expected o1 with hashed customer, got %s", data)
+	}
+
+	// the raw id replays the whole buffer without a single match
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/orders/ws?customer_id=c1&last_event_id="+hub.FormatID(0), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	_ = ws.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	var msg streamMessage
+	if err := ws.ReadJSON(&msg); err == nil {
+		t.Errorf("raw customer id matched for viewer: %+v", msg)
+	}
+}
+
+// --- Тест WebSocket: отставший клиент отключается с кодом 1013 ---
+func TestStream_WebSocketDropsSlowClient(t *testing.T) {
+	cfg := config.Default()
+	cfg.Stream.Buffer = 1
+	hub := events.NewHub(0)
+	srv := startStream(t, cfg, hub)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/orders/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	waitSubscribers(t, hub, 1)
+
+	// hub publishes faster than any client reads
+	for i := 0; i < 100 && hub.Len() > 0; i++ {
+		hub.Publish(models.Order{OrderUID: "o"})
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var msg streamMessage
+		err := conn.ReadJSON(&msg)
+		if err == nil {
+			continue
+		}
+		if !websocket.IsCloseError(err, websocket.CloseTryAgainLater) {
+			t.Fatalf("expected close 1013, got %v", err)
+		}
+		return
+	}
+}
+
+func waitSubscribers(t *testing.T, hub *events.Hub, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for hub.Len() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d subscribers, got %d", n, hub.Len())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,228 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beganov/L0/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func keyHash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// handler that reports the caller role and the body it received
+func echo() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, _ := FromContext(r.Context())
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s %s", p.Subject, p.Role, body)
+	})
+}
+
+func serve(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// --- Тест API-ключей: роль ключа, неверный ключ, нехватка прав ---
+func TestAuth_APIKeys(t *testing.T) {
+	file := writeFile(t, "keys", "# name role sha256\nops admin "+keyHash("k-admin")+"\nboard viewer "+keyHash("k-view")+"\n")
+	a, err := New(config.AuthConfig{Enabled: true, APIKeysFile: file})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		key  string
+		role Role
+		code int
+	}{
+		{"k-admin", RoleAdmin, http.StatusOK},
+		{"k-view", RoleViewer, http.StatusOK},
+		{"k-view", RoleSupport, http.StatusForbidden},
+		{"wrong", RoleViewer, http.StatusUnauthorized},
+		{"", RoleViewer, http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		r := httptest.NewRequest("GET", "/order/1", nil)
+		if tc.key != "" {
+			r.Header.Set("X-API-Key", tc.key)
+		}
+		if w := serve(a.Require(tc.role, echo()), r); w.Code != tc.code {
+			t.Errorf("key %q role %s: got %d, want %d", tc.key, tc.role, w.Code, tc.code)
+		}
+	}
+}
+
+// --- Тест HMAC: подпись тела, подмена тела, устаревшая метка времени, повтор запроса, большое тело ---
+func TestAuth_HMAC(t *testing.T) {
+	file := writeFile(t, "hmac", "partner support s3cret\n")
+	a, err := New(config.AuthConfig{Enabled: true, HMACKeysFile: file, HMACSkew: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Unix()
+	body := `{"order_uid":"o1"}`
+
+	seq := 0
+	signedWith := func(ts int64, nonce, sigBody, sentBody string) *http.Request {
+		r := httptest.NewRequest("POST", "/orders?x=1", strings.NewReader(sentBody))
+		r.Header.Set("X-Key-ID", "partner")
+		r.Header.Set("X-Timestamp", strconv.FormatInt(ts, 10))
+		r.Header.Set("X-Nonce", nonce)
+		r.Header.Set("X-Signature", hex.EncodeToString(Sign("s3cret", "POST", "/orders?x=1", ts, nonce, []byte(sigBody))))
+		return r
+	}
+	signed := func(ts int64, sigBody, sentBody string) *http.Request {
+		seq++
+		return signedWith(ts, fmt.Sprintf("nonce-%04d", seq), sigBody, sentBody)
+	}
+
+	w := serve(a.Require(RoleSupport, echo()), signed(now, body, body))
+	if w.Code != http.StatusOK || w.Body.String() != "partner support "+body {
+		t.Fatalf("valid signature: %d %q", w.Code, w.Body.String())
+	}
+	if w := serve(a.Require(RoleSupport, echo()), signed(now, body, `{"order_uid":"o2"}`)); w.Code != http.StatusUnauthorized {
+		t.Errorf("tampered body: got %d", w.Code)
+	}
+	if w := serve(a.Require(RoleSupport, echo()), signed(now-600, body, body)); w.Code != http.StatusUnauthorized {
+		t.Errorf("stale timestamp: got %d", w.Code)
+	}
+	if w := serve(a.Require(RoleAdmin, echo()), signed(now, body, body)); w.Code != http.StatusForbidden {
+		t.Errorf("support on admin route: got %d", w.Code)
+	}
+
+	// captured request sent again within the skew window
+	if w := serve(a.Require(RoleSupport, echo()), signedWith(now, "replayed-1", body, body)); w.Code != http.StatusOK {
+		t.Fatalf("first use of a nonce: got %d", w.Code)
+	}
+	if w := serve(a.Require(RoleSupport, echo()), signedWith(now, "replayed-1", body, body)); w.Code != http.StatusUnauthorized {
+		t.Errorf("replayed nonce: got %d", w.Code)
+	}
+	if w := serve(a.Require(RoleSupport, echo()), signedWith(now, "", body, body)); w.Code != http.StatusUnauthorized {
+		t.Errorf("missing nonce: got %d", w.Code)
+	}
+
+	// replayed nonces and stale timestamps are refused before the body is read
+	for name, r := range map[string]*http.Request{
+		"replayed nonce":  signedWith(now, "replayed-1", body, body),
+		"stale timestamp": signed(now-600, body, body),
+	} {
+		r.Body = unreadBody{t: t, name: name}
+		if w := serve(a.Require(RoleSupport, echo()), r); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: got %d", name, w.Code)
+		}
+	}
+
+	// body over the limit is not truncated into a signature mismatch
+	large := strings.Repeat("x", maxSignedBody+1)
+	if w := serve(a.Require(RoleSupport, echo()), signed(now, large, large)); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized body: got %d", w.Code)
+	}
+	// a route may take more
+	if w := serve(a.RequireBody(RoleSupport, 2*maxSignedBody, echo().ServeHTTP), signed(now, large, large)); w.Code != http.StatusOK {
+		t.Errorf("body under the route limit: got %d", w.Code)
+	}
+}
+
+// body that fails the test when read
+type unreadBody struct {
+	t    *testing.T
+	name string
+}
+
+func (b unreadBody) Read([]byte) (int, error) {
+	b.t.Errorf("%s: body read before the request was refused", b.name)
+	return 0, io.EOF
+}
+
+func (b unreadBody) Close() error { return nil }
+
+// --- Тест JWT: ключ из локального JWKS, issuer, срок действия, роль из массива ---
+func TestAuth_JWT(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks, _ := json.Marshal(map[string]any{"keys": []map[string]string{{
+		"kty": "RSA", "kid": "k1", "use": "sig",
+		"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}})
+	a, err := New(config.AuthConfig{Enabled: true, JWKSFile: writeFile(t, "jwks.json", string(jwks)),
+		JWTIssuer: "idp", JWTRoleClaim: "roles"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := func(claims jwt.MapClaims) string {
+		tok := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		tok.Header["kid"] = "k1"
+		s, err := tok.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+
+	cases := []struct {
+		name   string
+		claims jwt.MapClaims
+		code   int
+	}{
+		{"highest role wins", jwt.MapClaims{"sub": "u1", "iss": "idp", "exp": exp, "roles": []string{"viewer", "admin"}}, http.StatusOK},
+		{"too low", jwt.MapClaims{"sub": "u1", "iss": "idp", "exp": exp, "roles": "viewer"}, http.StatusForbidden},
+		{"wrong issuer", jwt.MapClaims{"sub": "u1", "iss": "other", "exp": exp, "roles": "admin"}, http.StatusUnauthorized},
+		{"expired", jwt.MapClaims{"sub": "u1", "iss": "idp", "exp": time.Now().Add(-time.Hour).Unix(), "roles": "admin"}, http.StatusUnauthorized},
+		{"no expiry", jwt.MapClaims{"sub": "u1", "iss": "idp", "roles": "admin"}, http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		r := httptest.NewRequest("GET", "/metrics", nil)
+		r.Header.Set("Authorization", "Bearer "+token(tc.claims))
+		if w := serve(a.Require(RoleAdmin, echo()), r); w.Code != tc.code {
+			t.Errorf("%s: got %d, want %d", tc.name, w.Code, tc.code)
+		}
+	}
+}
+
+// --- Тест выключенной аутентификации: nil Auth пропускает всех ---
+func TestAuth_Disabled(t *testing.T) {
+	a, err := New(config.AuthConfig{})
+	if err != nil || a != nil {
+		t.Fatalf("disabled auth: %v %v", a, err)
+	}
+	w := serve(a.Require(RoleAdmin, echo()), httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Body.String(), "anonymous admin") {
+		t.Fatalf("got %d %q", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,225 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// credentials of one kind. ok is false when the request carries none of them,
+// error means they are present but wrong
+type authenticator interface {
+	authenticate(r *http.Request) (p Principal, ok bool, err error)
+}
+
+var errBadCredentials = errors.New("invalid credentials")
+
+// ErrBodyTooLarge is returned when a signed body exceeds the size the signature is checked for
+var ErrBodyTooLarge = errors.New("signed request body too large")
+
+type keyEntry struct {
+	name  string
+	role  Role
+	value string
+}
+
+// lines "name role value", blank lines and # comments are skipped
+func readKeyFile(path string) ([]keyEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []keyEntry
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.Fields(line)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("%s:%d: want \"name role value\"", path, n)
+		}
+		role, err := ParseRole(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		entries = append(entries, keyEntry{name: parts[0], role: role, value: parts[2]})
+	}
+	return entries, sc.Err()
+}
+
+// static keys in X-API-Key, the file keeps only their SHA-256
+type apiKeys struct {
+	byHash map[string]keyEntry
+}
+
+func loadAPIKeys(path string) (*apiKeys, error) {
+	entries, err := readKeyFile(path)
+	if err != nil {
+		return nil, err
+	}
+	k := &apiKeys{byHash: make(map[string]keyEntry, len(entries))}
+	for _, e := range entries {
+		k.byHash[strings.ToLower(e.value)] = e
+	}
+	return k, nil
+}
+
+func (k *apiKeys) authenticate(r *http.Request) (Principal, bool, error) {
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		return Principal{}, false, nil
+	}
+	sum := sha256.Sum256([]byte(key))
+	e, ok := k.byHash[hex.EncodeToString(sum[:])]
+	if !ok {
+		return Principal{}, true, errBadCredentials
+	}
+	return Principal{Subject: e.name, Role: e.role, Method: "apikey"}, true, nil
+}
+
+// body of a signed request is read into memory up to this size,
+// routes that take larger bodies raise it with RequireBody
+const maxSignedBody = 1 << 20
+
+// X-Nonce length limits
+const (
+	minNonce = 8
+	maxNonce = 128
+)
+
+// requests signed with a shared secret:
+// X-Key-ID, X-Timestamp (unix seconds), X-Nonce (unique per request) and X-Signature,
+// the hex HMAC-SHA256 of "METHOD\nREQUEST_URI\nTIMESTAMP\nNONCE\nhex(sha256(body))"
+type hmacKeys struct {
+	byID   map[string]keyEntry
+	skew   time.Duration
+	now    func() time.Time
+	nonces *nonceCache
+}
+
+func loadHMACKeys(path string, skew time.Duration) (*hmacKeys, error) {
+	entries, err := readKeyFile(path)
+	if err != nil {
+		return nil, err
+	}
+	k := &hmacKeys{byID: make(map[string]keyEntry, len(entries)), skew: skew, now: time.Now, nonces: newNonceCache()}
+	for _, e := range entries {
+		k.byID[e.name] = e
+	}
+	return k, nil
+}
+
+func (k *hmacKeys) authenticate(r *http.Request) (Principal, bool, error) {
+	id := r.Header.Get("X-Key-ID")
+	if id == "" {
+		return Principal{}, false, nil
+	}
+	e, ok := k.byID[id]
+	if !ok {
+		return Principal{}, true, errBadCredentials
+	}
+	ts, err := strconv.ParseInt(r.Header.Get("X-Timestamp"), 10, 64)
+	if err != nil {
+		return Principal{}, true, errors.New("invalid X-Timestamp")
+	}
+	now := k.now()
+	if d := now.Sub(time.Unix(ts, 0)); d > k.skew || d < -k.skew {
+		return Principal{}, true, errors.New("request timestamp out of range")
+	}
+	nonce := r.Header.Get("X-Nonce")
+	if len(nonce) < minNonce || len(nonce) > maxNonce {
+		return Principal{}, true, errors.New("invalid X-Nonce")
+	}
+	sig, err := hex.DecodeString(r.Header.Get("X-Signature"))
+	if err != nil {
+		return Principal{}, true, errBadCredentials
+	}
+	// a replay is refused before its body is buffered, add below still decides races
+	if k.nonces.seen(id+"\n"+nonce, now) {
+		return Principal{}, true, errors.New("nonce already used")
+	}
+
+	// one byte over the limit tells a large body from a truncated one,
+	// the handler still needs the body
+	limit := signedBodyLimit(r.Context())
+	body, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		return Principal{}, true, err
+	}
+	if int64(len(body)) > limit {
+		return Principal{}, true, ErrBodyTooLarge
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	if !hmac.Equal(sig, Sign(e.value, r.Method, r.URL.RequestURI(), ts, nonce, body)) {
+		return Principal{}, true, errBadCredentials
+	}
+	// remembered only for valid signatures, so strangers cannot burn nonces;
+	// past skew the timestamp check rejects the request anyway
+	if !k.nonces.add(id+"\n"+nonce, time.Unix(ts, 0).Add(k.skew), now) {
+		return Principal{}, true, errors.New("nonce already used")
+	}
+	return Principal{Subject: e.name, Role: e.role, Method: "hmac"}, true, nil
+}
+
+// signature of a request, for clients and tests
+func Sign(secret, method, requestURI string, ts int64, nonce string, body []byte) []byte {
+	bodySum := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%s\n%d\n%s\n%s", method, requestURI, ts, nonce, hex.EncodeToString(bodySum[:]))
+	return mac.Sum(nil)
+}
+
+// nonces seen within the skew window, kept in memory of this instance
+type nonceCache struct {
+	mu      sync.Mutex
+	expires map[string]time.Time
+	sweep   time.Time // next time expired entries are dropped
+}
+
+func newNonceCache() *nonceCache {
+	return &nonceCache{expires: make(map[string]time.Time)}
+}
+
+// true when the nonce is known and not expired, nothing is stored
+func (c *nonceCache) seen(nonce string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	exp, ok := c.expires[nonce]
+	return ok && !now.After(exp)
+}
+
+// false when the nonce is already known and not expired
+func (c *nonceCache) add(nonce string, expires, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.After(c.sweep) {
+		for n, exp := range c.expires {
+			if now.After(exp) {
+				delete(c.expires, n)
+			}
+		}
+		c.sweep = now.Add(time.Minute)
+	}
+	if exp, ok := c.expires[nonce]; ok && !now.After(exp) {
+		return false
+	}
+	c.expires[nonce] = expires
+	return true
+}
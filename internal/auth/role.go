@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+)
+
+// access level, each role includes the ones below it
+type Role int
+
+const (
+	RoleViewer  Role = iota + 1 // reads orders
+	RoleSupport                 // also submits orders and sees more of the customer data
+	RoleAdmin                   // also admin endpoints, metrics and docs
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleViewer:
+		return "viewer"
+	case RoleSupport:
+		return "support"
+	case RoleAdmin:
+		return "admin"
+	}
+	return fmt.Sprintf("role(%d)", int(r))
+}
+
+func ParseRole(s string) (Role, error) {
+	switch s {
+	case "viewer":
+		return RoleViewer, nil
+	case "support":
+		return RoleSupport, nil
+	case "admin":
+		return RoleAdmin, nil
+	}
+	return 0, fmt.Errorf("unknown role %q", s)
+}
+
+// authenticated caller
+type Principal struct {
+	Subject string // key name, HMAC key id or JWT sub
+	Role    Role
+	Method  string // apikey, hmac, jwt or none when auth is disabled
+}
+
+type ctxKey struct{}
+
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, ctxKey{}, p)
+}
+
+// caller of the request, false outside of Require
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(ctxKey{}).(Principal)
+	return p, ok
+}
+
+// role the response is shaped for, requests that bypassed Require get the lowest one
+func CallerRole(ctx context.Context) Role {
+	if p, ok := FromContext(ctx); ok {
+		return p.Role
+	}
+	return RoleViewer
+}
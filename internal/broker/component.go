@@ -0,0 +1,49 @@
+package broker
+
+import (
+	"context"
+
+	"github.com/beganov/L0/internal/cache"
+	"github.com/beganov/L0/internal/config"
+	"github.com/beganov/L0/internal/events"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// order consumer as supervised component
+type Consumer struct {
+	cfg     *config.Holder
+	src     Source
+	db      *pgxpool.Pool
+	cache   *cache.OrderCache
+	l2      *cache.RedisCache
+	control *Control
+	hub     *events.Hub
+}
+
+// constructor, src is closed by the caller after the consumer stopped
+func NewConsumer(cfg *config.Holder, src Source, db *pgxpool.Pool, cache *cache.OrderCache, l2 *cache.RedisCache, control *Control, hub *events.Hub) *Consumer {
+	return &Consumer{cfg: cfg, src: src, db: db, cache: cache, l2: l2, control: control, hub: hub}
+}
+
+func (c *Consumer) Name() string {
+	return "consumer"
+}
+
+// consume until ctx is cancelled, in-flight message is finished first
+func (c *Consumer) Start(ctx context.Context) error {
+	return Consume(ctx, c.cfg, c.src, c.db, c.cache, c.l2, c.control, c.hub)
+}
+
+// fetching stops on context cancel done by supervisor, nothing else to do
+func (c *Consumer) Stop(ctx context.Context) error {
+	return nil
+}
+
+// consumer is healthy while its broker is reachable
+func (c *Consumer) Health(ctx context.Context) error {
+	if p, ok := c.src.(pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
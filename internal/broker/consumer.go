@@ -4,92 +4,154 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"time"
 
 	"github.com/beganov/L0/internal/cache"
 	"github.com/beganov/L0/internal/config"
 	"github.com/beganov/L0/internal/database"
+	"github.com/beganov/L0/internal/events"
 	"github.com/beganov/L0/internal/logger"
 	"github.com/beganov/L0/internal/metrics"
 	"github.com/beganov/L0/internal/models"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/segmentio/kafka-go"
 )
 
-func ConsumeKafka(ctx context.Context, reader *kafka.Reader, db *pgxpool.Pool, cache *cache.OrderCache) {
-	logger.Info("Kafka consumer started")
+// read orders from src until ctx is done, nil means clean stop.
+// error is returned when the source breaks and the consumer cannot go on
+func Consume(ctx context.Context, holder *config.Holder, src Source, db *pgxpool.Pool, cache *cache.OrderCache, l2 *cache.RedisCache, control *Control, hub *events.Hub) error {
+	logger.Info("Consumer started")
+	if ks, ok := src.(*KafkaSource); ok {
+		control.watchGroup(ks)
+	}
 
 	for {
 		select {
 		case <-ctx.Done():
-			logger.Info("Kafka consumer stopped")
-			return
+			logger.Info("Consumer stopped")
+			return nil
 		default:
+			// paused by admin, nothing is fetched until resume
+			if err := control.wait(ctx); err != nil {
+				logger.Info("Consumer stopped")
+				return nil
+			}
+
 			timer := prometheus.NewTimer(metrics.KafkaProcessDuration)
+			cfg := holder.Get() // timeouts may change on reload
 
-			// read one message from Kafka
-			kfkCtx, cancel := context.WithTimeout(ctx, config.KafkaTimeOut)
-			msg, err := reader.FetchMessage(kfkCtx)
+			// read one message
+			fetchCtx, cancel := context.WithTimeout(ctx, fetchTimeout(cfg))
+			msg, err := src.Fetch(fetchCtx)
 			metrics.KafkaMessagesTotal.Inc()
 			cancel()
 
 			if err != nil {
+				timer.ObserveDuration()
+				if ctx.Err() != nil {
+					logger.Info("Consumer stopped")
+					return nil
+				}
 				metrics.KafkaErrorsTotal.Inc()
-				if errors.Is(err, context.Canceled) {
-					timer.ObserveDuration()
-					return
+				// canceled without stop request or closed source is not recoverable here
+				if errors.Is(err, context.Canceled) || errors.Is(err, ErrSourceClosed) {
+					return err
 				}
 				logger.Error(err, "failed to read message")
-				timer.ObserveDuration()
 				continue
 			}
 
-			var order models.Order
-			// parse message
-			if err := json.Unmarshal(msg.Value, &order); err != nil {
-				metrics.KafkaErrorsTotal.Inc()
-				logger.Error(err, "json parse failed")
-				commitMessage(ctx, reader, msg)
-				timer.ObserveDuration()
-				continue
-			}
+			control.observe(msg)
 
-			// validate order
-			if err := order.Validate(); err != nil {
-				metrics.KafkaErrorsTotal.Inc()
-				logger.Error(err, "order invalid")
-				commitMessage(ctx, reader, msg)
+			// fetched message is finished even if stop was requested meanwhile,
+			// SaveOrder and ack are bounded by their own timeouts
+			procCtx := context.WithoutCancel(ctx)
+			metrics.KafkaInFlight.Set(1)
+
+			// parse and validate, broken messages are skipped
+			order, ok := decodeOrder(msg.Value)
+			if !ok {
+				ackMessage(procCtx, src, msg, fetchTimeout(cfg))
+				metrics.KafkaInFlight.Set(0)
 				timer.ObserveDuration()
 				continue
 			}
 
-			// save to db
-			if err := database.SaveOrder(ctx, db, order); err != nil {
+			// save to db, message is delivered again on failure
+			inserted, err := database.SaveNewOrder(procCtx, db, order, cfg.Postgres.InsertTimeout)
+			if err != nil {
 				metrics.KafkaErrorsTotal.Inc()
 				logger.Error(err, "db save failed")
+				nackMessage(procCtx, src, msg, fetchTimeout(cfg))
+				metrics.KafkaInFlight.Set(0)
 				timer.ObserveDuration()
+				// DB is likely down, the next fetch would only fail the same way
+				select {
+				case <-ctx.Done():
+				case <-time.After(retryDelay):
+				}
 				continue
 			}
 
-			// commit offset
-			if err := reader.CommitMessages(ctx, msg); err != nil {
-				metrics.KafkaErrorsTotal.Inc()
-				logger.Error(err, "commit failed")
-			}
+			ackMessage(procCtx, src, msg, fetchTimeout(cfg))
 
 			// update cache
 			cache.Set(order.OrderUID, order)
+			if err := l2.Set(procCtx, order); err != nil {
+				logger.Error(err, "L2 cache set failed")
+			}
+			// redelivered duplicates are not announced again
+			if inserted {
+				hub.Publish(order)
+			}
+			metrics.KafkaInFlight.Set(0)
 			timer.ObserveDuration()
 			logger.Info("order received", "orderID", order.OrderUID)
 		}
 	}
 }
 
-// helper for committing messages with logging
-func commitMessage(ctx context.Context, reader *kafka.Reader, msg kafka.Message) {
-	if err := reader.CommitMessages(ctx, msg); err != nil {
+// fetch and ack timeout of the configured broker
+func fetchTimeout(cfg *config.Config) time.Duration {
+	if cfg.Broker.Type == config.BrokerNATS {
+		return cfg.NATS.Timeout
+	}
+	return cfg.Kafka.Timeout
+}
+
+// parse and validate message value, failures are logged and counted
+func decodeOrder(value []byte) (models.Order, bool) {
+	var order models.Order
+	if err := json.Unmarshal(value, &order); err != nil {
+		metrics.KafkaErrorsTotal.Inc()
+		logger.Error(err, "json parse failed")
+		return order, false
+	}
+	if err := order.Validate(); err != nil {
+		metrics.KafkaErrorsTotal.Inc()
+		logger.Error(err, "order invalid")
+		logger.Debug("invalid order", "order", order) // personal data is masked by logger
+		return order, false
+	}
+	return order, true
+}
+
+// helpers for acking messages with logging
+func ackMessage(ctx context.Context, src Source, msg Message, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if err := src.Ack(ctx, msg); err != nil {
+		metrics.KafkaErrorsTotal.Inc()
+		logger.Error(err, "ack failed")
+	}
+}
+
+func nackMessage(ctx context.Context, src Source, msg Message, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if err := src.Nack(ctx, msg); err != nil {
 		metrics.KafkaErrorsTotal.Inc()
-		logger.Error(err, "commit failed")
+		logger.Error(err, "nack failed")
 	}
 }
@@ -0,0 +1,208 @@
+package broker
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/beganov/L0/internal/metrics"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// how often partition gauges are refreshed
+const StatsInterval = 5 * time.Second
+
+// position and speed of the consumer in one partition
+type PartitionStats struct {
+	Topic     string  `json:"topic"`
+	Partition int     `json:"partition"`
+	Offset    int64   `json:"offset"`
+	Lag       int64   `json:"lag"`
+	Rate      float64 `json:"messages_per_sec"`
+}
+
+// consumer state for admin API and health report
+type ControlReport struct {
+	Paused     bool             `json:"paused"`
+	Partitions []PartitionStats `json:"partitions"`
+}
+
+type partitionState struct {
+	stats  PartitionStats
+	reader readerStats // own partition reader, nil when fed from messages
+	count  int64       // messages since previous sample
+}
+
+type readerStats interface {
+	Stats() kafka.ReaderStats
+}
+
+// pause switch and partition stats shared by consumer restarts and admin API
+type Control struct {
+	mu     sync.Mutex
+	paused bool
+	resume chan struct{} // closed on resume
+	parts  map[int]*partitionState
+	group  readerStats // group reader, rebalance drops observed partitions
+}
+
+// constructor
+func NewControl() *Control {
+	return &Control{parts: make(map[int]*partitionState)}
+}
+
+// stop fetching after the in-flight message, false if already paused
+func (c *Control) Pause() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.paused {
+		return false
+	}
+	c.paused = true
+	c.resume = make(chan struct{})
+	metrics.KafkaConsumerPaused.Set(1)
+	return true
+}
+
+// continue fetching, false if not paused
+func (c *Control) Resume() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.paused {
+		return false
+	}
+	c.paused = false
+	close(c.resume)
+	metrics.KafkaConsumerPaused.Set(0)
+	return true
+}
+
+func (c *Control) Paused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.paused
+}
+
+// block while paused, error when ctx is done first
+func (c *Control) wait(ctx context.Context) error {
+	c.mu.Lock()
+	if !c.paused {
+		c.mu.Unlock()
+		return nil
+	}
+	resume := c.resume
+	c.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-resume:
+		return nil
+	}
+}
+
+// partition reader got assigned, its Stats feed the gauges
+func (c *Control) assign(topic string, partition int, r readerStats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.parts[partition] = &partitionState{stats: PartitionStats{Topic: topic, Partition: partition}, reader: r}
+}
+
+// partition taken away, its gauges are removed
+func (c *Control) release(partition int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.drop(partition)
+}
+
+// group reader reports stats of all partitions at once (partition -1),
+// so in that mode partitions are tracked from fetched messages
+func (c *Control) watchGroup(r readerStats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.group = r
+}
+
+func (c *Control) observe(msg Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p, ok := c.parts[msg.Partition]
+	if !ok {
+		p = &partitionState{stats: PartitionStats{Topic: msg.Topic, Partition: msg.Partition}}
+		c.parts[msg.Partition] = p
+	}
+	p.stats.Offset = msg.Offset
+	p.stats.Lag = msg.Lag
+	p.count++
+}
+
+// refresh gauges every interval until ctx is done
+func (c *Control) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.sample(interval)
+		}
+	}
+}
+
+func (c *Control) sample(interval time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Stats resets counters, this is the only place that reads them
+	if c.group != nil && c.group.Stats().Rebalances > 0 {
+		for id := range c.parts {
+			c.drop(id)
+		}
+	}
+
+	for _, p := range c.parts {
+		if p.reader != nil {
+			st := p.reader.Stats()
+			p.stats.Offset, p.stats.Lag, p.count = st.Offset, st.Lag, st.Messages
+		}
+		p.stats.Rate = float64(p.count) / interval.Seconds()
+		p.count = 0
+
+		topic, part := p.stats.Topic, strconv.Itoa(p.stats.Partition)
+		metrics.KafkaPartitionLag.WithLabelValues(topic, part).Set(float64(p.stats.Lag))
+		metrics.KafkaPartitionOffset.WithLabelValues(topic, part).Set(float64(p.stats.Offset))
+		metrics.KafkaPartitionRate.WithLabelValues(topic, part).Set(p.stats.Rate)
+	}
+}
+
+func (c *Control) drop(partition int) {
+	p, ok := c.parts[partition]
+	if !ok {
+		return
+	}
+	delete(c.parts, partition)
+
+	topic, part := p.stats.Topic, strconv.Itoa(partition)
+	metrics.KafkaPartitionLag.DeleteLabelValues(topic, part)
+	metrics.KafkaPartitionOffset.DeleteLabelValues(topic, part)
+	metrics.KafkaPartitionRate.DeleteLabelValues(topic, part)
+}
+
+// pause state and current assignment as of the last sample, ordered by partition
+func (c *Control) Report() ControlReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	r := ControlReport{Paused: c.paused, Partitions: make([]PartitionStats, 0, len(c.parts))}
+	for _, p := range c.parts {
+		r.Partitions = append(r.Partitions, p.stats)
+	}
+	sort.Slice(r.Partitions, func(i, j int) bool { return r.Partitions[i].Partition < r.Partitions[j].Partition })
+	return r
+}
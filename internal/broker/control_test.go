@@ -0,0 +1,58 @@
+package broker
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// --- Тест паузы: wait блокируется до resume ---
+func TestControl_PauseResume(t *testing.T) {
+	c := NewControl()
+	if err := c.wait(context.Background()); err != nil {
+		t.Fatalf("not paused, wait must return at once: %v", err)
+	}
+
+	if !c.Pause() || c.Pause() {
+		t.Fatal("first Pause must change state, second must not")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := c.wait(ctx); err == nil {
+		t.Fatal("wait must block while paused")
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- c.wait(context.Background()) }()
+	c.Resume()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("wait did not return after Resume")
+	}
+}
+
+// --- Тест статистики партиций по прочитанным сообщениям ---
+func TestControl_Observe(t *testing.T) {
+	c := NewControl()
+	c.observe(Message{Topic: "orders", Partition: 1, Offset: 5, Lag: 4})
+	c.observe(Message{Topic: "orders", Partition: 0, Offset: 2, Lag: 0})
+	c.observe(Message{Topic: "orders", Partition: 1, Offset: 6, Lag: 3})
+	c.sample(time.Second)
+
+	r := c.Report()
+	if len(r.Partitions) != 2 || r.Partitions[0].Partition != 0 {
+		t.Fatalf("expected partitions 0 and 1 in order, got %+v", r.Partitions)
+	}
+	p := r.Partitions[1]
+	if p.Offset != 6 || p.Lag != 3 || p.Rate != 2 {
+		t.Errorf("unexpected stats for partition 1: %+v", p)
+	}
+	if r.Partitions[0].Lag != 0 {
+		t.Errorf("caught up partition must have zero lag, got %d", r.Partitions[0].Lag)
+	}
+}
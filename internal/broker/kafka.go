@@ -0,0 +1,228 @@
+package broker
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/beganov/L0/internal/config"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// connection and fetch settings shared by every reader, group and dial of the service
+type Kafka struct {
+	cfg    config.KafkaConfig
+	dialer *kafka.Dialer
+
+	pingMu  sync.Mutex
+	pingAt  time.Time
+	pingErr error
+}
+
+// constructor, fails on unreadable certificates or bad SASL settings
+func NewKafka(cfg config.KafkaConfig) (*Kafka, error) {
+	dialer := &kafka.Dialer{
+		Timeout:   10 * time.Second,
+		DualStack: true,
+		ClientID:  cfg.ClientID,
+	}
+
+	if cfg.TLS.Enabled {
+		t, err := tlsConfig(cfg.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("kafka tls: %w", err)
+		}
+		dialer.TLS = t
+	}
+	if cfg.SASL.Mechanism != "" {
+		m, err := saslMechanism(cfg.SASL)
+		if err != nil {
+			return nil, fmt.Errorf("kafka sasl: %w", err)
+		}
+		dialer.SASLMechanism = m
+	}
+	return &Kafka{cfg: cfg, dialer: dialer}, nil
+}
+
+func tlsConfig(c config.KafkaTLSConfig) (*tls.Config, error) {
+	t := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", c.CAFile)
+		}
+		t.RootCAs = pool
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		t.Certificates = []tls.Certificate{cert}
+	}
+	return t, nil
+}
+
+func saslMechanism(c config.KafkaSASLConfig) (sasl.Mechanism, error) {
+	switch c.Mechanism {
+	case config.SASLPlain:
+		return plain.Mechanism{Username: c.Username, Password: c.Password}, nil
+	case config.SASLScramSHA256:
+		return scram.Mechanism(scram.SHA256, c.Username, c.Password)
+	case config.SASLScramSHA512:
+		return scram.Mechanism(scram.SHA512, c.Username, c.Password)
+	default:
+		return nil, fmt.Errorf("unknown mechanism %q", c.Mechanism)
+	}
+}
+
+func (k *Kafka) startOffset() int64 {
+	if k.cfg.StartOffset == "last" {
+		return kafka.LastOffset
+	}
+	return kafka.FirstOffset
+}
+
+func (k *Kafka) balancers() []kafka.GroupBalancer {
+	switch k.cfg.Rebalance {
+	case config.RebalanceRoundRobin:
+		return []kafka.GroupBalancer{kafka.RoundRobinGroupBalancer{}}
+	case config.RebalanceRackAffinity:
+		return []kafka.GroupBalancer{kafka.RackAffinityGroupBalancer{Rack: k.cfg.Rack}}
+	default:
+		return []kafka.GroupBalancer{kafka.RangeGroupBalancer{}}
+	}
+}
+
+// reader of the service consumer group
+func (k *Kafka) GroupReader() *kafka.Reader {
+	return kafka.NewReader(kafka.ReaderConfig{
+		Brokers:        k.cfg.Brokers,
+		Topic:          k.cfg.Topic,
+		GroupID:        k.cfg.GroupID,
+		Dialer:         k.dialer,
+		MinBytes:       k.cfg.MinBytes,
+		MaxBytes:       k.cfg.MaxBytes,
+		MaxWait:        k.cfg.MaxWait,
+		StartOffset:    k.startOffset(),
+		GroupBalancers: k.balancers(),
+	})
+}
+
+// health probes hit every broker, a slow one would otherwise be dialed on every probe
+const pingCacheTTL = 2 * time.Second
+
+// writers flush a partition batch after this long. kafka-go waits a second by default,
+// which every synchronous publish of a few messages would pay in full
+const writerBatchTimeout = 5 * time.Millisecond
+
+// writer to the topic, key decides the partition
+func (k *Kafka) Writer() *kafka.Writer {
+	return &kafka.Writer{
+		Addr:         kafka.TCP(k.cfg.Brokers...),
+		Topic:        k.cfg.Topic,
+		Balancer:     &kafka.Hash{},
+		BatchTimeout: writerBatchTimeout,
+		Transport: &kafka.Transport{
+			ClientID: k.cfg.ClientID,
+			TLS:      k.dialer.TLS,
+			SASL:     k.dialer.SASLMechanism,
+		},
+		RequiredAcks: kafka.RequireAll,
+	}
+}
+
+// reader of one partition outside of any group, position is set by caller
+func (k *Kafka) PartitionReader(partition int) *kafka.Reader {
+	return kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   k.cfg.Brokers,
+		Topic:     k.cfg.Topic,
+		Partition: partition,
+		Dialer:    k.dialer,
+		MinBytes:  k.cfg.MinBytes,
+		MaxBytes:  k.cfg.MaxBytes,
+		MaxWait:   k.cfg.MaxWait,
+	})
+}
+
+// consumer group on the topic that only assigns partitions
+func (k *Kafka) ConsumerGroup(id string) (*kafka.ConsumerGroup, error) {
+	return kafka.NewConsumerGroup(kafka.ConsumerGroupConfig{
+		ID:             id,
+		Brokers:        k.cfg.Brokers,
+		Dialer:         k.dialer,
+		Topics:         []string{k.cfg.Topic},
+		GroupBalancers: k.balancers(),
+		StartOffset:    k.startOffset(),
+	})
+}
+
+// connection to the leader of a topic partition, first broker that answers wins
+func (k *Kafka) DialLeader(ctx context.Context, partition int) (*kafka.Conn, error) {
+	var errs []error
+	for _, b := range k.cfg.Brokers {
+		conn, err := k.dialer.DialLeader(ctx, "tcp", b, k.cfg.Topic, partition)
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// any broker that knows the topic is enough; probes in a row share one result for pingCacheTTL
+func (k *Kafka) Ping(ctx context.Context) error {
+	k.pingMu.Lock()
+	defer k.pingMu.Unlock()
+	if !k.pingAt.IsZero() && time.Since(k.pingAt) < pingCacheTTL {
+		return k.pingErr
+	}
+	err := k.ping(ctx)
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return err // the caller went away, the broker state is unknown
+	}
+	k.pingAt, k.pingErr = time.Now(), err
+	return err
+}
+
+func (k *Kafka) ping(ctx context.Context) error {
+	// the dial honours ctx, reads on the connection only a deadline
+	deadline := time.Now().Add(k.dialer.Timeout)
+	if d, ok := ctx.Deadline(); ok {
+		deadline = d
+	}
+	var errs []error
+	for _, b := range k.cfg.Brokers {
+		conn, err := k.dialer.DialContext(ctx, "tcp", b)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		conn.SetDeadline(deadline)
+		_, err = conn.ReadPartitions(k.cfg.Topic)
+		conn.Close()
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,98 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Source over a Kafka group reader, offsets are committed on ack
+type KafkaSource struct {
+	kafka  *Kafka
+	reader groupReader
+
+	mu    sync.Mutex
+	retry *kafka.Message // nacked message, handed out again before the reader goes on
+}
+
+// what the source needs from a group reader
+type groupReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Stats() kafka.ReaderStats
+	Close() error
+}
+
+// constructor, source owns its group reader
+func NewKafkaSource(kc *Kafka) *KafkaSource {
+	return &KafkaSource{kafka: kc, reader: kc.GroupReader()}
+}
+
+func (s *KafkaSource) Fetch(ctx context.Context) (Message, error) {
+	s.mu.Lock()
+	retry := s.retry
+	s.retry = nil
+	s.mu.Unlock()
+	if retry != nil {
+		return kafkaMessage(*retry), nil
+	}
+
+	msg, err := s.reader.FetchMessage(ctx)
+	if err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrClosedPipe) {
+			return Message{}, ErrSourceClosed
+		}
+		return Message{}, err
+	}
+	return kafkaMessage(msg), nil
+}
+
+func kafkaMessage(msg kafka.Message) Message {
+	var headers map[string]string
+	for _, h := range msg.Headers {
+		if headers == nil {
+			headers = make(map[string]string, len(msg.Headers))
+		}
+		headers[h.Key] = string(h.Value)
+	}
+	return Message{
+		Key:       msg.Key,
+		Value:     msg.Value,
+		Headers:   headers,
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Lag:       max(msg.HighWaterMark-msg.Offset-1, 0),
+		Time:      msg.Time,
+		raw:       msg,
+	}
+}
+
+func (s *KafkaSource) Ack(ctx context.Context, msg Message) error {
+	return s.reader.CommitMessages(ctx, msg.raw.(kafka.Message))
+}
+
+// group reader cannot seek, the message is kept and fetched again before
+// anything later, so no later commit can skip it and the group is not rejoined
+func (s *KafkaSource) Nack(ctx context.Context, msg Message) error {
+	raw := msg.raw.(kafka.Message)
+	s.mu.Lock()
+	s.retry = &raw
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *KafkaSource) Close() error {
+	return s.reader.Close()
+}
+
+func (s *KafkaSource) Stats() kafka.ReaderStats {
+	return s.reader.Stats()
+}
+
+func (s *KafkaSource) Ping(ctx context.Context) error {
+	return s.kafka.Ping(ctx)
+}
@@ -0,0 +1,174 @@
+package broker
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/beganov/L0/internal/config"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// --- Тест настроек SASL и TLS ---
+func TestNewKafka_Security(t *testing.T) {
+	cfg := config.Default().Kafka
+	cfg.SASL = config.KafkaSASLConfig{Mechanism: config.SASLScramSHA512, Username: "svc", Password: "secret"}
+	cfg.TLS = config.KafkaTLSConfig{Enabled: true, ServerName: "kafka.internal"}
+
+	kc, err := NewKafka(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if kc.dialer.SASLMechanism == nil || kc.dialer.SASLMechanism.Name() != "SCRAM-SHA-512" {
+		t.Errorf("expected SCRAM-SHA-512, got %v", kc.dialer.SASLMechanism)
+	}
+	if kc.dialer.TLS == nil || kc.dialer.TLS.ServerName != "kafka.internal" {
+		t.Errorf("TLS config not applied: %+v", kc.dialer.TLS)
+	}
+
+	// файл CA без сертификатов
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(ca, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg.TLS.CAFile = ca
+	if _, err := NewKafka(cfg); err == nil {
+		t.Error("expected error for CA file without certificates")
+	}
+}
+
+// --- Тест записи: синхронная публикация не ждёт секундного накопления пакета ---
+func TestKafka_WriterBatchTimeout(t *testing.T) {
+	kc, err := NewKafka(config.Default().Kafka)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := kc.Writer(); w.BatchTimeout <= 0 || w.BatchTimeout > 10*time.Millisecond {
+		t.Errorf("unexpected batch timeout %v", w.BatchTimeout)
+	}
+}
+
+// --- Тест Ping: зависший брокер не держит пробу дольше её дедлайна, результат кешируется ---
+func TestKafka_PingDeadline(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	var mu sync.Mutex
+	var conns []net.Conn
+	go func() {
+		for {
+			c, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, c) // accepted and never answered
+			mu.Unlock()
+		}
+	}()
+	t.Cleanup(func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, c := range conns {
+			c.Close()
+		}
+	})
+
+	cfg := config.Default().Kafka
+	cfg.Brokers = []string{lis.Addr().String()}
+	kc, err := NewKafka(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := kc.Ping(ctx); err == nil {
+		t.Fatal("ping of a silent broker succeeded")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("ping took %v", d)
+	}
+
+	mu.Lock()
+	dialed := len(conns)
+	mu.Unlock()
+	if err := kc.Ping(context.Background()); err == nil {
+		t.Error("cached failure expected")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(conns) != dialed {
+		t.Errorf("second ping dialed again: %d -> %d connections", dialed, len(conns))
+	}
+}
+
+// партиция группы в памяти, читатель запоминает коммиты
+type fakeGroupReader struct {
+	log       []kafka.Message
+	pos       int64
+	committed int64 // next offset to read
+	closed    bool
+}
+
+func (r *fakeGroupReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	if r.closed {
+		return kafka.Message{}, io.EOF
+	}
+	if r.pos >= int64(len(r.log)) {
+		<-ctx.Done()
+		return kafka.Message{}, ctx.Err()
+	}
+	r.pos++
+	return r.log[r.pos-1], nil
+}
+
+func (r *fakeGroupReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	for _, m := range msgs {
+		r.committed = m.Offset + 1
+	}
+	return nil
+}
+
+func (r *fakeGroupReader) Stats() kafka.ReaderStats { return kafka.ReaderStats{} }
+func (r *fakeGroupReader) Close() error             { r.closed = true; return nil }
+
+// --- Тест повторной доставки: заказ, который не удалось сохранить, не теряется ---
+func TestKafkaSource_NackRedelivers(t *testing.T) {
+	r := &fakeGroupReader{log: []kafka.Message{{Offset: 0, Value: []byte("a")}, {Offset: 1, Value: []byte("b")}}}
+	src := &KafkaSource{reader: r}
+	ctx := context.Background()
+
+	// save of "a" failed
+	msg, err := src.Fetch(ctx)
+	if err != nil || string(msg.Value) != "a" {
+		t.Fatalf("first fetch: %q %v", msg.Value, err)
+	}
+	if err := src.Nack(ctx, msg); err != nil {
+		t.Fatal(err)
+	}
+
+	// "a" comes again before "b", so acking "b" cannot skip it
+	for _, want := range []string{"a", "b"} {
+		msg, err := src.Fetch(ctx)
+		if err != nil || string(msg.Value) != want {
+			t.Fatalf("expected %q, got %q %v", want, msg.Value, err)
+		}
+		if err := src.Ack(ctx, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// same reader all along, the group is not rejoined
+	if r.committed != 2 || r.closed {
+		t.Errorf("committed %d, reader closed %v", r.committed, r.closed)
+	}
+}
@@ -0,0 +1,112 @@
+package broker
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// in-process broker for tests and local runs, both Source and Sink, nothing survives a restart.
+// nacked messages go back to the head of the queue
+type MemoryBroker struct {
+	topic string
+
+	mu     sync.Mutex
+	queue  []Message
+	next   int64         // offset of the next published message
+	ready  chan struct{} // signalled when queue gets a message
+	acked  int
+	closed bool
+}
+
+// constructor
+func NewMemoryBroker(topic string) *MemoryBroker {
+	return &MemoryBroker{topic: topic, ready: make(chan struct{}, 1)}
+}
+
+// enqueue messages, fails after Close
+func (b *MemoryBroker) Publish(ctx context.Context, msgs ...Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrSourceClosed
+	}
+	for _, m := range msgs {
+		b.queue = append(b.queue, Message{Key: m.Key, Value: m.Value, Headers: m.Headers, Topic: b.topic, Offset: b.next, Time: time.Now()})
+		b.next++
+	}
+	b.signal()
+	return nil
+}
+
+// wake up a waiting Fetch, caller holds mu
+func (b *MemoryBroker) signal() {
+	select {
+	case b.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (b *MemoryBroker) Fetch(ctx context.Context) (Message, error) {
+	for {
+		b.mu.Lock()
+		if b.closed {
+			b.mu.Unlock()
+			return Message{}, ErrSourceClosed
+		}
+		if len(b.queue) > 0 {
+			msg := b.queue[0]
+			b.queue = b.queue[1:]
+			msg.Lag = int64(len(b.queue))
+			if len(b.queue) > 0 {
+				b.signal()
+			}
+			b.mu.Unlock()
+			return msg, nil
+		}
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return Message{}, ctx.Err()
+		case <-b.ready:
+		}
+	}
+}
+
+func (b *MemoryBroker) Ack(ctx context.Context, msg Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.acked++
+	return nil
+}
+
+func (b *MemoryBroker) Nack(ctx context.Context, msg Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrSourceClosed
+	}
+	b.queue = append([]Message{msg}, b.queue...)
+	b.signal()
+	return nil
+}
+
+// number of acked messages
+func (b *MemoryBroker) Acked() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.acked
+}
+
+// pending messages are dropped, Fetch returns ErrSourceClosed
+func (b *MemoryBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.closed {
+		b.closed = true
+		b.queue = nil
+		close(b.ready)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// --- Тест in-memory брокера: порядок, повторная доставка после nack, закрытие ---
+func TestMemoryBroker_FetchNackClose(t *testing.T) {
+	b := NewMemoryBroker("orders")
+	ctx := context.Background()
+	b.Publish(ctx, Message{Key: []byte("a"), Value: []byte("1")}, Message{Key: []byte("b"), Value: []byte("2")})
+
+	first, err := b.Fetch(ctx)
+	if err != nil || string(first.Key) != "a" || first.Offset != 0 || first.Lag != 1 {
+		t.Fatalf("unexpected first message %+v, err %v", first, err)
+	}
+
+	if err := b.Nack(ctx, first); err != nil {
+		t.Fatalf("nack failed: %v", err)
+	}
+	again, _ := b.Fetch(ctx)
+	if string(again.Key) != "a" {
+		t.Fatalf("nacked message must come first, got %q", again.Key)
+	}
+	b.Ack(ctx, again)
+	second, _ := b.Fetch(ctx)
+	b.Ack(ctx, second)
+	if string(second.Key) != "b" || b.Acked() != 2 {
+		t.Fatalf("unexpected second message %+v, acked %d", second, b.Acked())
+	}
+
+	timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := b.Fetch(timeout); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("empty broker must block until deadline, got %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := b.Fetch(ctx)
+		done <- err
+	}()
+	b.Close()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrSourceClosed) {
+			t.Fatalf("expected ErrSourceClosed, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Fetch did not return after Close")
+	}
+	if b.Publish(ctx, Message{Value: []byte("3")}) == nil {
+		t.Error("publish after Close must fail")
+	}
+}
@@ -0,0 +1,144 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/beganov/L0/internal/config"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// Source over a durable JetStream pull consumer with explicit acks
+type NATSSource struct {
+	conn     *nats.Conn
+	stream   jetstream.Stream
+	consumer jetstream.Consumer
+}
+
+// connect and bind durable consumer, stream is created when missing
+func NewNATSSource(ctx context.Context, cfg config.NATSConfig) (*NATSSource, error) {
+	nc, stream, err := connectNATS(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	consumer, err := stream.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{
+		Durable:       cfg.Durable,
+		FilterSubject: cfg.Subject,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       cfg.AckWait,
+	})
+	if err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("nats consumer %s: %w", cfg.Durable, err)
+	}
+	return &NATSSource{conn: nc, stream: stream, consumer: consumer}, nil
+}
+
+// connection and order stream, shared by source and sink
+func connectNATS(ctx context.Context, cfg config.NATSConfig) (*nats.Conn, jetstream.Stream, error) {
+	nc, err := nats.Connect(cfg.URL, nats.Name("L0-service"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, nil, fmt.Errorf("nats connect: %w", err)
+	}
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		return nil, nil, err
+	}
+
+	stream, err := js.Stream(ctx, cfg.Stream)
+	if errors.Is(err, jetstream.ErrStreamNotFound) {
+		stream, err = js.CreateStream(ctx, jetstream.StreamConfig{Name: cfg.Stream, Subjects: []string{cfg.Subject}})
+	}
+	if err != nil {
+		nc.Close()
+		return nil, nil, fmt.Errorf("nats stream %s: %w", cfg.Stream, err)
+	}
+	return nc, stream, nil
+}
+
+// wait for one message until ctx deadline or cancel
+func (s *NATSSource) Fetch(ctx context.Context) (Message, error) {
+	if s.conn.IsClosed() {
+		return Message{}, ErrSourceClosed
+	}
+	wait := 30 * time.Second
+	if deadline, ok := ctx.Deadline(); ok {
+		wait = time.Until(deadline)
+	}
+	if wait <= 0 {
+		return Message{}, context.DeadlineExceeded
+	}
+
+	batch, err := s.consumer.Fetch(1, jetstream.FetchMaxWait(wait))
+	if err != nil {
+		return Message{}, err
+	}
+	var msg jetstream.Msg
+	select {
+	case msg = <-batch.Messages():
+	case <-ctx.Done():
+		// pull request lives until it expires, whatever it still brings goes back
+		go func() {
+			for m := range batch.Messages() {
+				_ = m.Nak()
+			}
+		}()
+		return Message{}, ctx.Err()
+	}
+	if msg == nil {
+		if ctx.Err() != nil {
+			return Message{}, ctx.Err()
+		}
+		if err := batch.Error(); err != nil {
+			return Message{}, err
+		}
+		return Message{}, nats.ErrTimeout
+	}
+	meta, err := msg.Metadata()
+	if err != nil {
+		// not a JetStream message, cannot be acked either
+		return Message{}, err
+	}
+	var headers map[string]string
+	for k := range msg.Headers() {
+		if headers == nil {
+			headers = make(map[string]string)
+		}
+		headers[k] = msg.Headers().Get(k)
+	}
+	return Message{
+		Key:     []byte(msg.Headers().Get(nats.MsgIdHdr)),
+		Value:   msg.Data(),
+		Headers: headers,
+		Topic:   msg.Subject(),
+		Offset:  int64(meta.Sequence.Stream),
+		Lag:     int64(meta.NumPending),
+		Time:    meta.Timestamp,
+		raw:     msg,
+	}, nil
+}
+
+// ack confirmed by server, so a stored order is not redelivered
+func (s *NATSSource) Ack(ctx context.Context, msg Message) error {
+	return msg.raw.(jetstream.Msg).DoubleAck(ctx)
+}
+
+// redeliver after retryDelay instead of waiting for ack_wait
+func (s *NATSSource) Nack(ctx context.Context, msg Message) error {
+	return msg.raw.(jetstream.Msg).NakWithDelay(retryDelay)
+}
+
+func (s *NATSSource) Close() error {
+	s.conn.Close()
+	return nil
+}
+
+func (s *NATSSource) Ping(ctx context.Context) error {
+	_, err := s.stream.Info(ctx)
+	return err
+}
@@ -0,0 +1,260 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/beganov/L0/internal/cache"
+	"github.com/beganov/L0/internal/config"
+	"github.com/beganov/L0/internal/database"
+	"github.com/beganov/L0/internal/logger"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/segmentio/kafka-go"
+)
+
+// what to re-read, partitions start from Offsets, then From, then the beginning
+type ReplayRequest struct {
+	From       time.Time     `json:"from,omitempty"`       // first message time
+	Offsets    map[int]int64 `json:"offsets,omitempty"`    // start offset by partition
+	Partitions []int         `json:"partitions,omitempty"` // empty means all
+	DryRun     bool          `json:"dry_run"`              // decode and check only, nothing is written
+}
+
+type ReplayCounts struct {
+	Accepted int `json:"accepted"` // new orders saved, or would be saved in dry run
+	Rejected int `json:"rejected"` // broken JSON or invalid order
+	Present  int `json:"present"`  // order already stored
+}
+
+type PartitionReplay struct {
+	Partition int   `json:"partition"`
+	From      int64 `json:"from"` // first offset read
+	To        int64 `json:"to"`   // high water mark at start, not included
+	ReplayCounts
+}
+
+type ReplayResult struct {
+	Group      string            `json:"group"`
+	DryRun     bool              `json:"dry_run"`
+	Partitions []PartitionReplay `json:"partitions"`
+	ReplayCounts
+}
+
+// consecutive fetch timeouts a partition replay survives, a slow broker
+// does not end the partition early
+const maxReplayTimeouts = 5
+
+// store for replayed orders, caches are optional
+type ReplayTarget struct {
+	DB    *pgxpool.Pool
+	Cache *cache.OrderCache
+	L2    *cache.RedisCache
+}
+
+// re-read topic up to the current end through the normal decode, validate and save path.
+// a temporary group of its own keeps the live consumer group untouched
+func Replay(ctx context.Context, cfg *config.Config, kc *Kafka, target ReplayTarget, req ReplayRequest) (ReplayResult, error) {
+	res := ReplayResult{
+		Group:  fmt.Sprintf("%s-replay-%d", cfg.Kafka.GroupID, time.Now().UnixNano()),
+		DryRun: req.DryRun,
+	}
+
+	group, err := kc.ConsumerGroup(res.Group)
+	if err != nil {
+		return res, err
+	}
+	defer group.Close()
+
+	// the only member of the group gets every partition
+	gen, err := group.Next(ctx)
+	if err != nil {
+		return res, err
+	}
+	logger.Info("Replay started", "group", res.Group, "dry_run", req.DryRun)
+
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		errs []error
+		seen = newSeenOrders()
+	)
+	for _, a := range gen.Assignments[cfg.Kafka.Topic] {
+		if len(req.Partitions) > 0 && !slices.Contains(req.Partitions, a.ID) {
+			continue
+		}
+		wg.Add(1)
+		go func(partition int) {
+			defer wg.Done()
+			pr, err := replayPartition(ctx, cfg, kc, target, req, seen, partition)
+
+			mu.Lock()
+			defer mu.Unlock()
+			res.Partitions = append(res.Partitions, pr)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("partition %d: %w", partition, err))
+			}
+		}(a.ID)
+	}
+	wg.Wait()
+
+	slices.SortFunc(res.Partitions, func(a, b PartitionReplay) int { return a.Partition - b.Partition })
+	for _, p := range res.Partitions {
+		res.Accepted += p.Accepted
+		res.Rejected += p.Rejected
+		res.Present += p.Present
+	}
+	logger.Info("Replay finished", "group", res.Group, "accepted", res.Accepted, "rejected", res.Rejected, "present", res.Present)
+	return res, errors.Join(errs...)
+}
+
+func replayPartition(ctx context.Context, cfg *config.Config, kc *Kafka, target ReplayTarget, req ReplayRequest, seen *seenOrders, partition int) (PartitionReplay, error) {
+	pr := PartitionReplay{Partition: partition}
+
+	// end is fixed at start, messages arriving later belong to the live consumer
+	first, end, err := partitionBounds(ctx, kc, partition)
+	if err != nil {
+		return pr, err
+	}
+
+	reader := kc.PartitionReader(partition)
+	defer reader.Close()
+	err = replayRange(ctx, cfg, reader, target, req, seen, first, end, &pr)
+	return pr, err
+}
+
+// what replay needs from a partition reader
+type replayReader interface {
+	SetOffset(offset int64) error
+	SetOffsetAt(ctx context.Context, t time.Time) error
+	Offset() int64
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+}
+
+// replay messages of one partition from the requested start up to end
+func replayRange(ctx context.Context, cfg *config.Config, reader replayReader, target ReplayTarget, req ReplayRequest, seen *seenOrders, first, end int64, pr *PartitionReplay) error {
+	pr.To = end
+
+	var err error
+	switch off, ok := req.Offsets[pr.Partition]; {
+	case ok:
+		err = reader.SetOffset(min(max(off, first), end)) // retention may have removed the start
+	case !req.From.IsZero():
+		err = reader.SetOffsetAt(ctx, req.From)
+	default:
+		err = reader.SetOffset(first)
+	}
+	if err != nil {
+		return err
+	}
+	// From after the newest message resolves to kafka.LastOffset (-1),
+	// nothing is left to read in this partition
+	if off := reader.Offset(); off < 0 || off >= end {
+		pr.From = end
+		return nil
+	}
+	pr.From = reader.Offset()
+
+	timeouts := 0
+	for reader.Offset() < end {
+		kfkCtx, cancel := context.WithTimeout(ctx, cfg.Kafka.Timeout)
+		msg, err := reader.FetchMessage(kfkCtx)
+		cancel()
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil && timeouts < maxReplayTimeouts {
+			timeouts++
+			logger.Warn("Replay fetch timed out, retrying", "partition", pr.Partition, "offset", reader.Offset())
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		timeouts = 0
+		if msg.Offset >= end {
+			break
+		}
+
+		if err := replayMessage(ctx, cfg, target, req.DryRun, seen, msg, &pr.ReplayCounts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// first available offset and next offset to be written
+func partitionBounds(ctx context.Context, kc *Kafka, partition int) (int64, int64, error) {
+	conn, err := kc.DialLeader(ctx, partition)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer conn.Close()
+	return conn.ReadOffsets()
+}
+
+// order ids met during a dry run, nothing is saved there to tell repeats apart
+type seenOrders struct {
+	mu  sync.Mutex
+	ids map[string]bool
+}
+
+func newSeenOrders() *seenOrders {
+	return &seenOrders{ids: make(map[string]bool)}
+}
+
+// false when the id was already met
+func (s *seenOrders) add(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ids[id] {
+		return false
+	}
+	s.ids[id] = true
+	return true
+}
+
+func replayMessage(ctx context.Context, cfg *config.Config, target ReplayTarget, dryRun bool, seen *seenOrders, msg kafka.Message, counts *ReplayCounts) error {
+	order, ok := decodeOrder(msg.Value)
+	if !ok {
+		counts.Rejected++
+		return nil
+	}
+
+	if dryRun {
+		// a real replay would store the first copy and find the others present
+		if !seen.add(order.OrderUID) {
+			counts.Present++
+			return nil
+		}
+		exists, err := database.OrderExists(ctx, target.DB, order.OrderUID, cfg.Postgres.SelectTimeout)
+		if err != nil {
+			return err
+		}
+		if exists {
+			counts.Present++
+		} else {
+			counts.Accepted++
+		}
+		return nil
+	}
+
+	inserted, err := database.SaveNewOrder(ctx, target.DB, order, cfg.Postgres.InsertTimeout)
+	if err != nil {
+		return err
+	}
+	if !inserted {
+		counts.Present++
+		return nil
+	}
+	counts.Accepted++
+
+	if target.Cache != nil {
+		target.Cache.Set(order.OrderUID, order)
+	}
+	if err := target.L2.Set(ctx, order); err != nil {
+		logger.Error(err, "L2 cache set failed")
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/beganov/L0/internal/config"
+	"github.com/beganov/L0/internal/database"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// партиция для повторной обработки, на заданных смещениях выборка сначала истекает
+type fakeReplayReader struct {
+	log      []kafka.Message
+	pos      int64
+	timeouts map[int64]int // offset -> fetches that time out before it is delivered
+}
+
+func (r *fakeReplayReader) SetOffset(offset int64) error { r.pos = offset; return nil }
+func (r *fakeReplayReader) Offset() int64                { return r.pos }
+
+// first message not older than t, kafka.LastOffset when there is none
+func (r *fakeReplayReader) SetOffsetAt(ctx context.Context, t time.Time) error {
+	r.pos = kafka.LastOffset
+	for _, m := range r.log {
+		if !m.Time.Before(t) {
+			r.pos = m.Offset
+			break
+		}
+	}
+	return nil
+}
+
+func (r *fakeReplayReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	if r.timeouts[r.pos] > 0 {
+		r.timeouts[r.pos]--
+		return kafka.Message{}, context.DeadlineExceeded
+	}
+	r.pos++
+	return r.log[r.pos-1], nil
+}
+
+// --- Тест повторной обработки: истёкшая выборка повторяется до конца партиции ---
+func TestReplayRange_RetriesTimeouts(t *testing.T) {
+	cfg := config.Default()
+	cfg.Kafka.Timeout = 10 * time.Millisecond
+	log := []kafka.Message{{Offset: 0, Value: []byte("x")}, {Offset: 1, Value: []byte("{}")}, {Offset: 2, Value: []byte("y")}}
+
+	r := &fakeReplayReader{log: log, timeouts: map[int64]int{1: maxReplayTimeouts, 2: 1}}
+	var pr PartitionReplay
+	err := replayRange(context.Background(), cfg, r, ReplayTarget{}, ReplayRequest{}, newSeenOrders(), 0, 3, &pr)
+	if err != nil {
+		t.Fatalf("timeouts must be retried: %v", err)
+	}
+	if pr.From != 0 || pr.To != 3 || pr.Rejected != 3 {
+		t.Errorf("unexpected result %+v", pr)
+	}
+
+	// broker that never answers still ends the replay
+	r = &fakeReplayReader{log: log, timeouts: map[int64]int{1: maxReplayTimeouts + 1}}
+	pr = PartitionReplay{}
+	err = replayRange(context.Background(), cfg, r, ReplayTarget{}, ReplayRequest{Offsets: map[int]int64{0: 1}}, newSeenOrders(), 0, 3, &pr)
+	if !errors.Is(err, context.DeadlineExceeded) || pr.From != 1 {
+		t.Errorf("expected timeout after %d retries, got %v %+v", maxReplayTimeouts, err, pr)
+	}
+}
+
+// --- Тест повторной обработки с момента после последнего сообщения: партиция пуста ---
+func TestReplayRange_FromAfterEnd(t *testing.T) {
+	cfg := config.Default()
+	cfg.Kafka.Timeout = 10 * time.Millisecond
+	now := time.Now()
+	log := []kafka.Message{{Offset: 0, Time: now.Add(-time.Hour)}, {Offset: 1, Time: now.Add(-time.Minute)}}
+
+	r := &fakeReplayReader{log: log, timeouts: map[int64]int{kafka.LastOffset: maxReplayTimeouts + 1}}
+	var pr PartitionReplay
+	err := replayRange(context.Background(), cfg, r, ReplayTarget{}, ReplayRequest{From: now}, newSeenOrders(), 0, 2, &pr)
+	if err != nil {
+		t.Fatalf("empty partition must not fail the replay: %v", err)
+	}
+	if pr.From != 2 || pr.To != 2 || pr.ReplayCounts != (ReplayCounts{}) {
+		t.Errorf("unexpected result %+v", pr)
+	}
+}
+
+// --- Тест пробного прогона: повтор одного заказа не считается новым ---
+func TestReplayRange_DryRunDedupe(t *testing.T) {
+	holder, db := testDB(t)
+	cfg := holder.Get()
+
+	id := fmt.Sprintf("replay-%d", time.Now().UnixNano())
+	fresh, present := testOrder(id), testOrder(id+"-stored")
+	if _, err := database.SaveNewOrder(context.Background(), db, present, cfg.Postgres.InsertTimeout); err != nil {
+		t.Fatal(err)
+	}
+	log := []kafka.Message{orderMessage(t, 0, fresh), orderMessage(t, 1, fresh), orderMessage(t, 2, present)}
+
+	var pr PartitionReplay
+	r := &fakeReplayReader{log: log}
+	if err := replayRange(context.Background(), cfg, r, ReplayTarget{DB: db}, ReplayRequest{DryRun: true}, newSeenOrders(), 0, 3, &pr); err != nil {
+		t.Fatal(err)
+	}
+	if pr.Accepted != 1 || pr.Present != 2 {
+		t.Errorf("expected 1 accepted and 2 present, got %+v", pr.ReplayCounts)
+	}
+	if stored(t, db, fresh.OrderUID) {
+		t.Error("dry run stored an order")
+	}
+}
@@ -0,0 +1,103 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/beganov/L0/internal/config"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/segmentio/kafka-go"
+)
+
+// Sink publishes messages to the topic the consumer reads.
+// only Key, Value and Headers of a message are used
+type Sink interface {
+	Publish(ctx context.Context, msgs ...Message) error
+	Close() error
+}
+
+// sink of the configured broker
+func NewSink(ctx context.Context, cfg *config.Config) (Sink, error) {
+	if cfg.Broker.Type == config.BrokerNATS {
+		return NewNATSSink(ctx, cfg.NATS)
+	}
+	kc, err := NewKafka(cfg.Kafka)
+	if err != nil {
+		return nil, err
+	}
+	return NewKafkaSink(kc), nil
+}
+
+// Sink over a Kafka writer, messages with the same key go to the same partition
+type KafkaSink struct {
+	writer *kafka.Writer
+}
+
+// constructor
+func NewKafkaSink(kc *Kafka) *KafkaSink {
+	return &KafkaSink{writer: kc.Writer()}
+}
+
+// synchronous, returns once all messages are acknowledged by the brokers
+func (s *KafkaSink) Publish(ctx context.Context, msgs ...Message) error {
+	batch := make([]kafka.Message, len(msgs))
+	for i, m := range msgs {
+		batch[i] = kafka.Message{Key: m.Key, Value: m.Value}
+		for k, v := range m.Headers {
+			batch[i].Headers = append(batch[i].Headers, kafka.Header{Key: k, Value: []byte(v)})
+		}
+	}
+	return s.writer.WriteMessages(ctx, batch...)
+}
+
+func (s *KafkaSink) Close() error {
+	return s.writer.Close()
+}
+
+// Sink over JetStream, idempotency key (message key if unset) becomes Nats-Msg-Id,
+// so the stream drops repeated publishes within its duplicate window
+type NATSSink struct {
+	conn    *nats.Conn
+	js      jetstream.JetStream
+	subject string
+}
+
+// connect, stream is created when missing
+func NewNATSSink(ctx context.Context, cfg config.NATSConfig) (*NATSSink, error) {
+	nc, _, err := connectNATS(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	return &NATSSink{conn: nc, js: js, subject: cfg.Subject}, nil
+}
+
+func (s *NATSSink) Publish(ctx context.Context, msgs ...Message) error {
+	for _, m := range msgs {
+		msg := nats.NewMsg(s.subject)
+		msg.Data = m.Value
+		for k, v := range m.Headers {
+			msg.Header.Set(k, v)
+		}
+		var opts []jetstream.PublishOpt
+		if id := m.Headers[IdempotencyKeyHeader]; id != "" {
+			opts = append(opts, jetstream.WithMsgID(id))
+		} else if len(m.Key) > 0 {
+			opts = append(opts, jetstream.WithMsgID(string(m.Key)))
+		}
+		if _, err := s.js.PublishMsg(ctx, msg, opts...); err != nil {
+			return fmt.Errorf("nats publish: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *NATSSink) Close() error {
+	return s.conn.Drain()
+}
@@ -0,0 +1,41 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// source cannot deliver anything anymore, consumer has to be restarted
+var ErrSourceClosed = errors.New("source closed")
+
+// header with the key publishers deduplicate by
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// message taken from or published to any broker
+type Message struct {
+	Key       []byte
+	Value     []byte
+	Headers   map[string]string
+	Topic     string // topic or subject
+	Partition int    // always 0 for brokers without partitions
+	Offset    int64  // position in partition or stream sequence
+	Lag       int64  // messages left behind this one
+	Time      time.Time
+
+	raw any // broker specific message, needed for ack and nack
+}
+
+// Source feeds the order pipeline. Message is acked once it is stored or
+// found broken, nacked when it has to be delivered again
+type Source interface {
+	Fetch(ctx context.Context) (Message, error)
+	Ack(ctx context.Context, msg Message) error
+	Nack(ctx context.Context, msg Message) error
+	Close() error
+}
+
+// source that can tell whether its broker is reachable
+type pinger interface {
+	Ping(ctx context.Context) error
+}
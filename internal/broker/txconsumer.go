@@ -0,0 +1,227 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/beganov/L0/internal/cache"
+	"github.com/beganov/L0/internal/config"
+	"github.com/beganov/L0/internal/database"
+	"github.com/beganov/L0/internal/events"
+	"github.com/beganov/L0/internal/logger"
+	"github.com/beganov/L0/internal/metrics"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/segmentio/kafka-go"
+)
+
+// delay before a message that failed to save is read again
+const retryDelay = time.Second
+
+// consumer keeping offsets in Postgres in the same transaction as orders.
+// Kafka group only balances partitions, each assigned partition is read
+// by its own reader starting from the offset stored in the DB
+type TxConsumer struct {
+	cfg     *config.Holder
+	kafka   *Kafka
+	db      *pgxpool.Pool
+	cache   *cache.OrderCache
+	l2      *cache.RedisCache
+	control *Control
+	hub     *events.Hub
+}
+
+// constructor
+func NewTxConsumer(cfg *config.Holder, kc *Kafka, db *pgxpool.Pool, cache *cache.OrderCache, l2 *cache.RedisCache, control *Control, hub *events.Hub) *TxConsumer {
+	return &TxConsumer{cfg: cfg, kafka: kc, db: db, cache: cache, l2: l2, control: control, hub: hub}
+}
+
+func (c *TxConsumer) Name() string {
+	return "consumer"
+}
+
+// join the group and consume assigned partitions generation by generation
+// until ctx is cancelled, in-flight messages are finished first
+func (c *TxConsumer) Start(ctx context.Context) error {
+	cfg := c.cfg.Get()
+	group, err := c.kafka.ConsumerGroup(cfg.Kafka.GroupID)
+	if err != nil {
+		return err
+	}
+	// leaving the group waits for partition loops to return
+	defer group.Close()
+	logger.Info("Kafka consumer started", "offset_store", config.OffsetStorePostgres)
+
+	for {
+		gen, err := group.Next(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				logger.Info("Kafka consumer stopped")
+				return nil
+			}
+			metrics.KafkaErrorsTotal.Inc()
+			return err
+		}
+
+		offsets, err := c.startOffsets(ctx, cfg, gen.Assignments[cfg.Kafka.Topic])
+		if err != nil {
+			return err
+		}
+		for partition, offset := range offsets {
+			gen.Start(func(genCtx context.Context) {
+				c.consumePartition(genCtx, gen, partition, offset)
+			})
+		}
+	}
+}
+
+// where assigned partitions start, assignment offsets come from Kafka
+// and the DB ones win when present
+func (c *TxConsumer) startOffsets(ctx context.Context, cfg *config.Config, assignments []kafka.PartitionAssignment) (map[int]int64, error) {
+	stored, err := database.LoadOffsets(ctx, c.db, cfg.Kafka.GroupID, cfg.Kafka.Topic, c.cfg.Get().Postgres.SelectTimeout)
+	if err != nil {
+		return nil, err
+	}
+	offsets := make(map[int]int64, len(assignments))
+	for _, a := range assignments {
+		offsets[a.ID] = a.Offset
+		if next, ok := stored[a.ID]; ok {
+			offsets[a.ID] = next
+		}
+	}
+	return offsets, nil
+}
+
+// fetching stops on context cancel done by supervisor, nothing else to do
+func (c *TxConsumer) Stop(ctx context.Context) error {
+	return nil
+}
+
+// consumer is healthy while any broker serves the topic
+func (c *TxConsumer) Health(ctx context.Context) error {
+	return c.kafka.Ping(ctx)
+}
+
+// what a partition loop needs from its reader
+type partitionReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	SetOffset(offset int64) error
+	Stats() kafka.ReaderStats
+}
+
+// read one partition until the generation ends
+func (c *TxConsumer) consumePartition(ctx context.Context, gen *kafka.Generation, partition int, offset int64) {
+	reader := c.kafka.PartitionReader(partition)
+	defer reader.Close()
+	// Kafka commit only feeds lag monitoring, the DB offset is the source of truth
+	commit := func(topic string, partition int, next int64) error {
+		return gen.CommitOffsets(map[string]map[int]int64{topic: {partition: next}})
+	}
+	c.readPartition(ctx, reader, commit, partition, offset)
+}
+
+func (c *TxConsumer) readPartition(ctx context.Context, reader partitionReader, commit func(topic string, partition int, next int64) error, partition int, offset int64) {
+	cfg := c.cfg.Get()
+	c.control.assign(cfg.Kafka.Topic, partition, reader)
+	defer c.control.release(partition)
+
+	if err := reader.SetOffset(offset); err != nil {
+		metrics.KafkaErrorsTotal.Inc()
+		logger.Error(err, "failed to seek partition")
+		return
+	}
+	logger.Info("Partition assigned", "partition", partition, "offset", offset)
+
+	for {
+		// paused by admin, nothing is fetched until resume
+		if err := c.control.wait(ctx); err != nil {
+			logger.Info("Partition released", "partition", partition)
+			return
+		}
+
+		cfg := c.cfg.Get() // timeouts may change on reload
+		timer := prometheus.NewTimer(metrics.KafkaProcessDuration)
+
+		kfkCtx, cancel := context.WithTimeout(ctx, cfg.Kafka.Timeout)
+		msg, err := reader.FetchMessage(kfkCtx)
+		metrics.KafkaMessagesTotal.Inc()
+		cancel()
+
+		if err != nil {
+			timer.ObserveDuration()
+			if ctx.Err() != nil {
+				logger.Info("Partition released", "partition", partition)
+				return
+			}
+			metrics.KafkaErrorsTotal.Inc()
+			logger.Error(err, "failed to read message")
+			continue
+		}
+
+		// fetched message is finished even if the generation ended meanwhile,
+		// the offset check in the transaction rejects it if someone else got there first
+		metrics.KafkaInFlight.Inc()
+		err = c.process(context.WithoutCancel(ctx), cfg, msg)
+		metrics.KafkaInFlight.Dec()
+		timer.ObserveDuration()
+
+		if err != nil {
+			// same message again to keep partition order
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(retryDelay):
+			}
+			if err := reader.SetOffset(msg.Offset); err != nil {
+				metrics.KafkaErrorsTotal.Inc()
+				logger.Error(err, "failed to seek partition")
+				return
+			}
+			continue
+		}
+
+		if err := commit(msg.Topic, msg.Partition, msg.Offset+1); err != nil && ctx.Err() == nil {
+			logger.Error(err, "commit failed")
+		}
+	}
+}
+
+// save order together with the next offset, broken messages only move the offset
+func (c *TxConsumer) process(ctx context.Context, cfg *config.Config, msg kafka.Message) error {
+	off := database.Offset{Group: cfg.Kafka.GroupID, Topic: msg.Topic, Partition: msg.Partition, Next: msg.Offset + 1}
+
+	order, ok := decodeOrder(msg.Value)
+	if !ok {
+		err := database.SaveOffset(ctx, c.db, off, cfg.Postgres.InsertTimeout)
+		if err != nil && !errors.Is(err, database.ErrStaleOffset) {
+			metrics.KafkaErrorsTotal.Inc()
+			logger.Error(err, "offset save failed")
+			return err
+		}
+		return nil
+	}
+
+	inserted, err := database.SaveOrderAt(ctx, c.db, order, off, cfg.Postgres.InsertTimeout)
+	if errors.Is(err, database.ErrStaleOffset) {
+		logger.Info("message already processed", "partition", msg.Partition, "offset", msg.Offset)
+		return nil
+	}
+	if err != nil {
+		metrics.KafkaErrorsTotal.Inc()
+		logger.Error(err, "db save failed")
+		return err
+	}
+
+	// update cache
+	c.cache.Set(order.OrderUID, order)
+	if err := c.l2.Set(ctx, order); err != nil {
+		logger.Error(err, "L2 cache set failed")
+	}
+	if inserted {
+		c.hub.Publish(order)
+	}
+	logger.Info("order received", "orderID", order.OrderUID)
+	return nil
+}
@@ -0,0 +1,224 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/beganov/L0/internal/cache"
+	"github.com/beganov/L0/internal/config"
+	"github.com/beganov/L0/internal/database"
+	"github.com/beganov/L0/internal/models"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/joho/godotenv"
+	"github.com/segmentio/kafka-go"
+)
+
+// Postgres из .env с отдельной группой консьюмера, без БД тест пропускается
+func testDB(t *testing.T) (*config.Holder, *pgxpool.Pool) {
+	t.Helper()
+	_ = godotenv.Load("../../.env")
+	cfg, err := config.Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Kafka.GroupID = fmt.Sprintf("test-%d", time.Now().UnixNano())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	db, err := pgxpool.New(context.Background(), cfg.Postgres.URL)
+	if err == nil {
+		err = db.Ping(ctx)
+	}
+	if err != nil {
+		t.Skipf("Postgres unavailable: %v", err)
+	}
+	if err := database.Migrate(context.Background(), cfg.Postgres.URL, "", "up", io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+	return config.NewHolder(cfg), db
+}
+
+func testOrder(uid string) models.Order {
+	return models.Order{
+		OrderUID:    uid,
+		Delivery:    models.Delivery{Name: "Test Testov"},
+		Payment:     models.Payment{Transaction: uid, Currency: "USD"},
+		Items:       []models.Items{{ChrtID: 1}},
+		DateCreated: time.Now(),
+	}
+}
+
+func orderMessage(t *testing.T, offset int64, o models.Order) kafka.Message {
+	t.Helper()
+	val, err := json.Marshal(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kafka.Message{Topic: "orders", Offset: offset, Value: val}
+}
+
+func stored(t *testing.T, db *pgxpool.Pool, uid string) bool {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(context.Background(), `SELECT count(*) FROM orders WHERE order_uid = $1`, uid).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n > 0
+}
+
+// партиция в памяти, запоминает перемотки
+type fakePartition struct {
+	mu    sync.Mutex
+	log   []kafka.Message
+	pos   int64
+	seeks []int64
+}
+
+func (p *fakePartition) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	p.mu.Lock()
+	if p.pos < int64(len(p.log)) {
+		defer p.mu.Unlock()
+		p.pos++
+		return p.log[p.pos-1], nil
+	}
+	p.mu.Unlock()
+	<-ctx.Done()
+	return kafka.Message{}, ctx.Err()
+}
+
+func (p *fakePartition) SetOffset(offset int64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pos = offset
+	p.seeks = append(p.seeks, offset)
+	return nil
+}
+
+func (p *fakePartition) Stats() kafka.ReaderStats { return kafka.ReaderStats{} }
+
+// --- Тест смещений в Postgres: смещение пишется в транзакции заказа, повтор отклоняется ---
+func TestSaveOrderAt_StaleOffset(t *testing.T) {
+	holder, db := testDB(t)
+	cfg := holder.Get()
+	ctx := context.Background()
+	off := database.Offset{Group: cfg.Kafka.GroupID, Topic: "orders", Partition: 0, Next: 5}
+	first := testOrder(fmt.Sprintf("tx-%d", time.Now().UnixNano()))
+
+	inserted, err := database.SaveOrderAt(ctx, db, first, off, cfg.Postgres.InsertTimeout)
+	if err != nil || !inserted {
+		t.Fatalf("first save: %v %v", inserted, err)
+	}
+	offsets, err := database.LoadOffsets(ctx, db, off.Group, off.Topic, cfg.Postgres.SelectTimeout)
+	if err != nil || offsets[0] != 5 {
+		t.Fatalf("stored offsets %v %v", offsets, err)
+	}
+
+	// replayed offset rolls the order back together with the offset
+	replayed := testOrder(first.OrderUID + "-replay")
+	if _, err := database.SaveOrderAt(ctx, db, replayed, off, cfg.Postgres.InsertTimeout); !errors.Is(err, database.ErrStaleOffset) {
+		t.Fatalf("expected ErrStaleOffset, got %v", err)
+	}
+	if stored(t, db, replayed.OrderUID) {
+		t.Error("order of a stale offset was stored")
+	}
+}
+
+// --- Тест транзакционного консьюмера: старт с сохранённого смещения и повтор после ошибки записи ---
+func TestTxConsumer_ReadPartition(t *testing.T) {
+	holder, db := testDB(t)
+	cfg := *holder.Get()
+	cfg.Postgres.InsertTimeout = 300 * time.Millisecond
+	holder = config.NewHolder(&cfg)
+	ctx := context.Background()
+
+	id := fmt.Sprintf("tx-%d", time.Now().UnixNano())
+	skipped, saved, last := testOrder(id+"-0"), testOrder(id+"-1"), testOrder(id+"-3")
+	part := &fakePartition{log: []kafka.Message{
+		orderMessage(t, 0, skipped),
+		orderMessage(t, 1, saved),
+		{Topic: "orders", Offset: 2, Value: []byte("not json")},
+		orderMessage(t, 3, last),
+	}}
+
+	// offset 0 was processed before the restart
+	off := database.Offset{Group: cfg.Kafka.GroupID, Topic: cfg.Kafka.Topic, Partition: 0, Next: 1}
+	if err := database.SaveOffset(ctx, db, off, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	c := NewTxConsumer(holder, nil, db, cache.NewOrderCache(10), nil, NewControl(), nil)
+	offsets, err := c.startOffsets(ctx, &cfg, []kafka.PartitionAssignment{{ID: 0, Offset: 0}, {ID: 1, Offset: 7}})
+	if err != nil || offsets[0] != 1 || offsets[1] != 7 {
+		t.Fatalf("start offsets %v %v", offsets, err)
+	}
+
+	// offset row is locked, the first save of offset 1 times out
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec(ctx, `SELECT 1 FROM consumer_offsets WHERE group_id = $1 FOR UPDATE`, off.Group); err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(2*cfg.Postgres.InsertTimeout, func() { tx.Rollback(context.Background()) })
+
+	var mu sync.Mutex
+	var commits []int64
+	commit := func(topic string, partition int, next int64) error {
+		mu.Lock()
+		defer mu.Unlock()
+		commits = append(commits, next)
+		return nil
+	}
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		c.readPartition(runCtx, part, commit, 0, offsets[0])
+		close(done)
+	}()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		mu.Lock()
+		n := len(commits)
+		mu.Unlock()
+		if n == 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("partition not consumed, commits %v", commits)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if fmt.Sprint(part.seeks) != "[1 1]" {
+		t.Errorf("expected seek to stored offset and one retry, got %v", part.seeks)
+	}
+	if fmt.Sprint(commits) != "[2 3 4]" {
+		t.Errorf("unexpected commits %v", commits)
+	}
+	if stored(t, db, skipped.OrderUID) || !stored(t, db, saved.OrderUID) || !stored(t, db, last.OrderUID) {
+		t.Error("only orders after the stored offset must be saved")
+	}
+	if _, ok := c.cache.Get(saved.OrderUID); !ok {
+		t.Error("saved order not cached")
+	}
+	got, err := database.LoadOffsets(ctx, db, off.Group, off.Topic, time.Second)
+	if err != nil || got[0] != 4 {
+		t.Errorf("stored offset %v %v", got, err)
+	}
+
+	// redelivered message is skipped by the offset check
+	if err := c.process(ctx, &cfg, part.log[1]); err != nil {
+		t.Errorf("replayed message: %v", err)
+	}
+}
@@ -77,7 +77,35 @@ func (c *OrderCache) Set(key string, order models.Order) {
 	c.moveToFront(node)
 
 	// remove LRU if over capacity
-	if len(c.store) > c.capacity {
+	c.evictOverflow()
+}
+
+// remove order from cache, false if it was not there
+func (c *OrderCache) Delete(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	node, ok := c.store[key]
+	if !ok {
+		return false
+	}
+	delete(c.store, key)
+	if node.prev != nil {
+		node.prev.next = node.next
+	} else {
+		c.head = node.next
+	}
+	if node.next != nil {
+		node.next.prev = node.prev
+	} else {
+		c.tail = node.prev
+	}
+	return true
+}
+
+// drop least recently used nodes until cache fits capacity
+func (c *OrderCache) evictOverflow() {
+	for len(c.store) > c.capacity {
 		delete(c.store, c.tail.key)
 		if c.tail.prev != nil {
 			c.tail = c.tail.prev
@@ -90,6 +118,32 @@ func (c *OrderCache) Set(key string, order models.Order) {
 	}
 }
 
+// change capacity, shrinking evicts least recently used orders.
+// returns number of evicted orders
+func (c *OrderCache) Resize(capacity int) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	before := len(c.store)
+	c.capacity = capacity
+	c.evictOverflow()
+	return before - len(c.store)
+}
+
+// current capacity
+func (c *OrderCache) Cap() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.capacity
+}
+
+// number of cached orders
+func (c *OrderCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.store)
+}
+
 // get order from cache
 func (c *OrderCache) Get(key string) (models.Order, bool) {
 	c.mu.Lock()
@@ -104,3 +158,15 @@ func (c *OrderCache) Get(key string) (models.Order, bool) {
 	metrics.CacheMisses.Inc()
 	return models.Order{}, false
 }
+
+// copy of cached orders, least recently used first
+func (c *OrderCache) Orders() []models.Order {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	out := make([]models.Order, 0, len(c.store))
+	for node := c.tail; node != nil; node = node.prev {
+		out = append(out, node.value)
+	}
+	return out
+}
@@ -120,3 +120,56 @@ func TestOrderCache_SetExistingKey(t *testing.T) {
 		t.Errorf("expected OrderUID='a', got %v", order.OrderUID)
 	}
 }
+
+// --- Тест уменьшения ёмкости ---
+func TestOrderCache_Resize(t *testing.T) {
+	cache := NewOrderCache(3)
+
+	cache.Set("a", newTestOrder("a"))
+	cache.Set("b", newTestOrder("b"))
+	cache.Set("c", newTestOrder("c"))
+	cache.Get("a") // "b" теперь самый старый
+
+	if evicted := cache.Resize(1); evicted != 2 {
+		t.Errorf("expected 2 evicted, got %d", evicted)
+	}
+	if _, ok := cache.Get("a"); !ok {
+		t.Errorf("expected 'a' to remain")
+	}
+	if cache.Len() != 1 {
+		t.Errorf("expected len=1, got %d", cache.Len())
+	}
+
+	cache.Resize(2)
+	cache.Set("d", newTestOrder("d"))
+	if cache.Len() != 2 {
+		t.Errorf("expected len=2 after growing, got %d", cache.Len())
+	}
+}
+
+// --- Тест удаления: голова, хвост и середина списка LRU ---
+func TestOrderCache_Delete(t *testing.T) {
+	c := NewOrderCache(3)
+	for _, id := range []string{"a", "b", "c"} {
+		c.Set(id, newTestOrder(id))
+	}
+
+	for _, id := range []string{"b", "c", "a"} {
+		if !c.Delete(id) {
+			t.Fatalf("Delete(%q) = false", id)
+		}
+		if _, ok := c.Get(id); ok {
+			t.Fatalf("%q still cached", id)
+		}
+	}
+	if c.Delete("a") || c.Len() != 0 {
+		t.Fatalf("cache must be empty, len %d", c.Len())
+	}
+
+	// list stays usable after removals
+	c.Set("d", newTestOrder("d"))
+	c.Set("e", newTestOrder("e"))
+	if got := len(c.Orders()); got != 2 {
+		t.Errorf("expected 2 orders, got %d", got)
+	}
+}
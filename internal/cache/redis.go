@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/beganov/L0/internal/metrics"
+	"github.com/beganov/L0/internal/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// second-level cache in any Redis-compatible server,
+// shared between replicas and surviving restarts.
+// nil *RedisCache is valid and behaves as a disabled tier.
+type RedisCache struct {
+	client *redis.Client
+	prefix string
+	ttl    time.Duration
+}
+
+// constructor, url is redis://[user:pass@]host:port/db
+func NewRedisCache(ctx context.Context, url, prefix string, ttl time.Duration) (*RedisCache, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+
+	client := redis.NewClient(opts)
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return &RedisCache{
+		client: client,
+		prefix: prefix,
+		ttl:    ttl,
+	}, nil
+}
+
+func (r *RedisCache) key(id string) string {
+	return r.prefix + id
+}
+
+// get order from L2, (false, nil) means plain miss
+func (r *RedisCache) Get(ctx context.Context, id string) (models.Order, bool, error) {
+	if r == nil {
+		return models.Order{}, false, nil
+	}
+
+	data, err := r.client.Get(ctx, r.key(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		metrics.L2CacheMisses.Inc()
+		return models.Order{}, false, nil
+	}
+	if err != nil {
+		metrics.L2CacheErrors.Inc()
+		return models.Order{}, false, err
+	}
+
+	var order models.Order
+	if err := json.Unmarshal(data, &order); err != nil {
+		metrics.L2CacheErrors.Inc()
+		return models.Order{}, false, err
+	}
+
+	metrics.L2CacheHits.Inc()
+	return order, true, nil
+}
+
+// put order to L2 with configured ttl (0 = no expiry)
+func (r *RedisCache) Set(ctx context.Context, order models.Order) error {
+	if r == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(order)
+	if err != nil {
+		return err
+	}
+
+	if err := r.client.Set(ctx, r.key(order.OrderUID), data, r.ttl).Err(); err != nil {
+		metrics.L2CacheErrors.Inc()
+		return err
+	}
+	return nil
+}
+
+// remove order from L2
+func (r *RedisCache) Delete(ctx context.Context, id string) error {
+	if r == nil {
+		return nil
+	}
+
+	if err := r.client.Del(ctx, r.key(id)).Err(); err != nil {
+		metrics.L2CacheErrors.Inc()
+		return err
+	}
+	return nil
+}
+
+// fill L1 from L2 without touching the DB, returns number of loaded orders
+func (r *RedisCache) Warm(ctx context.Context, c *OrderCache) (int, error) {
+	if r == nil {
+		return 0, nil
+	}
+
+	loaded, capacity := 0, c.Cap()
+	iter := r.client.Scan(ctx, 0, r.prefix+"*", 100).Iterator()
+	for iter.Next(ctx) && loaded < capacity {
+		data, err := r.client.Get(ctx, iter.Val()).Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue // expired between SCAN and GET
+		}
+		if err != nil {
+			metrics.L2CacheErrors.Inc()
+			return loaded, err
+		}
+
+		var order models.Order
+		if err := json.Unmarshal(data, &order); err != nil {
+			metrics.L2CacheErrors.Inc()
+			continue
+		}
+
+		c.Set(order.OrderUID, order)
+		loaded++
+	}
+	if err := iter.Err(); err != nil {
+		metrics.L2CacheErrors.Inc()
+		return loaded, err
+	}
+	return loaded, nil
+}
+
+// close connection pool
+func (r *RedisCache) Close() error {
+	if r == nil {
+		return nil
+	}
+	return r.client.Close()
+}
@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// поднимает in-process RESP сервер и L2 кэш поверх него
+func newTestRedisCache(t *testing.T, ttl time.Duration) (*RedisCache, *miniredis.Miniredis) {
+	t.Helper()
+	srv := miniredis.RunT(t)
+
+	l2, err := NewRedisCache(context.Background(), "redis://"+srv.Addr(), "order:", ttl)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { l2.Close() })
+	return l2, srv
+}
+
+// --- Тест Set + Get через RESP ---
+func TestRedisCache_SetAndGet(t *testing.T) {
+	l2, _ := newTestRedisCache(t, 0)
+	ctx := context.Background()
+
+	if _, ok, err := l2.Get(ctx, "a"); ok || err != nil {
+		t.Errorf("expected clean miss, got hit=%v err=%v", ok, err)
+	}
+
+	if err := l2.Set(ctx, newTestOrder("a")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	order, ok, err := l2.Get(ctx, "a")
+	if err != nil || !ok {
+		t.Fatalf("expected hit, got hit=%v err=%v", ok, err)
+	}
+	if order.OrderUID != "a" || len(order.Items) != 1 || order.Items[0].Name != "item1" {
+		t.Errorf("order was not round-tripped: %+v", order)
+	}
+}
+
+// --- Тест TTL ---
+func TestRedisCache_TTL(t *testing.T) {
+	l2, srv := newTestRedisCache(t, time.Minute)
+	ctx := context.Background()
+
+	if err := l2.Set(ctx, newTestOrder("a")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ttl := srv.TTL("order:a"); ttl != time.Minute {
+		t.Errorf("expected ttl=1m, got %v", ttl)
+	}
+
+	srv.FastForward(2 * time.Minute)
+
+	if _, ok, _ := l2.Get(ctx, "a"); ok {
+		t.Errorf("expected 'a' to expire")
+	}
+}
+
+// --- Тест прогрева L1 из L2 ---
+func TestRedisCache_Warm(t *testing.T) {
+	l2, srv := newTestRedisCache(t, 0)
+	ctx := context.Background()
+
+	for _, k := range []string{"a", "b", "c"} {
+		if err := l2.Set(ctx, newTestOrder(k)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	srv.Set("foreign:key", "not an order") // чужой префикс игнорируется
+
+	cache := NewOrderCache(2)
+	n, err := l2.Warm(ctx, cache)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 orders loaded up to capacity, got %d", n)
+	}
+}
+
+// --- Тест отключённого L2 ---
+func TestRedisCache_Nil(t *testing.T) {
+	var l2 *RedisCache
+	ctx := context.Background()
+
+	if err := l2.Set(ctx, newTestOrder("a")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, ok, err := l2.Get(ctx, "a"); ok || err != nil {
+		t.Errorf("expected miss without error, got hit=%v err=%v", ok, err)
+	}
+	if n, err := l2.Warm(ctx, NewOrderCache(1)); n != 0 || err != nil {
+		t.Errorf("expected no-op warm, got n=%d err=%v", n, err)
+	}
+}
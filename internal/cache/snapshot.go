@@ -0,0 +1,128 @@
+package cache
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/gob"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/beganov/L0/internal/logger"
+	"github.com/beganov/L0/internal/models"
+)
+
+const snapshotVersion = 1
+
+// on-disk cache image, entries go from least to most recently used
+type snapshot struct {
+	Version int
+	TakenAt time.Time
+	Entries []snapshotEntry
+}
+
+type snapshotEntry struct {
+	Key   string
+	Value models.Order
+}
+
+// write gzipped gob snapshot of the cache, file is replaced atomically
+func (c *OrderCache) SaveSnapshot(path string) error {
+	snap := snapshot{Version: snapshotVersion, TakenAt: time.Now().UTC()}
+
+	for _, o := range c.Orders() {
+		snap.Entries = append(snap.Entries, snapshotEntry{Key: o.OrderUID, Value: o})
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after successful rename
+
+	zw := gzip.NewWriter(tmp)
+	if err := gob.NewEncoder(zw).Encode(snap); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// restore cache from snapshot keeping LRU order.
+// returns number of loaded orders and newest date_created among them,
+// which is the point to reconcile with the DB from
+func (c *OrderCache) LoadSnapshot(path string) (int, time.Time, error) {
+	var newest time.Time
+
+	orders, err := ReadSnapshot(path)
+	if err != nil {
+		return 0, newest, err
+	}
+
+	for _, o := range orders {
+		c.Set(o.OrderUID, o)
+		if o.DateCreated.After(newest) {
+			newest = o.DateCreated
+		}
+	}
+	return len(orders), newest, nil
+}
+
+// read orders from snapshot file, least recently used first
+func ReadSnapshot(path string) ([]models.Order, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	var snap snapshot
+	if err := gob.NewDecoder(zr).Decode(&snap); err != nil {
+		return nil, err
+	}
+	if snap.Version != snapshotVersion {
+		return nil, errors.New("unsupported cache snapshot version")
+	}
+
+	orders := make([]models.Order, 0, len(snap.Entries))
+	for _, e := range snap.Entries {
+		orders = append(orders, e.Value)
+	}
+	return orders, nil
+}
+
+// save snapshot every interval until ctx is done
+func (c *OrderCache) RunSnapshots(ctx context.Context, path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.SaveSnapshot(path); err != nil {
+				logger.Error(err, "periodic cache snapshot failed")
+			}
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// --- Тест сохранения и загрузки снапшота с сохранением LRU-порядка ---
+func TestOrderCache_SnapshotRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+
+	src := NewOrderCache(3)
+	for i, k := range []string{"a", "b", "c"} {
+		o := newTestOrder(k)
+		o.DateCreated = time.Date(2025, 1, i+1, 0, 0, 0, 0, time.UTC)
+		src.Set(k, o)
+	}
+	src.Get("a") // "b" теперь самый старый
+
+	if err := src.SaveSnapshot(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	dst := NewOrderCache(3)
+	n, newest, err := dst.LoadSnapshot(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("expected 3 orders, got %d", n)
+	}
+	if want := time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC); !newest.Equal(want) {
+		t.Errorf("expected newest=%v, got %v", want, newest)
+	}
+
+	// LRU-порядок восстановлен: новый элемент вытесняет "b"
+	dst.Set("d", newTestOrder("d"))
+	if _, ok := dst.Get("b"); ok {
+		t.Errorf("expected 'b' to be evicted")
+	}
+	if order, ok := dst.Get("a"); !ok || order.Items[0].Name != "item1" {
+		t.Errorf("expected 'a' to remain with its value")
+	}
+}
+
+// --- Тест отсутствующего файла ---
+func TestOrderCache_SnapshotMissing(t *testing.T) {
+	cache := NewOrderCache(1)
+	if _, _, err := cache.LoadSnapshot(filepath.Join(t.TempDir(), "none")); err == nil {
+		t.Errorf("expected error for missing snapshot")
+	}
+}
@@ -1,66 +1,561 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"net"
 	"os"
-	"strconv"
+	"strings"
 	"time"
 
-	"github.com/beganov/L0/internal/logger"
+	"github.com/beganov/L0/internal/projection"
+
+	"github.com/rs/zerolog"
+)
+
+// service configuration, filled by Load from defaults, file, env and flags
+type Config struct {
+	Broker     BrokerConfig
+	Kafka      KafkaConfig
+	NATS       NATSConfig
+	Postgres   PostgresConfig
+	HTTP       HTTPConfig
+	GRPC       GRPCConfig
+	Stream     StreamConfig
+	GraphQL    GraphQLConfig
+	Ingest     IngestConfig
+	Auth       AuthConfig
+	PII        PIIConfig
+	Cache      CacheConfig
+	Redis      RedisConfig
+	Log        LogConfig
+	Reload     ReloadConfig
+	Shutdown   ShutdownConfig
+	Supervisor SupervisorConfig
+
+	File string // config file it was loaded from, if any
+}
+
+type BrokerConfig struct {
+	Type string // where orders come from
+}
+
+// brokers orders can be consumed from
+const (
+	BrokerKafka = "kafka"
+	BrokerNATS  = "nats"
 )
 
-var (
-	KafkaBroker  string
-	KafkaTopic   string
-	KafkaGroupID string
+type KafkaConfig struct {
+	Brokers     []string
+	Topic       string
+	GroupID     string
+	Timeout     time.Duration
+	OffsetStore string // where consumed offsets are committed
+	ClientID    string
+
+	// fetch tuning
+	MinBytes    int
+	MaxBytes    int
+	MaxWait     time.Duration
+	StartOffset string // first or last, used when the group has no committed offset
+	Rebalance   string // partition assignment strategy
+	Rack        string // for rack-affinity
+
+	SASL KafkaSASLConfig
+	TLS  KafkaTLSConfig
+}
+
+type KafkaSASLConfig struct {
+	Mechanism string // empty disables SASL
+	Username  string
+	Password  string
+}
+
+type KafkaTLSConfig struct {
+	Enabled            bool
+	CAFile             string // system pool when empty
+	CertFile           string // client certificate for mutual TLS
+	KeyFile            string
+	ServerName         string
+	InsecureSkipVerify bool
+}
 
-	PostgresURL string
+// SASL mechanisms
+const (
+	SASLPlain       = "plain"
+	SASLScramSHA256 = "scram-sha-256"
+	SASLScramSHA512 = "scram-sha-512"
+)
 
-	CacheCap int
+// partition assignment strategies
+const (
+	RebalanceRange        = "range"
+	RebalanceRoundRobin   = "roundrobin"
+	RebalanceRackAffinity = "rack-affinity"
+)
 
-	HttpAddr string
+// offset stores
+const (
+	OffsetStoreKafka    = "kafka"    // commit to Kafka after the order is saved
+	OffsetStorePostgres = "postgres" // store in the order transaction
+)
 
-	HttpTimeOut   time.Duration
-	SelectTimeOut time.Duration
-	InsertTimeOut time.Duration
-	KafkaTimeOut  time.Duration
+// JetStream pull consumer
+type NATSConfig struct {
+	URL     string
+	Stream  string
+	Subject string
+	Durable string        // consumer name, position survives restarts
+	Timeout time.Duration // fetch wait
+	AckWait time.Duration // unacked message is redelivered after it
+}
 
+type PostgresConfig struct {
+	URL           string
+	SelectTimeout time.Duration
+	InsertTimeout time.Duration
 	MigrationPath string
+}
+
+type HTTPConfig struct {
+	Addr     string
+	Timeout  time.Duration
+	BatchMax int // ids in one bulk lookup
+	// order fields that ?fields= and ?exclude= may name, subfields included
+	ProjectionAllow []string
+}
+
+// gRPC API, empty address disables it
+type GRPCConfig struct {
+	Addr        string
+	WatchBuffer int // events a WatchOrders client may fall behind before it is dropped
+}
+
+// live order stream over SSE and WebSocket
+type StreamConfig struct {
+	History      int           // last orders kept for Last-Event-ID resumption
+	Buffer       int           // orders a client may fall behind before it is dropped
+	Heartbeat    time.Duration // keep-alive of idle connections
+	WriteTimeout time.Duration // client that does not read for this long is dropped
+}
+
+// GraphQL endpoint and limits that protect the DB
+type GraphQLConfig struct {
+	Enabled  bool
+	MaxDepth int // nesting of selections
+	MaxCost  int // estimated cost, see README
+	MaxPage  int // largest orders(first:)
+}
+
+// authentication of HTTP and gRPC callers, every configured source is accepted
+type AuthConfig struct {
+	Enabled      bool
+	APIKeysFile  string        // "name role sha256-of-key" per line
+	HMACKeysFile string        // "key_id role secret" per line
+	HMACSkew     time.Duration // allowed clock difference of signed requests
+	JWKSFile     string        // local JWKS that bearer tokens are checked against
+	JWTIssuer    string        // required iss when set
+	JWTAudience  string        // required aud when set
+	JWTRoleClaim string        // claim holding the role or a list of roles
+}
+
+// masking of personal data, see pii tags in models
+type PIIConfig struct {
+	HashKey     string        // key of hashed values, empty hashes are easy to reverse for phones
+	ErasurePoll time.Duration // how often erasures of other instances are picked up, 0 only at startup
+}
+
+// order submission over HTTP, published to the consumed topic
+type IngestConfig struct {
+	Enabled  bool
+	MaxBatch int           // orders in one request
+	Timeout  time.Duration // publish timeout
+}
+
+type CacheConfig struct {
+	Capacity         int
+	SnapshotPath     string        // empty disables snapshots
+	SnapshotInterval time.Duration // 0 saves only on shutdown
+}
+
+type RedisConfig struct {
+	URL    string // empty disables L2 cache
+	Prefix string
+	TTL    time.Duration // 0 means no expiry
+}
+
+type LogConfig struct {
+	Level string
+}
+
+type ReloadConfig struct {
+	WatchInterval time.Duration // 0 disables file polling, SIGHUP always works
+}
+
+// deadline of every shutdown step
+type ShutdownConfig struct {
+	ConsumerTimeout time.Duration // in-flight message drain
+	HTTPTimeout     time.Duration
+	CacheTimeout    time.Duration
+	KafkaTimeout    time.Duration // broker connection close
+	PostgresTimeout time.Duration // pool close
+}
+
+// restart policy of supervised components
+type SupervisorConfig struct {
+	MaxRestarts int // consecutive restarts before giving up, 0 means unlimited
+	BackoffMin  time.Duration
+	BackoffMax  time.Duration
+	Fatal       []string // components whose giving up stops the service
+}
+
+// config with defaults for everything that has a sane default
+func Default() *Config {
+	return &Config{
+		Broker: BrokerConfig{
+			Type: BrokerKafka,
+		},
+		Kafka: KafkaConfig{
+			GroupID:     "L0-service",
+			Timeout:     30 * time.Second,
+			OffsetStore: OffsetStoreKafka,
+			ClientID:    "L0-service",
+			MinBytes:    1,
+			MaxBytes:    10 << 20,
+			MaxWait:     time.Second,
+			StartOffset: "first",
+			Rebalance:   RebalanceRange,
+		},
+		NATS: NATSConfig{
+			URL:     "nats://localhost:4222",
+			Stream:  "ORDERS",
+			Subject: "orders",
+			Durable: "L0-service",
+			Timeout: 30 * time.Second,
+			AckWait: 30 * time.Second,
+		},
+		Postgres: PostgresConfig{
+			SelectTimeout: 3 * time.Second,
+			InsertTimeout: 3 * time.Second,
+		},
+		HTTP: HTTPConfig{
+			Addr:     ":8081",
+			Timeout:  2 * time.Second,
+			BatchMax: 100,
+			ProjectionAllow: []string{"order_uid", "track_number", "entry", "locale", "customer_id",
+				"delivery_service", "date_created", "delivery", "payment", "items"},
+		},
+		GRPC: GRPCConfig{
+			Addr:        "", // off unless set, the port also serves reflection
+			WatchBuffer: 256,
+		},
+		Stream: StreamConfig{
+			History:      1000,
+			Buffer:       256,
+			Heartbeat:    15 * time.Second,
+			WriteTimeout: 10 * time.Second,
+		},
+		GraphQL: GraphQLConfig{
+			Enabled:  true,
+			MaxDepth: 6,
+			MaxCost:  1000,
+			MaxPage:  100,
+		},
+		Auth: AuthConfig{
+			HMACSkew:     5 * time.Minute,
+			JWTRoleClaim: "role",
+		},
+		PII: PIIConfig{
+			ErasurePoll: 10 * time.Second,
+		},
+		Ingest: IngestConfig{
+			Enabled:  true,
+			MaxBatch: 500,
+			Timeout:  5 * time.Second,
+		},
+		Cache: CacheConfig{
+			Capacity: 1000,
+		},
+		Redis: RedisConfig{
+			Prefix: "order:",
+		},
+		Log: LogConfig{
+			Level: "info",
+		},
+		Shutdown: ShutdownConfig{
+			ConsumerTimeout: 10 * time.Second,
+			HTTPTimeout:     5 * time.Second,
+			CacheTimeout:    10 * time.Second,
+			KafkaTimeout:    5 * time.Second,
+			PostgresTimeout: 5 * time.Second,
+		},
+		Supervisor: SupervisorConfig{
+			MaxRestarts: 5,
+			BackoffMin:  time.Second,
+			BackoffMax:  30 * time.Second,
+			Fatal:       []string{"http", "consumer"},
+		},
+	}
+}
+
+// check whole config, all problems are reported at once
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(key, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: "+format, append([]any{key}, args...)...))
+	}
+
+	switch c.Broker.Type {
+	case BrokerKafka:
+		c.validateKafka(fail)
+	case BrokerNATS:
+		c.validateNATS(fail)
+		// offsets live in the stream consumer, there is nothing to store
+		if c.Kafka.OffsetStore != OffsetStoreKafka {
+			fail("kafka.offset_store", "%s needs broker.type %s", c.Kafka.OffsetStore, BrokerKafka)
+		}
+	default:
+		fail("broker.type", "must be %s or %s, got %q", BrokerKafka, BrokerNATS, c.Broker.Type)
+	}
+
+	c.validatePostgres(fail)
+
+	if c.HTTP.Addr == "" {
+		fail("http.addr", "is required")
+	} else if _, _, err := net.SplitHostPort(c.HTTP.Addr); err != nil {
+		fail("http.addr", "invalid listen address %q", c.HTTP.Addr)
+	}
+	positive(fail, "http.timeout", c.HTTP.Timeout)
+	if c.HTTP.BatchMax <= 0 {
+		fail("http.batch_max", "must be positive, got %d", c.HTTP.BatchMax)
+	}
+	for _, path := range c.HTTP.ProjectionAllow {
+		if !projection.Known(path) {
+			fail("http.projection_allow", "unknown order field %q", path)
+		}
+	}
+
+	if c.GRPC.Addr != "" {
+		if _, _, err := net.SplitHostPort(c.GRPC.Addr); err != nil {
+			fail("grpc.addr", "invalid listen address %q", c.GRPC.Addr)
+		}
+	}
+	if c.GRPC.WatchBuffer <= 0 {
+		fail("grpc.watch_buffer", "must be positive, got %d", c.GRPC.WatchBuffer)
+	}
+
+	if c.Stream.History < 0 {
+		fail("stream.history", "must not be negative")
+	}
+	if c.Stream.Buffer <= 0 {
+		fail("stream.buffer", "must be positive, got %d", c.Stream.Buffer)
+	}
+	positive(fail, "stream.heartbeat", c.Stream.Heartbeat)
+	positive(fail, "stream.write_timeout", c.Stream.WriteTimeout)
+
+	if c.GraphQL.MaxDepth <= 0 {
+		fail("graphql.max_depth", "must be positive, got %d", c.GraphQL.MaxDepth)
+	}
+	if c.GraphQL.MaxCost <= 0 {
+		fail("graphql.max_cost", "must be positive, got %d", c.GraphQL.MaxCost)
+	}
+	if c.GraphQL.MaxPage <= 0 {
+		fail("graphql.max_page", "must be positive, got %d", c.GraphQL.MaxPage)
+	}
+
+	if c.Auth.Enabled {
+		if c.Auth.APIKeysFile == "" && c.Auth.HMACKeysFile == "" && c.Auth.JWKSFile == "" {
+			fail("auth.enabled", "needs auth.api_keys_file, auth.hmac_keys_file or auth.jwks_file")
+		}
+		positive(fail, "auth.hmac_skew", c.Auth.HMACSkew)
+		if c.Auth.JWKSFile != "" && c.Auth.JWTRoleClaim == "" {
+			fail("auth.jwt_role_claim", "is required with auth.jwks_file")
+		}
+	}
+
+	if c.PII.ErasurePoll < 0 {
+		fail("pii.erasure_poll", "must not be negative")
+	}
+
+	if c.Ingest.MaxBatch <= 0 {
+		fail("ingest.max_batch", "must be positive, got %d", c.Ingest.MaxBatch)
+	}
+	positive(fail, "ingest.timeout", c.Ingest.Timeout)
+
+	c.validateCache(fail)
+
+	if _, err := zerolog.ParseLevel(c.Log.Level); err != nil {
+		fail("log.level", "unknown level %q", c.Log.Level)
+	}
+
+	if c.Reload.WatchInterval < 0 {
+		fail("reload.watch_interval", "must not be negative")
+	}
+
+	positive(fail, "shutdown.consumer_timeout", c.Shutdown.ConsumerTimeout)
+	positive(fail, "shutdown.http_timeout", c.Shutdown.HTTPTimeout)
+	positive(fail, "shutdown.cache_timeout", c.Shutdown.CacheTimeout)
+	positive(fail, "shutdown.kafka_timeout", c.Shutdown.KafkaTimeout)
+	positive(fail, "shutdown.postgres_timeout", c.Shutdown.PostgresTimeout)
+
+	if c.Supervisor.MaxRestarts < 0 {
+		fail("supervisor.max_restarts", "must not be negative")
+	}
+	positive(fail, "supervisor.backoff_min", c.Supervisor.BackoffMin)
+	if c.Supervisor.BackoffMax < c.Supervisor.BackoffMin {
+		fail("supervisor.backoff_max", "must not be less than backoff_min")
+	}
+
+	return errors.Join(errs...)
+}
+
+type failFunc func(key, format string, args ...any)
+
+// parts of the config one-shot commands depend on
+type Section int
+
+const (
+	SectionPostgres Section = iota
+	SectionCache            // cache.* and redis.*
+	SectionKafka
 )
 
-func VarsInit() {
+// check only the given sections and log level, commands that do not serve
+// should not fail on settings they never read
+func (c *Config) ValidateSections(sections ...Section) error {
+	var errs []error
+	fail := func(key, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: "+format, append([]any{key}, args...)...))
+	}
 
-	KafkaBroker = os.Getenv("KAFKA_BROKER")
-	KafkaTopic = os.Getenv("KAFKA_TOPIC")
-	KafkaGroupID = os.Getenv("KAFKA_GROUP_ID")
-	PostgresURL = os.Getenv("POSTGRES_URL")
-	HttpAddr = os.Getenv("HTTP_ADDR")
+	for _, s := range sections {
+		switch s {
+		case SectionPostgres:
+			c.validatePostgres(fail)
+		case SectionCache:
+			c.validateCache(fail)
+		case SectionKafka:
+			c.validateKafka(fail)
+		}
+	}
+	if _, err := zerolog.ParseLevel(c.Log.Level); err != nil {
+		fail("log.level", "unknown level %q", c.Log.Level)
+	}
+	return errors.Join(errs...)
+}
 
-	var err error
-	CacheCap, err = strconv.Atoi(os.Getenv("CACHE_CAP"))
-	if err != nil {
-		logger.Fatal(err, "CACHE_CAP is not number")
+func (c *Config) validatePostgres(fail failFunc) {
+	if c.Postgres.URL == "" {
+		fail("postgres.url", "is required")
 	}
+	positive(fail, "postgres.select_timeout", c.Postgres.SelectTimeout)
+	positive(fail, "postgres.insert_timeout", c.Postgres.InsertTimeout)
+}
 
-	httpTimeoutSec, err := strconv.Atoi(os.Getenv("HTTP_TIMEOUT"))
-	if err != nil {
-		logger.Fatal(err, "HTTP_TIMEOUT is not number")
+func (c *Config) validateCache(fail failFunc) {
+	if c.Cache.Capacity <= 0 {
+		fail("cache.capacity", "must be positive, got %d", c.Cache.Capacity)
 	}
-	selectTimeoutSec, err := strconv.Atoi(os.Getenv("SELECT_TIMEOUT"))
-	if err != nil {
-		logger.Fatal(err, "SELECT_TIMEOUT is not number")
+	if c.Cache.SnapshotInterval < 0 {
+		fail("cache.snapshot_interval", "must not be negative")
 	}
-	insertTimeoutSec, err := strconv.Atoi(os.Getenv("INSERT_TIMEOUT"))
-	if err != nil {
-		logger.Fatal(err, "INSERT_TIMEOUT is not number")
+
+	if c.Redis.URL != "" && !strings.HasPrefix(c.Redis.URL, "redis://") && !strings.HasPrefix(c.Redis.URL, "rediss://") {
+		fail("redis.url", "must start with redis:// or rediss://")
 	}
-	kafkaTimeoutSec, err := strconv.Atoi(os.Getenv("KAFKA_TIMEOUT"))
-	if err != nil {
-		logger.Fatal(err, "KAFKA_TIMEOUT is not number")
+	if c.Redis.TTL < 0 {
+		fail("redis.ttl", "must not be negative")
 	}
+}
 
-	HttpTimeOut = time.Duration(httpTimeoutSec) * time.Second
-	SelectTimeOut = time.Duration(selectTimeoutSec) * time.Second
-	InsertTimeOut = time.Duration(insertTimeoutSec) * time.Second
-	KafkaTimeOut = time.Duration(kafkaTimeoutSec) * time.Second
-	MigrationPath = os.Getenv("MIGRATION_PATH")
+func (c *Config) validateKafka(fail failFunc) {
+	if len(c.Kafka.Brokers) == 0 {
+		fail("kafka.brokers", "at least one broker is required")
+	}
+	for _, b := range c.Kafka.Brokers {
+		if _, _, err := net.SplitHostPort(b); err != nil {
+			fail("kafka.brokers", "invalid broker address %q", b)
+		}
+	}
+	if c.Kafka.Topic == "" {
+		fail("kafka.topic", "is required")
+	}
+	if c.Kafka.GroupID == "" {
+		fail("kafka.group_id", "is required")
+	}
+	positive(fail, "kafka.timeout", c.Kafka.Timeout)
+	if c.Kafka.OffsetStore != OffsetStoreKafka && c.Kafka.OffsetStore != OffsetStorePostgres {
+		fail("kafka.offset_store", "must be %s or %s, got %q", OffsetStoreKafka, OffsetStorePostgres, c.Kafka.OffsetStore)
+	}
+	if c.Kafka.MinBytes <= 0 {
+		fail("kafka.min_bytes", "must be positive, got %d", c.Kafka.MinBytes)
+	}
+	if c.Kafka.MaxBytes < c.Kafka.MinBytes {
+		fail("kafka.max_bytes", "must not be less than min_bytes")
+	}
+	positive(fail, "kafka.max_wait", c.Kafka.MaxWait)
+	if c.Kafka.StartOffset != "first" && c.Kafka.StartOffset != "last" {
+		fail("kafka.start_offset", "must be first or last, got %q", c.Kafka.StartOffset)
+	}
+	switch c.Kafka.Rebalance {
+	case RebalanceRange, RebalanceRoundRobin:
+	case RebalanceRackAffinity:
+		if c.Kafka.Rack == "" {
+			fail("kafka.rack", "is required for %s", RebalanceRackAffinity)
+		}
+	default:
+		fail("kafka.rebalance", "unknown strategy %q", c.Kafka.Rebalance)
+	}
+
+	switch c.Kafka.SASL.Mechanism {
+	case "":
+	case SASLPlain, SASLScramSHA256, SASLScramSHA512:
+		if c.Kafka.SASL.Username == "" {
+			fail("kafka.sasl.username", "is required for %s", c.Kafka.SASL.Mechanism)
+		}
+	default:
+		fail("kafka.sasl.mechanism", "unknown mechanism %q", c.Kafka.SASL.Mechanism)
+	}
+	if (c.Kafka.TLS.CertFile == "") != (c.Kafka.TLS.KeyFile == "") {
+		fail("kafka.tls.cert_file", "cert_file and key_file go together")
+	}
+	// slice, not map: errors come out in the same order on every run
+	for _, f := range []struct{ key, path string }{
+		{"kafka.tls.ca_file", c.Kafka.TLS.CAFile},
+		{"kafka.tls.cert_file", c.Kafka.TLS.CertFile},
+		{"kafka.tls.key_file", c.Kafka.TLS.KeyFile},
+	} {
+		if f.path == "" {
+			continue
+		}
+		if !c.Kafka.TLS.Enabled {
+			fail(f.key, "is set but kafka.tls.enabled is false")
+		} else if _, err := os.Stat(f.path); err != nil {
+			fail(f.key, "%v", err)
+		}
+	}
+}
+
+func (c *Config) validateNATS(fail failFunc) {
+	if !strings.HasPrefix(c.NATS.URL, "nats://") && !strings.HasPrefix(c.NATS.URL, "tls://") {
+		fail("nats.url", "must start with nats:// or tls://")
+	}
+	if c.NATS.Stream == "" {
+		fail("nats.stream", "is required")
+	}
+	if c.NATS.Subject == "" {
+		fail("nats.subject", "is required")
+	}
+	if c.NATS.Durable == "" {
+		fail("nats.durable", "is required")
+	}
+	positive(fail, "nats.timeout", c.NATS.Timeout)
+	positive(fail, "nats.ack_wait", c.NATS.AckWait)
+}
+
+func positive(fail failFunc, key string, d time.Duration) {
+	if d <= 0 {
+		fail(key, "must be positive, got %s", d)
+	}
 }
@@ -0,0 +1,436 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// one config option and all the names it is known by
+type field struct {
+	key   string // dotted key in config file, flag name is derived from it
+	env   []string
+	usage string
+	set   func(c *Config, v string) error
+	get   func(c *Config) string
+	// empty value disables a feature, so an empty env var is a value too
+	clearable bool
+}
+
+var fields = []field{
+	stringField("broker.type", []string{"BROKER_TYPE"}, "where orders come from: kafka or nats",
+		func(c *Config) *string { return &c.Broker.Type }),
+
+	listField("kafka.brokers", []string{"KAFKA_BROKERS", "KAFKA_BROKER"}, "comma separated Kafka brokers",
+		func(c *Config) *[]string { return &c.Kafka.Brokers }),
+	stringField("kafka.topic", []string{"KAFKA_TOPIC"}, "Kafka topic with orders",
+		func(c *Config) *string { return &c.Kafka.Topic }),
+	stringField("kafka.group_id", []string{"KAFKA_GROUP_ID"}, "Kafka consumer group",
+		func(c *Config) *string { return &c.Kafka.GroupID }),
+	durationField("kafka.timeout", []string{"KAFKA_TIMEOUT"}, "Kafka fetch timeout",
+		func(c *Config) *time.Duration { return &c.Kafka.Timeout }),
+	stringField("kafka.offset_store", []string{"KAFKA_OFFSET_STORE"}, "where offsets are committed: kafka or postgres",
+		func(c *Config) *string { return &c.Kafka.OffsetStore }),
+	stringField("kafka.client_id", []string{"KAFKA_CLIENT_ID"}, "client ID sent to brokers",
+		func(c *Config) *string { return &c.Kafka.ClientID }),
+	intField("kafka.min_bytes", []string{"KAFKA_MIN_BYTES"}, "minimum fetch size in bytes",
+		func(c *Config) *int { return &c.Kafka.MinBytes }),
+	intField("kafka.max_bytes", []string{"KAFKA_MAX_BYTES"}, "maximum fetch size in bytes",
+		func(c *Config) *int { return &c.Kafka.MaxBytes }),
+	durationField("kafka.max_wait", []string{"KAFKA_MAX_WAIT"}, "maximum time a fetch waits for min_bytes",
+		func(c *Config) *time.Duration { return &c.Kafka.MaxWait }),
+	stringField("kafka.start_offset", []string{"KAFKA_START_OFFSET"}, "first or last, for a group without committed offsets",
+		func(c *Config) *string { return &c.Kafka.StartOffset }),
+	stringField("kafka.rebalance", []string{"KAFKA_REBALANCE"}, "partition assignment: range, roundrobin or rack-affinity",
+		func(c *Config) *string { return &c.Kafka.Rebalance }),
+	stringField("kafka.rack", []string{"KAFKA_RACK"}, "rack of this instance for rack-affinity",
+		func(c *Config) *string { return &c.Kafka.Rack }),
+	stringField("kafka.sasl.mechanism", []string{"KAFKA_SASL_MECHANISM"}, "plain, scram-sha-256 or scram-sha-512, empty disables SASL",
+		func(c *Config) *string { return &c.Kafka.SASL.Mechanism }),
+	stringField("kafka.sasl.username", []string{"KAFKA_SASL_USERNAME"}, "SASL user",
+		func(c *Config) *string { return &c.Kafka.SASL.Username }),
+	stringField("kafka.sasl.password", []string{"KAFKA_SASL_PASSWORD"}, "SASL password",
+		func(c *Config) *string { return &c.Kafka.SASL.Password }),
+	boolField("kafka.tls.enabled", []string{"KAFKA_TLS_ENABLED"}, "connect to brokers over TLS",
+		func(c *Config) *bool { return &c.Kafka.TLS.Enabled }),
+	stringField("kafka.tls.ca_file", []string{"KAFKA_TLS_CA_FILE"}, "PEM file with CA certificates, system pool if empty",
+		func(c *Config) *string { return &c.Kafka.TLS.CAFile }),
+	stringField("kafka.tls.cert_file", []string{"KAFKA_TLS_CERT_FILE"}, "PEM client certificate for mutual TLS",
+		func(c *Config) *string { return &c.Kafka.TLS.CertFile }),
+	stringField("kafka.tls.key_file", []string{"KAFKA_TLS_KEY_FILE"}, "PEM client key for mutual TLS",
+		func(c *Config) *string { return &c.Kafka.TLS.KeyFile }),
+	stringField("kafka.tls.server_name", []string{"KAFKA_TLS_SERVER_NAME"}, "expected broker certificate name",
+		func(c *Config) *string { return &c.Kafka.TLS.ServerName }),
+	boolField("kafka.tls.insecure_skip_verify", []string{"KAFKA_TLS_INSECURE_SKIP_VERIFY"}, "do not verify broker certificates",
+		func(c *Config) *bool { return &c.Kafka.TLS.InsecureSkipVerify }),
+
+	stringField("nats.url", []string{"NATS_URL"}, "NATS server url",
+		func(c *Config) *string { return &c.NATS.URL }),
+	stringField("nats.stream", []string{"NATS_STREAM"}, "JetStream stream with orders",
+		func(c *Config) *string { return &c.NATS.Stream }),
+	stringField("nats.subject", []string{"NATS_SUBJECT"}, "subject orders are published to",
+		func(c *Config) *string { return &c.NATS.Subject }),
+	stringField("nats.durable", []string{"NATS_DURABLE"}, "durable consumer name",
+		func(c *Config) *string { return &c.NATS.Durable }),
+	durationField("nats.timeout", []string{"NATS_TIMEOUT"}, "NATS fetch timeout",
+		func(c *Config) *time.Duration { return &c.NATS.Timeout }),
+	durationField("nats.ack_wait", []string{"NATS_ACK_WAIT"}, "redelivery delay of unacked messages",
+		func(c *Config) *time.Duration { return &c.NATS.AckWait }),
+
+	stringField("postgres.url", []string{"POSTGRES_URL"}, "Postgres connection string",
+		func(c *Config) *string { return &c.Postgres.URL }),
+	durationField("postgres.select_timeout", []string{"SELECT_TIMEOUT"}, "DB select timeout",
+		func(c *Config) *time.Duration { return &c.Postgres.SelectTimeout }),
+	durationField("postgres.insert_timeout", []string{"INSERT_TIMEOUT"}, "DB insert timeout",
+		func(c *Config) *time.Duration { return &c.Postgres.InsertTimeout }),
+	stringField("postgres.migration_path", []string{"MIGRATION_PATH"}, "directory with goose migrations, empty uses the embedded ones",
+		func(c *Config) *string { return &c.Postgres.MigrationPath }),
+
+	stringField("http.addr", []string{"HTTP_ADDR"}, "HTTP listen address",
+		func(c *Config) *string { return &c.HTTP.Addr }),
+	durationField("http.timeout", []string{"HTTP_TIMEOUT"}, "HTTP request timeout",
+		func(c *Config) *time.Duration { return &c.HTTP.Timeout }),
+	intField("http.batch_max", []string{"HTTP_BATCH_MAX"}, "maximum order ids in one bulk lookup",
+		func(c *Config) *int { return &c.HTTP.BatchMax }),
+	listField("http.projection_allow", []string{"HTTP_PROJECTION_ALLOW"}, "comma separated order fields that ?fields= and ?exclude= may name",
+		func(c *Config) *[]string { return &c.HTTP.ProjectionAllow }),
+
+	clearable(stringField("grpc.addr", []string{"GRPC_ADDR"}, "gRPC listen address, empty disables",
+		func(c *Config) *string { return &c.GRPC.Addr })),
+	intField("grpc.watch_buffer", []string{"GRPC_WATCH_BUFFER"}, "orders a WatchOrders client may fall behind before it is dropped",
+		func(c *Config) *int { return &c.GRPC.WatchBuffer }),
+
+	intField("stream.history", []string{"STREAM_HISTORY"}, "last orders kept for Last-Event-ID resumption",
+		func(c *Config) *int { return &c.Stream.History }),
+	intField("stream.buffer", []string{"STREAM_BUFFER"}, "orders a stream client may fall behind before it is dropped",
+		func(c *Config) *int { return &c.Stream.Buffer }),
+	durationField("stream.heartbeat", []string{"STREAM_HEARTBEAT"}, "keep-alive interval of idle stream connections",
+		func(c *Config) *time.Duration { return &c.Stream.Heartbeat }),
+	durationField("stream.write_timeout", []string{"STREAM_WRITE_TIMEOUT"}, "stream client that does not read for this long is dropped",
+		func(c *Config) *time.Duration { return &c.Stream.WriteTimeout }),
+
+	boolField("graphql.enabled", []string{"GRAPHQL_ENABLED"}, "serve GraphQL on /graphql",
+		func(c *Config) *bool { return &c.GraphQL.Enabled }),
+	intField("graphql.max_depth", []string{"GRAPHQL_MAX_DEPTH"}, "maximum nesting of a GraphQL query",
+		func(c *Config) *int { return &c.GraphQL.MaxDepth }),
+	intField("graphql.max_cost", []string{"GRAPHQL_MAX_COST"}, "maximum estimated cost of a GraphQL query",
+		func(c *Config) *int { return &c.GraphQL.MaxCost }),
+	intField("graphql.max_page", []string{"GRAPHQL_MAX_PAGE"}, "maximum orders in one GraphQL page",
+		func(c *Config) *int { return &c.GraphQL.MaxPage }),
+
+	boolField("auth.enabled", []string{"AUTH_ENABLED"}, "require credentials on HTTP and gRPC",
+		func(c *Config) *bool { return &c.Auth.Enabled }),
+	stringField("auth.api_keys_file", []string{"AUTH_API_KEYS_FILE"}, "file with API key hashes and roles",
+		func(c *Config) *string { return &c.Auth.APIKeysFile }),
+	stringField("auth.hmac_keys_file", []string{"AUTH_HMAC_KEYS_FILE"}, "file with HMAC key ids, roles and secrets",
+		func(c *Config) *string { return &c.Auth.HMACKeysFile }),
+	durationField("auth.hmac_skew", []string{"AUTH_HMAC_SKEW"}, "allowed clock difference of HMAC-signed requests",
+		func(c *Config) *time.Duration { return &c.Auth.HMACSkew }),
+	stringField("auth.jwks_file", []string{"AUTH_JWKS_FILE"}, "local JWKS file for bearer tokens",
+		func(c *Config) *string { return &c.Auth.JWKSFile }),
+	stringField("auth.jwt_issuer", []string{"AUTH_JWT_ISSUER"}, "required JWT issuer, empty skips the check",
+		func(c *Config) *string { return &c.Auth.JWTIssuer }),
+	stringField("auth.jwt_audience", []string{"AUTH_JWT_AUDIENCE"}, "required JWT audience, empty skips the check",
+		func(c *Config) *string { return &c.Auth.JWTAudience }),
+	stringField("auth.jwt_role_claim", []string{"AUTH_JWT_ROLE_CLAIM"}, "JWT claim with the caller role",
+		func(c *Config) *string { return &c.Auth.JWTRoleClaim }),
+
+	stringField("pii.hash_key", []string{"PII_HASH_KEY"}, "secret key of hashed personal data",
+		func(c *Config) *string { return &c.PII.HashKey }),
+	durationField("pii.erasure_poll", []string{"PII_ERASURE_POLL"}, "how often erasures made elsewhere are evicted from the cache, 0 only at startup",
+		func(c *Config) *time.Duration { return &c.PII.ErasurePoll }),
+
+	boolField("ingest.enabled", []string{"INGEST_ENABLED"}, "accept orders with POST /orders",
+		func(c *Config) *bool { return &c.Ingest.Enabled }),
+	intField("ingest.max_batch", []string{"INGEST_MAX_BATCH"}, "maximum orders in one POST /orders request",
+		func(c *Config) *int { return &c.Ingest.MaxBatch }),
+	durationField("ingest.timeout", []string{"INGEST_TIMEOUT"}, "timeout of publishing submitted orders",
+		func(c *Config) *time.Duration { return &c.Ingest.Timeout }),
+
+	intField("cache.capacity", []string{"CACHE_CAP"}, "in-memory cache capacity",
+		func(c *Config) *int { return &c.Cache.Capacity }),
+	clearable(stringField("cache.snapshot_path", []string{"CACHE_SNAPSHOT_PATH"}, "cache snapshot file, empty disables",
+		func(c *Config) *string { return &c.Cache.SnapshotPath })),
+	durationField("cache.snapshot_interval", []string{"CACHE_SNAPSHOT_INTERVAL"}, "periodic snapshot interval, 0 saves only on shutdown",
+		func(c *Config) *time.Duration { return &c.Cache.SnapshotInterval }),
+
+	clearable(stringField("redis.url", []string{"REDIS_URL"}, "Redis L2 cache url, empty disables",
+		func(c *Config) *string { return &c.Redis.URL })),
+	stringField("redis.prefix", []string{"REDIS_PREFIX"}, "Redis key prefix",
+		func(c *Config) *string { return &c.Redis.Prefix }),
+	durationField("redis.ttl", []string{"REDIS_TTL"}, "Redis entry ttl, 0 means no expiry",
+		func(c *Config) *time.Duration { return &c.Redis.TTL }),
+
+	stringField("log.level", []string{"LOG_LEVEL"}, "log level",
+		func(c *Config) *string { return &c.Log.Level }),
+
+	durationField("reload.watch_interval", []string{"RELOAD_WATCH_INTERVAL"}, "config file poll interval for hot reload, 0 disables",
+		func(c *Config) *time.Duration { return &c.Reload.WatchInterval }),
+
+	durationField("shutdown.consumer_timeout", []string{"SHUTDOWN_CONSUMER_TIMEOUT"}, "time to finish in-flight message on shutdown",
+		func(c *Config) *time.Duration { return &c.Shutdown.ConsumerTimeout }),
+	durationField("shutdown.http_timeout", []string{"SHUTDOWN_HTTP_TIMEOUT"}, "time to finish HTTP requests on shutdown",
+		func(c *Config) *time.Duration { return &c.Shutdown.HTTPTimeout }),
+	durationField("shutdown.cache_timeout", []string{"SHUTDOWN_CACHE_TIMEOUT"}, "time to save cache snapshot and close L2 on shutdown",
+		func(c *Config) *time.Duration { return &c.Shutdown.CacheTimeout }),
+	durationField("shutdown.kafka_timeout", []string{"SHUTDOWN_KAFKA_TIMEOUT"}, "time to close broker connection on shutdown",
+		func(c *Config) *time.Duration { return &c.Shutdown.KafkaTimeout }),
+	durationField("shutdown.postgres_timeout", []string{"SHUTDOWN_POSTGRES_TIMEOUT"}, "time to close Postgres pool on shutdown",
+		func(c *Config) *time.Duration { return &c.Shutdown.PostgresTimeout }),
+
+	intField("supervisor.max_restarts", []string{"SUPERVISOR_MAX_RESTARTS"}, "consecutive component restarts before giving up, 0 means unlimited",
+		func(c *Config) *int { return &c.Supervisor.MaxRestarts }),
+	durationField("supervisor.backoff_min", []string{"SUPERVISOR_BACKOFF_MIN"}, "first restart delay",
+		func(c *Config) *time.Duration { return &c.Supervisor.BackoffMin }),
+	durationField("supervisor.backoff_max", []string{"SUPERVISOR_BACKOFF_MAX"}, "restart delay cap",
+		func(c *Config) *time.Duration { return &c.Supervisor.BackoffMax }),
+	listField("supervisor.fatal", []string{"SUPERVISOR_FATAL"}, "comma separated components whose failure stops the service",
+		func(c *Config) *[]string { return &c.Supervisor.Fatal }),
+}
+
+// build config from defaults, then file, then env, then flags.
+// args are command line arguments without program name
+func Load(args []string) (*Config, error) {
+	return LoadFlags(flag.NewFlagSet("L0-service", flag.ContinueOnError), args)
+}
+
+// same as Load, command specific flags may be registered on fs beforehand.
+// positional arguments are left in fs.Args()
+func LoadFlags(fs *flag.FlagSet, args []string) (*Config, error) {
+	return load(fs, args, (*Config).Validate)
+}
+
+// same as LoadFlags, only the given sections are validated
+func LoadSections(fs *flag.FlagSet, args []string, sections ...Section) (*Config, error) {
+	return load(fs, args, func(c *Config) error { return c.ValidateSections(sections...) })
+}
+
+func load(fs *flag.FlagSet, args []string, validate func(*Config) error) (*Config, error) {
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML or TOML config file")
+	envFile := fs.String("env-file", os.Getenv("ENV_FILE"), "dotenv file, must exist when given (default: optional .env)")
+	for _, f := range fields {
+		fs.String(flagName(f.key), "", f.usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if err := loadEnvFile(*envFile); err != nil {
+		return nil, err
+	}
+
+	cfg := Default()
+	cfg.File = *configFile
+	var errs []error
+
+	// file
+	if *configFile != "" {
+		values, err := readFile(*configFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range fields {
+			if v, ok := values[f.key]; ok {
+				errs = appendSetErr(errs, f, cfg, v)
+				delete(values, f.key)
+			}
+		}
+		for key := range values {
+			errs = append(errs, fmt.Errorf("%s: unknown option in %s", key, *configFile))
+		}
+	}
+
+	// env, first listed name wins, empty values count as unset
+	// unless an empty value disables the option
+	for _, f := range fields {
+		for _, name := range f.env {
+			if v, ok := os.LookupEnv(name); ok && (v != "" || f.clearable) {
+				errs = appendSetErr(errs, f, cfg, v)
+				break
+			}
+		}
+	}
+
+	// flags, only those given explicitly
+	byFlag := make(map[string]field, len(fields))
+	for _, f := range fields {
+		byFlag[flagName(f.key)] = f
+	}
+	fs.Visit(func(fl *flag.Flag) {
+		if f, ok := byFlag[fl.Name]; ok {
+			errs = appendSetErr(errs, f, cfg, fl.Value.String())
+		}
+	})
+
+	// parse and validation problems go out in one report
+	if err := errors.Join(append(errs, validate(cfg))...); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// dotenv never overrides real environment, so plain env vars keep priority.
+// without explicit path .env is optional, as in container deployments
+func loadEnvFile(path string) error {
+	if path != "" {
+		if err := godotenv.Load(path); err != nil {
+			return fmt.Errorf("env file %s: %w", path, err)
+		}
+		return nil
+	}
+
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("env file .env: %w", err)
+	}
+	return nil
+}
+
+func appendSetErr(errs []error, f field, cfg *Config, v string) []error {
+	if err := f.set(cfg, strings.TrimSpace(v)); err != nil {
+		errs = append(errs, fmt.Errorf("%s: %w", f.key, err))
+	}
+	return errs
+}
+
+func flagName(key string) string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(key)
+}
+
+// read YAML or TOML file into flat dotted keys
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := map[string]any{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("config file %s: unsupported format, use .yaml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	out := map[string]string{}
+	flatten("", raw, out)
+	return out, nil
+}
+
+func flatten(prefix string, in map[string]any, out map[string]string) {
+	for k, v := range in {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		switch val := v.(type) {
+		case map[string]any:
+			flatten(key, val, out)
+		case []any:
+			parts := make([]string, 0, len(val))
+			for _, p := range val {
+				parts = append(parts, fmt.Sprint(p))
+			}
+			out[key] = strings.Join(parts, ",")
+		default:
+			out[key] = fmt.Sprint(val)
+		}
+	}
+}
+
+// comma separated list without empty entries
+func splitList(v string) []string {
+	var out []string
+	for _, p := range strings.Split(v, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// Go duration string, bare number is seconds for compatibility with old env files
+func parseDuration(v string) (time.Duration, error) {
+	if n, err := strconv.Atoi(v); err == nil {
+		return time.Duration(n) * time.Second, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", v)
+	}
+	return d, nil
+}
+
+func stringField(key string, env []string, usage string, ptr func(c *Config) *string) field {
+	return field{key: key, env: env, usage: usage,
+		set: func(c *Config, v string) error { *ptr(c) = v; return nil },
+		get: func(c *Config) string { return *ptr(c) },
+	}
+}
+
+func clearable(f field) field {
+	f.clearable = true
+	return f
+}
+
+func listField(key string, env []string, usage string, ptr func(c *Config) *[]string) field {
+	return field{key: key, env: env, usage: usage,
+		set: func(c *Config, v string) error { *ptr(c) = splitList(v); return nil },
+		get: func(c *Config) string { return strings.Join(*ptr(c), ",") },
+	}
+}
+
+func durationField(key string, env []string, usage string, ptr func(c *Config) *time.Duration) field {
+	return field{key: key, env: env, usage: usage,
+		set: func(c *Config, v string) error {
+			d, err := parseDuration(v)
+			if err != nil {
+				return err
+			}
+			*ptr(c) = d
+			return nil
+		},
+		get: func(c *Config) string { return ptr(c).String() },
+	}
+}
+
+func boolField(key string, env []string, usage string, ptr func(c *Config) *bool) field {
+	return field{key: key, env: env, usage: usage,
+		set: func(c *Config, v string) error {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("%q is not a boolean", v)
+			}
+			*ptr(c) = b
+			return nil
+		},
+		get: func(c *Config) string { return strconv.FormatBool(*ptr(c)) },
+	}
+}
+
+func intField(key string, env []string, usage string, ptr func(c *Config) *int) field {
+	return field{key: key, env: env, usage: usage,
+		set: func(c *Config, v string) error {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("%q is not a number", v)
+			}
+			*ptr(c) = n
+			return nil
+		},
+		get: func(c *Config) string { return strconv.Itoa(*ptr(c)) },
+	}
+}
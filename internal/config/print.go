@@ -0,0 +1,76 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// options that may carry credentials
+var secretKeys = map[string]bool{
+	"postgres.url": true,
+	"redis.url":    true,
+	"nats.url":     true,
+}
+
+// URL options where a user without password is a token
+var tokenKeys = map[string]bool{
+	"nats.url": true,
+}
+
+// options that are credentials as a whole
+var passwordKeys = map[string]bool{
+	"kafka.sasl.password": true,
+	"pii.hash_key":        true,
+}
+
+const redactedMark = "xxxxx"
+
+var dsnPassword = regexp.MustCompile(`(password=)([^\s&]+)`)
+
+// write effective config as key = value lines with secrets redacted
+func (c *Config) Print(w io.Writer) error {
+	if c.File != "" {
+		if _, err := fmt.Fprintf(w, "# loaded from %s\n", c.File); err != nil {
+			return err
+		}
+	}
+	for _, f := range fields {
+		v := f.get(c)
+		if secretKeys[f.key] {
+			v = redact(v, tokenKeys[f.key])
+		}
+		if passwordKeys[f.key] && v != "" {
+			v = redactedMark
+		}
+		if _, err := fmt.Fprintf(w, "%s = %q\n", f.key, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hide password in URL, comma separated URLs or key=value DSN
+func redact(v string, userIsToken bool) string {
+	if strings.Contains(v, ",") {
+		parts := strings.Split(v, ",")
+		for i, p := range parts {
+			parts[i] = redact(p, userIsToken)
+		}
+		return strings.Join(parts, ",")
+	}
+	if u, err := url.Parse(v); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redactedMark)
+			return u.String()
+		}
+		if userIsToken {
+			u.User = url.User(redactedMark)
+			return u.String()
+		}
+		return v
+	}
+	return dsnPassword.ReplaceAllString(v, "${1}"+redactedMark)
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// settings that components pick up without restart
+var liveKeys = map[string]bool{
+	"kafka.timeout":           true,
+	"nats.timeout":            true,
+	"postgres.select_timeout": true,
+	"postgres.insert_timeout": true,
+	"http.timeout":            true,
+	"http.batch_max":          true,
+	"http.projection_allow":   true,
+	"stream.buffer":           true,
+	"stream.heartbeat":        true,
+	"stream.write_timeout":    true,
+	"graphql.max_depth":       true,
+	"graphql.max_cost":        true,
+	"graphql.max_page":        true,
+	"ingest.max_batch":        true,
+	"ingest.timeout":          true,
+	"cache.capacity":          true,
+	"log.level":               true,
+}
+
+// current effective config shared by components, swapped on reload
+type Holder struct {
+	cur atomic.Pointer[Config]
+}
+
+// constructor
+func NewHolder(cfg *Config) *Holder {
+	h := &Holder{}
+	h.cur.Store(cfg)
+	return h
+}
+
+// current config, callers must not modify it
+func (h *Holder) Get() *Config {
+	return h.cur.Load()
+}
+
+// replace current config
+func (h *Holder) Set(cfg *Config) {
+	h.cur.Store(cfg)
+}
+
+// outcome of comparing running config with a freshly loaded one
+type ReloadResult struct {
+	Config  *Config  // running config with live changes applied
+	Applied []string // keys changed live
+	Restart []string // changed keys that need a restart to take effect
+}
+
+// take live-tunable changes from next, keep everything else as in cur
+func ApplyLive(cur, next *Config) ReloadResult {
+	merged := *cur
+	merged.Kafka.Brokers = append([]string(nil), cur.Kafka.Brokers...)
+	res := ReloadResult{Config: &merged}
+
+	for _, f := range fields {
+		v := f.get(next)
+		if f.get(cur) == v {
+			continue
+		}
+		if !liveKeys[f.key] {
+			res.Restart = append(res.Restart, f.key)
+			continue
+		}
+		// value already passed validation in next, set cannot fail
+		_ = f.set(&merged, v)
+		res.Applied = append(res.Applied, f.key)
+	}
+	return res
+}
+
+// poll file modification time and call fn on every change until ctx is done
+func Watch(ctx context.Context, path string, interval time.Duration, fn func()) {
+	stamp := func() (time.Time, int64) {
+		st, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, -1
+		}
+		return st.ModTime(), st.Size()
+	}
+
+	lastMod, lastSize := stamp()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			mod, size := stamp()
+			if size < 0 || (mod.Equal(lastMod) && size == lastSize) {
+				continue
+			}
+			lastMod, lastSize = mod, size
+			fn()
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/beganov/L0/internal/logger"
+	"github.com/beganov/L0/internal/metrics"
+	"github.com/beganov/L0/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// lookups of many orders at once, every part of an order is selected with = ANY($1)
+const (
+	selectOrdersByIDs = `SELECT order_uid, track_number, entry, locale, customer_id, internal_signature,
+        delivery_service, shardkey, sm_id, date_created, oof_shard
+        FROM orders WHERE order_uid = ANY($1)`
+	selectDeliveriesByIDs = `SELECT order_uid, name, phone, zip, city, address, region, email
+            FROM deliveries WHERE order_uid = ANY($1)`
+	selectPaymentsByIDs = `SELECT order_uid, transaction, request_id, currency, provider, amount, payment_dt, bank,
+            delivery_cost, goods_total, custom_fee FROM payments WHERE order_uid = ANY($1)`
+	selectItemsByIDs = `SELECT order_uid, chrt_id, track_number, price, rid, name, sale, size,
+            total_price, nm_id, brand, status FROM items WHERE order_uid = ANY($1)`
+)
+
+// only orders matching all set fields
+type OrderFilter struct {
+	CustomerID      string
+	DeliveryService string
+}
+
+// orders by id in one round trip, ids that are not stored are absent from the map
+func GetOrdersFromDB(ctx context.Context, pool *pgxpool.Pool, orderIDs []string, selectTimeOut time.Duration) (map[string]models.Order, error) {
+	dbCtx, cancel := context.WithTimeout(ctx, selectTimeOut)
+	defer cancel()
+
+	batch := &pgx.Batch{}
+	batch.Queue(selectOrdersByIDs, orderIDs)
+	batch.Queue(selectDeliveriesByIDs, orderIDs)
+	batch.Queue(selectPaymentsByIDs, orderIDs)
+	batch.Queue(selectItemsByIDs, orderIDs)
+	br := pool.SendBatch(dbCtx, batch)
+	defer br.Close()
+
+	rows, _ := br.Query()
+	orders, err := collectOrders(rows)
+	if err != nil {
+		return nil, err
+	}
+	rows, _ = br.Query()
+	deliveries, err := collectDeliveries(rows)
+	if err != nil {
+		return nil, err
+	}
+	rows, _ = br.Query()
+	payments, err := collectPayments(rows)
+	if err != nil {
+		return nil, err
+	}
+	rows, _ = br.Query()
+	items, err := collectItems(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// delivery and payment are required, order without them is not returned
+	found := make(map[string]models.Order, len(orders))
+	for _, o := range orders {
+		d, okD := deliveries[o.OrderUID]
+		p, okP := payments[o.OrderUID]
+		if !okD || !okP {
+			metrics.DBErrorsTotal.Inc()
+			logger.Warn("order without delivery or payment skipped", "orderID", o.OrderUID)
+			continue
+		}
+		o.Delivery, o.Payment, o.Items = d, p, items[o.OrderUID]
+		found[o.OrderUID] = o
+	}
+	return found, nil
+}
+
+// page of orders without delivery, payment and items, oldest first,
+// starting after the order with id after (from the beginning when empty)
+func ListOrders(ctx context.Context, pool *pgxpool.Pool, filter OrderFilter, after string, limit int, selectTimeOut time.Duration) ([]models.Order, error) {
+	dbCtx, cancel := context.WithTimeout(ctx, selectTimeOut)
+	defer cancel()
+
+	rows, _ := pool.Query(dbCtx, `SELECT order_uid, track_number, entry, locale, customer_id, internal_signature,
+        delivery_service, shardkey, sm_id, date_created, oof_shard FROM orders
+		WHERE ($1 = '' OR customer_id = $1) AND ($2 = '' OR delivery_service = $2)
+		AND ($3 = '' OR (date_created, order_uid) > (SELECT date_created, order_uid FROM orders WHERE order_uid = $3))
+		ORDER BY date_created, order_uid LIMIT $4`, filter.CustomerID, filter.DeliveryService, after, limit)
+	return collectOrders(rows)
+}
+
+// deliveries by order id, orders without one are absent
+func GetDeliveries(ctx context.Context, pool *pgxpool.Pool, orderIDs []string, selectTimeOut time.Duration) (map[string]models.Delivery, error) {
+	dbCtx, cancel := context.WithTimeout(ctx, selectTimeOut)
+	defer cancel()
+	rows, _ := pool.Query(dbCtx, selectDeliveriesByIDs, orderIDs)
+	return collectDeliveries(rows)
+}
+
+// payments by order id, orders without one are absent
+func GetPayments(ctx context.Context, pool *pgxpool.Pool, orderIDs []string, selectTimeOut time.Duration) (map[string]models.Payment, error) {
+	dbCtx, cancel := context.WithTimeout(ctx, selectTimeOut)
+	defer cancel()
+	rows, _ := pool.Query(dbCtx, selectPaymentsByIDs, orderIDs)
+	return collectPayments(rows)
+}
+
+// items by order id
+func GetItems(ctx context.Context, pool *pgxpool.Pool, orderIDs []string, selectTimeOut time.Duration) (map[string][]models.Items, error) {
+	dbCtx, cancel := context.WithTimeout(ctx, selectTimeOut)
+	defer cancel()
+	rows, _ := pool.Query(dbCtx, selectItemsByIDs, orderIDs)
+	return collectItems(rows)
+}
+
+// query errors come out of rows, the collectors report them as scan errors
+
+func collectOrders(rows pgx.Rows) ([]models.Order, error) {
+	var orders []models.Order
+	var o models.Order
+	_, err := pgx.ForEachRow(rows, []any{&o.OrderUID, &o.TrackNumber, &o.Entry, &o.Locale,
+		&o.CustomerID, &o.InternalSignature, &o.DeliveryService, &o.Shardkey,
+		&o.SmID, &o.DateCreated, &o.OofShard}, func() error {
+		orders = append(orders, o)
+		return nil
+	})
+	if err != nil {
+		logger.Error(err, "failed to select orders from DB")
+		metrics.DBErrorsTotal.Inc()
+		return nil, err
+	}
+	return orders, nil
+}
+
+func collectDeliveries(rows pgx.Rows) (map[string]models.Delivery, error) {
+	deliveries := make(map[string]models.Delivery)
+	var id string
+	var d models.Delivery
+	_, err := pgx.ForEachRow(rows, []any{&id, &d.Name, &d.Phone, &d.Zip, &d.City, &d.Address, &d.Region, &d.Email}, func() error {
+		deliveries[id] = d
+		return nil
+	})
+	if err != nil {
+		logger.Error(err, "failed to select deliveries from DB")
+		metrics.DBErrorsTotal.Inc()
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func collectPayments(rows pgx.Rows) (map[string]models.Payment, error) {
+	payments := make(map[string]models.Payment)
+	var id string
+	var p models.Payment
+	var paymentDT time.Time
+	_, err := pgx.ForEachRow(rows, []any{&id, &p.Transaction, &p.RequestID, &p.Currency, &p.Provider, &p.Amount,
+		&paymentDT, &p.Bank, &p.DeliveryCost, &p.GoodsTotal, &p.CustomFee}, func() error {
+		p.PaymentDT = paymentDT.Unix()
+		payments[id] = p
+		return nil
+	})
+	if err != nil {
+		logger.Error(err, "failed to select payments from DB")
+		metrics.DBErrorsTotal.Inc()
+		return nil, err
+	}
+	return payments, nil
+}
+
+func collectItems(rows pgx.Rows) (map[string][]models.Items, error) {
+	items := make(map[string][]models.Items)
+	var id string
+	var it models.Items
+	_, err := pgx.ForEachRow(rows, []any{&id, &it.ChrtID, &it.TrackNumber, &it.Price, &it.Rid,
+		&it.Name, &it.Sale, &it.Size, &it.TotalPrice, &it.NmID, &it.Brand, &it.Status}, func() error {
+		items[id] = append(items[id], it)
+		return nil
+	})
+	if err != nil {
+		logger.Error(err, "failed to select items from DB")
+		metrics.DBErrorsTotal.Inc()
+		return nil, err
+	}
+	return items, nil
+}
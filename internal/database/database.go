@@ -2,18 +2,15 @@ package database
 
 import (
 	"context"
-	"database/sql"
 	"time"
 
 	"github.com/beganov/L0/internal/cache"
-	"github.com/beganov/L0/internal/config"
 	"github.com/beganov/L0/internal/logger"
 	"github.com/beganov/L0/internal/metrics"
 	"github.com/beganov/L0/internal/models"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
-	_ "github.com/lib/pq"
-	"github.com/pressly/goose"
 )
 
 func GetOrderFromDB(ctx context.Context, pool *pgxpool.Pool, orderID string, selectTimeOut time.Duration) (models.Order, error) {
@@ -96,34 +93,53 @@ func InitDB(ctx context.Context, dsn string) *pgxpool.Pool {
 	return pool
 }
 
-// run goose migrations
-func RunMigrations(dsn string) {
-	db, err := sql.Open("postgres", dsn)
+func SaveOrder(ctx context.Context, pool *pgxpool.Pool, order models.Order, insertTimeOut time.Duration) error {
+	dbCtx, cancel := context.WithTimeout(ctx, insertTimeOut)
+	defer cancel()
+	tx, err := pool.Begin(dbCtx)
 	if err != nil {
+		logger.Error(err, "failed to begin transaction")
 		metrics.DBErrorsTotal.Inc()
-		logger.Fatal(err, "failed to open db for migrations")
+		return err
 	}
-	defer db.Close()
+	defer tx.Rollback(context.Background())
 
-	if err := goose.Up(db, config.MigrationPath); err != nil {
-		metrics.DBErrorsTotal.Inc()
-		logger.Fatal(err, "failed to run migrations")
+	if _, err := insertOrder(dbCtx, tx, order); err != nil {
+		return err
 	}
+	return tx.Commit(dbCtx)
+}
+
+// save order unless it exists, false when it was already stored
+func SaveNewOrder(ctx context.Context, pool *pgxpool.Pool, order models.Order, insertTimeOut time.Duration) (bool, error) {
+	var inserted bool
+	err := inTx(ctx, pool, insertTimeOut, func(dbCtx context.Context, tx pgx.Tx) error {
+		var err error
+		inserted, err = insertOrder(dbCtx, tx, order)
+		return err
+	})
+	return inserted, err
 }
 
-func SaveOrder(ctx context.Context, pool *pgxpool.Pool, order models.Order) error {
-	dbCtx, cancel := context.WithTimeout(ctx, config.InsertTimeOut)
+// whether order is stored
+func OrderExists(ctx context.Context, pool *pgxpool.Pool, orderID string, selectTimeOut time.Duration) (bool, error) {
+	dbCtx, cancel := context.WithTimeout(ctx, selectTimeOut)
 	defer cancel()
-	tx, err := pool.Begin(dbCtx)
+
+	var exists bool
+	err := pool.QueryRow(dbCtx, `SELECT EXISTS(SELECT 1 FROM orders WHERE order_uid=$1)`, orderID).Scan(&exists)
 	if err != nil {
-		logger.Error(err, "failed to begin transaction")
 		metrics.DBErrorsTotal.Inc()
-		return err
+		return false, err
 	}
-	defer tx.Rollback(context.Background())
+	return exists, nil
+}
 
+// insert order with all its parts, existing rows are left as they are.
+// false when the order was already there
+func insertOrder(dbCtx context.Context, tx pgx.Tx, order models.Order) (bool, error) {
 	// orders
-	_, err = tx.Exec(dbCtx,
+	tag, err := tx.Exec(dbCtx,
 		`INSERT INTO orders(order_uid, track_number, entry, locale, customer_id, internal_signature, delivery_service, shardkey, sm_id, date_created, oof_shard)
          VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 		 ON CONFLICT DO NOTHING`, // already exists, skip
@@ -132,7 +148,7 @@ func SaveOrder(ctx context.Context, pool *pgxpool.Pool, order models.Order) erro
 	if err != nil {
 		logger.Error(err, "failed to insert order into DB")
 		metrics.DBErrorsTotal.Inc()
-		return err
+		return false, err
 	}
 
 	// deliveries
@@ -146,7 +162,7 @@ func SaveOrder(ctx context.Context, pool *pgxpool.Pool, order models.Order) erro
 	if err != nil {
 		logger.Error(err, "failed to insert delivery into DB")
 		metrics.DBErrorsTotal.Inc()
-		return err
+		return false, err
 	}
 
 	// payments
@@ -162,7 +178,7 @@ func SaveOrder(ctx context.Context, pool *pgxpool.Pool, order models.Order) erro
 	if err != nil {
 		logger.Error(err, "failed to insert payment into DB")
 		metrics.DBErrorsTotal.Inc()
-		return err
+		return false, err
 	}
 
 	// items
@@ -177,17 +193,60 @@ func SaveOrder(ctx context.Context, pool *pgxpool.Pool, order models.Order) erro
 		if err != nil {
 			logger.Error(err, "failed to insert items into DB")
 			metrics.DBErrorsTotal.Inc()
-			return err
+			return false, err
 		}
 	}
+	return tag.RowsAffected() > 0, nil
+}
 
-	return tx.Commit(dbCtx)
+// ids of up to limit orders, oldest first, following the order with id after
+// (from the beginning when empty)
+func ListOrderIDs(ctx context.Context, pool *pgxpool.Pool, after string, limit int, selectTimeOut time.Duration) ([]string, error) {
+	dbCtx, cancel := context.WithTimeout(ctx, selectTimeOut)
+	defer cancel()
+
+	rows, err := pool.Query(dbCtx, `SELECT order_uid FROM orders
+		WHERE $1 = '' OR (date_created, order_uid) > (SELECT date_created, order_uid FROM orders WHERE order_uid = $1)
+		ORDER BY date_created, order_uid LIMIT $2`, after, limit)
+	if err != nil {
+		metrics.DBErrorsTotal.Inc()
+		return nil, err
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		metrics.DBErrorsTotal.Inc()
+		return nil, err
+	}
+	return ids, nil
 }
 
-func LoadCacheFromDB(ctx context.Context, pool *pgxpool.Pool, cache *cache.OrderCache) error {
-	dbCtx, cancel := context.WithTimeout(ctx, config.SelectTimeOut)
+func LoadCacheFromDB(ctx context.Context, pool *pgxpool.Pool, cache *cache.OrderCache, selectTimeOut time.Duration) error {
+	return loadCache(ctx, pool, cache, selectTimeOut, `SELECT order_uid FROM orders`)
+}
+
+// load only orders newer than since, used to reconcile a restored snapshot
+func LoadCacheSince(ctx context.Context, pool *pgxpool.Pool, cache *cache.OrderCache, since time.Time, selectTimeOut time.Duration) error {
+	return loadCache(ctx, pool, cache, selectTimeOut,
+		`SELECT order_uid FROM orders WHERE date_created > $1 ORDER BY date_created`, since)
+}
+
+func loadCache(ctx context.Context, pool *pgxpool.Pool, cache *cache.OrderCache, selectTimeOut time.Duration, query string, args ...any) error {
+	dbCtx, cancel := context.WithTimeout(ctx, selectTimeOut)
 	defer cancel()
-	rows, err := pool.Query(dbCtx, `SELECT order_uid FROM orders`)
+	return forEachOrder(dbCtx, pool, selectTimeOut, func(o models.Order) error {
+		cache.Set(o.OrderUID, o)
+		return nil
+	}, query, args...)
+}
+
+// call fn for every stored order, oldest first. broken orders are logged and skipped,
+// error from fn stops iteration
+func ForEachOrder(ctx context.Context, pool *pgxpool.Pool, selectTimeOut time.Duration, fn func(models.Order) error) error {
+	return forEachOrder(ctx, pool, selectTimeOut, fn, `SELECT order_uid FROM orders ORDER BY date_created`)
+}
+
+func forEachOrder(ctx context.Context, pool *pgxpool.Pool, selectTimeOut time.Duration, fn func(models.Order) error, query string, args ...any) error {
+	rows, err := pool.Query(ctx, query, args...)
 	if err != nil {
 		logger.Error(err, "failed to select order_uid from DB")
 		metrics.DBErrorsTotal.Inc()
@@ -203,13 +262,15 @@ func LoadCacheFromDB(ctx context.Context, pool *pgxpool.Pool, cache *cache.Order
 			return err
 		}
 
-		o, err := GetOrderFromDB(dbCtx, pool, orderID, config.SelectTimeOut)
+		o, err := GetOrderFromDB(ctx, pool, orderID, selectTimeOut)
 		if err != nil {
 			metrics.DBErrorsTotal.Inc()
-			logger.Error(err, "error cache load")
+			logger.Error(err, "error order load")
 			continue
 		}
-		cache.Set(orderID, o)
+		if err := fn(o); err != nil {
+			return err
+		}
 	}
-	return nil
+	return rows.Err()
 }
@@ -0,0 +1,132 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/beganov/L0/internal/logger"
+	"github.com/beganov/L0/internal/metrics"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// what identifies the customer whose data is erased
+const (
+	EraseByCustomerID = "customer_id"
+	EraseByEmail      = "email"
+	EraseByPhone      = "phone" // compared by digits only
+)
+
+// delivery name of anonymized orders, the other personal fields become empty
+const ErasedName = "erased"
+
+// orders of one customer, locked until the transaction ends
+var selectErasable = map[string]string{
+	EraseByCustomerID: `SELECT order_uid FROM orders WHERE customer_id = $1 ORDER BY order_uid FOR UPDATE`,
+	EraseByEmail:      `SELECT order_uid FROM deliveries WHERE lower(email) = lower($1) ORDER BY order_uid FOR UPDATE`,
+	EraseByPhone: `SELECT order_uid FROM deliveries WHERE regexp_replace(phone, '\D', '', 'g') = $1
+        ORDER BY order_uid FOR UPDATE`,
+}
+
+// record of one erasure request, the key itself is stored only hashed
+type ErasureAudit struct {
+	Actor   string
+	KeyType string
+	KeyHash string
+	Reason  string
+	DryRun  bool
+}
+
+// customer_id given to anonymized orders, orders of one request stay grouped
+func Pseudonym(auditID int64) string {
+	return fmt.Sprintf("erased-%d", auditID)
+}
+
+// find orders of the customer and, unless dry run, anonymize their delivery data
+// and customer_id. payments and items are kept. the audit record is written in the
+// same transaction, returns its id and the affected orders
+func EraseCustomer(ctx context.Context, pool *pgxpool.Pool, key string, audit ErasureAudit, timeout time.Duration) (int64, []string, error) {
+	query, ok := selectErasable[audit.KeyType]
+	if !ok {
+		return 0, nil, fmt.Errorf("unknown erasure key %q", audit.KeyType)
+	}
+
+	dbCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	tx, err := pool.Begin(dbCtx)
+	if err != nil {
+		metrics.DBErrorsTotal.Inc()
+		return 0, nil, err
+	}
+	defer tx.Rollback(context.Background())
+
+	id, ids, err := eraseTx(dbCtx, tx, query, key, audit)
+	if err != nil {
+		logger.Error(err, "failed to erase customer data")
+		metrics.DBErrorsTotal.Inc()
+		return 0, nil, err
+	}
+	if err := tx.Commit(dbCtx); err != nil {
+		metrics.DBErrorsTotal.Inc()
+		return 0, nil, err
+	}
+	return id, ids, nil
+}
+
+func eraseTx(ctx context.Context, tx pgx.Tx, query, key string, audit ErasureAudit) (int64, []string, error) {
+	rows, _ := tx.Query(ctx, query, key)
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return 0, nil, err
+	}
+	if ids == nil {
+		ids = []string{}
+	}
+
+	var id int64
+	err = tx.QueryRow(ctx, `INSERT INTO erasure_audit (actor, key_type, key_hash, reason, dry_run, order_uids)
+        VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		audit.Actor, audit.KeyType, audit.KeyHash, audit.Reason, audit.DryRun, ids).Scan(&id)
+	if err != nil {
+		return 0, nil, err
+	}
+	if audit.DryRun || len(ids) == 0 {
+		return id, ids, nil
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE deliveries SET name = $2, phone = '', zip = '', address = '', email = ''
+        WHERE order_uid = ANY($1)`, ids, ErasedName)
+	if err != nil {
+		return 0, nil, err
+	}
+	_, err = tx.Exec(ctx, `UPDATE orders SET customer_id = $2 WHERE order_uid = ANY($1)`, ids, Pseudonym(id))
+	if err != nil {
+		return 0, nil, err
+	}
+	return id, ids, nil
+}
+
+// orders anonymized by one erasure request
+type Erasure struct {
+	ID        int64
+	OrderUIDs []string
+}
+
+// erasures recorded after the given audit id, oldest first. dry runs and
+// requests that found nothing are skipped
+func ErasuresSince(ctx context.Context, pool *pgxpool.Pool, after int64, timeout time.Duration) ([]Erasure, error) {
+	dbCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	rows, _ := pool.Query(dbCtx, `SELECT id, order_uids FROM erasure_audit
+        WHERE id > $1 AND NOT dry_run AND cardinality(order_uids) > 0 ORDER BY id`, after)
+	res, err := pgx.CollectRows(rows, pgx.RowToStructByPos[Erasure])
+	if err != nil {
+		metrics.DBErrorsTotal.Inc()
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,202 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"text/tabwriter"
+
+	"github.com/beganov/L0/internal/logger"
+	"github.com/beganov/L0/internal/metrics"
+	"github.com/beganov/L0/migrations"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
+)
+
+// directory for new migration files when no path is configured
+const defaultMigrationDir = "migrations"
+
+// DB schema was migrated by a newer binary than this one
+var ErrSchemaTooNew = errors.New("database schema is newer than this binary")
+
+// migrations from dir, or the ones embedded in the binary when dir is empty
+func migrationFS(dir string) fs.FS {
+	if dir == "" {
+		return migrations.FS
+	}
+	return os.DirFS(dir)
+}
+
+// goose provider on pgx stdlib, the advisory lock keeps concurrent
+// replicas from migrating at the same time
+func newProvider(dsn, dir string) (*goose.Provider, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	locker, err := lock.NewPostgresSessionLocker()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	p, err := goose.NewProvider(goose.DialectPostgres, db, migrationFS(dir), goose.WithSessionLocker(locker))
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// latest version known to the binary
+func knownVersion(p *goose.Provider) int64 {
+	sources := p.ListSources()
+	if len(sources) == 0 {
+		return 0
+	}
+	return sources[len(sources)-1].Version
+}
+
+// current DB version, fails when it is ahead of the binary
+func checkSchema(ctx context.Context, p *goose.Provider) (int64, error) {
+	version, err := p.GetDBVersion(ctx)
+	if err != nil {
+		return -1, err
+	}
+	if known := knownVersion(p); version > known {
+		return version, fmt.Errorf("%w: db version %d, latest known %d", ErrSchemaTooNew, version, known)
+	}
+	return version, nil
+}
+
+// apply pending migrations, returns schema version.
+// refuses to start against a schema from a newer release
+func RunMigrations(ctx context.Context, dsn, dir string) int64 {
+	p, err := newProvider(dsn, dir)
+	if err != nil {
+		metrics.DBErrorsTotal.Inc()
+		logger.Fatal(err, "failed to open db for migrations")
+	}
+	defer p.Close()
+
+	if _, err := checkSchema(ctx, p); err != nil {
+		metrics.DBErrorsTotal.Inc()
+		logger.Fatal(err, "refusing to run against database schema")
+	}
+
+	results, err := p.Up(ctx)
+	if err != nil {
+		metrics.DBErrorsTotal.Inc()
+		logger.Fatal(err, "failed to run migrations")
+	}
+	for _, r := range results {
+		logger.Info("migration applied", "version", r.Source.Version, "took", r.Duration.String())
+	}
+
+	version, err := p.GetDBVersion(ctx)
+	if err != nil {
+		metrics.DBErrorsTotal.Inc()
+		logger.Error(err, "failed to read migration version")
+		return -1
+	}
+	return version
+}
+
+// applied schema version without migrating, ErrSchemaTooNew when DB is ahead.
+// pending migrations are only logged, they are applied by a separate job
+func SchemaVersion(ctx context.Context, dsn, dir string) (int64, error) {
+	p, err := newProvider(dsn, dir)
+	if err != nil {
+		return -1, err
+	}
+	defer p.Close()
+
+	version, err := checkSchema(ctx, p)
+	if err != nil {
+		return version, err
+	}
+	if known := knownVersion(p); version < known {
+		logger.Warn("database schema is behind, migrations pending", "version", version, "latest", known)
+	}
+	return version, nil
+}
+
+// run migration command: up, down, status or create NAME.
+// status is written to w as a table
+func Migrate(ctx context.Context, dsn, dir, command string, w io.Writer, args ...string) error {
+	// create only writes a file, no DB needed
+	if command == "create" {
+		if len(args) == 0 {
+			return errors.New("create: migration name required")
+		}
+		if dir == "" {
+			dir = defaultMigrationDir
+		}
+		return goose.Create(nil, dir, args[0], "sql")
+	}
+
+	p, err := newProvider(dsn, dir)
+	if err != nil {
+		metrics.DBErrorsTotal.Inc()
+		return err
+	}
+	defer p.Close()
+
+	switch command {
+	case "up":
+		if _, err := checkSchema(ctx, p); err != nil {
+			return err
+		}
+		results, err := p.Up(ctx)
+		for _, r := range results {
+			fmt.Fprintf(w, "OK   %s (%s)\n", r.Source.Path, r.Duration)
+		}
+		return err
+	case "down":
+		r, err := p.Down(ctx)
+		if r != nil {
+			fmt.Fprintf(w, "OK   %s (%s)\n", r.Source.Path, r.Duration)
+		}
+		return err
+	case "status":
+		return writeStatus(ctx, p, w)
+	default:
+		return fmt.Errorf("unknown migrate command %q", command)
+	}
+}
+
+func writeStatus(ctx context.Context, p *goose.Provider, w io.Writer) error {
+	statuses, err := p.Status(ctx)
+	if err != nil {
+		return err
+	}
+	version, err := p.GetDBVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tSTATE\tAPPLIED AT\tSOURCE")
+	for _, st := range statuses {
+		applied := "-"
+		if !st.AppliedAt.IsZero() {
+			applied = st.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", st.Source.Version, st.State, applied, st.Source.Path)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "\ndb version %d, latest known %d\n", version, knownVersion(p))
+	if version > knownVersion(p) {
+		return fmt.Errorf("%w: db version %d", ErrSchemaTooNew, version)
+	}
+	return nil
+}
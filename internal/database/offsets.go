@@ -0,0 +1,111 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/beganov/L0/internal/logger"
+	"github.com/beganov/L0/internal/metrics"
+	"github.com/beganov/L0/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// offset was already moved past this message by another consumer,
+// the transaction is rolled back and the message must be skipped
+var ErrStaleOffset = errors.New("offset already processed")
+
+// position of a consumer group in one partition
+type Offset struct {
+	Group     string
+	Topic     string
+	Partition int
+	Next      int64 // offset of the next message to read, as in Kafka
+}
+
+// stored next offsets of a group by partition
+func LoadOffsets(ctx context.Context, pool *pgxpool.Pool, group, topic string, selectTimeOut time.Duration) (map[int]int64, error) {
+	dbCtx, cancel := context.WithTimeout(ctx, selectTimeOut)
+	defer cancel()
+
+	rows, err := pool.Query(dbCtx,
+		`SELECT partition, next_offset FROM consumer_offsets WHERE group_id=$1 AND topic=$2`, group, topic)
+	if err != nil {
+		metrics.DBErrorsTotal.Inc()
+		return nil, err
+	}
+	defer rows.Close()
+
+	offsets := make(map[int]int64)
+	for rows.Next() {
+		var partition int
+		var next int64
+		if err := rows.Scan(&partition, &next); err != nil {
+			metrics.DBErrorsTotal.Inc()
+			return nil, err
+		}
+		offsets[partition] = next
+	}
+	return offsets, rows.Err()
+}
+
+// save order and move the partition offset in one transaction
+func SaveOrderAt(ctx context.Context, pool *pgxpool.Pool, order models.Order, off Offset, insertTimeOut time.Duration) (bool, error) {
+	var inserted bool
+	err := inTx(ctx, pool, insertTimeOut, func(dbCtx context.Context, tx pgx.Tx) error {
+		if err := storeOffset(dbCtx, tx, off); err != nil {
+			return err
+		}
+		var err error
+		inserted, err = insertOrder(dbCtx, tx, order)
+		return err
+	})
+	return inserted, err
+}
+
+// move the partition offset past a message that carries no order
+func SaveOffset(ctx context.Context, pool *pgxpool.Pool, off Offset, insertTimeOut time.Duration) error {
+	return inTx(ctx, pool, insertTimeOut, func(dbCtx context.Context, tx pgx.Tx) error {
+		return storeOffset(dbCtx, tx, off)
+	})
+}
+
+func inTx(ctx context.Context, pool *pgxpool.Pool, timeout time.Duration, fn func(context.Context, pgx.Tx) error) error {
+	dbCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	tx, err := pool.Begin(dbCtx)
+	if err != nil {
+		logger.Error(err, "failed to begin transaction")
+		metrics.DBErrorsTotal.Inc()
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	if err := fn(dbCtx, tx); err != nil {
+		return err
+	}
+	return tx.Commit(dbCtx)
+}
+
+// offset only moves forward, a consumer that lost its partition
+// cannot write behind the new owner
+func storeOffset(dbCtx context.Context, tx pgx.Tx, off Offset) error {
+	tag, err := tx.Exec(dbCtx,
+		`INSERT INTO consumer_offsets(group_id, topic, partition, next_offset)
+         VALUES($1, $2, $3, $4)
+		 ON CONFLICT (group_id, topic, partition) DO UPDATE
+		 SET next_offset = EXCLUDED.next_offset, updated_at = now()
+		 WHERE consumer_offsets.next_offset < EXCLUDED.next_offset`,
+		off.Group, off.Topic, off.Partition, off.Next)
+	if err != nil {
+		logger.Error(err, "failed to store consumer offset")
+		metrics.DBErrorsTotal.Inc()
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrStaleOffset
+	}
+	return nil
+}
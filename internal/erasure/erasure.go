@@ -0,0 +1,160 @@
+// Package erasure removes one customer's personal data on request.
+package erasure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/beganov/L0/internal/cache"
+	"github.com/beganov/L0/internal/config"
+	"github.com/beganov/L0/internal/database"
+	"github.com/beganov/L0/internal/events"
+	"github.com/beganov/L0/internal/logger"
+	"github.com/beganov/L0/internal/metrics"
+	"github.com/beganov/L0/internal/models"
+	"github.com/beganov/L0/internal/pii"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrInvalidRequest wraps problems with the request itself
+var ErrInvalidRequest = errors.New("invalid erasure request")
+
+// exactly one of CustomerID, Email and Phone identifies the customer
+type Request struct {
+	CustomerID string `json:"customer_id,omitempty"`
+	Email      string `json:"email,omitempty"`
+	Phone      string `json:"phone,omitempty"`
+	Reason     string `json:"reason,omitempty"` // ticket or legal basis, kept in the audit
+	DryRun     bool   `json:"dry_run"`          // only find the orders, nothing changes
+}
+
+type Result struct {
+	AuditID int64    `json:"audit_id"`
+	DryRun  bool     `json:"dry_run"`
+	Orders  []string `json:"orders"`  // anonymized, or would be in dry run
+	Evicted int      `json:"evicted"` // copies dropped from the in-memory cache and stream history
+}
+
+// where the data lives, caches and hub are optional
+type Target struct {
+	DB    *pgxpool.Pool
+	Cache *cache.OrderCache
+	L2    *cache.RedisCache
+	Hub   *events.Hub
+}
+
+// key type and the normalized value to look for
+func (r Request) key() (string, string, error) {
+	n := 0
+	keyType, value := "", ""
+	if v := strings.TrimSpace(r.CustomerID); v != "" {
+		n++
+		keyType, value = database.EraseByCustomerID, v
+	}
+	if v := strings.TrimSpace(r.Email); v != "" {
+		n++
+		keyType, value = database.EraseByEmail, strings.ToLower(v)
+	}
+	if v := strings.TrimSpace(r.Phone); v != "" {
+		n++
+		keyType, value = database.EraseByPhone, digits(v)
+		if value == "" {
+			return "", "", fmt.Errorf("%w: phone has no digits", ErrInvalidRequest)
+		}
+	}
+	if n != 1 {
+		return "", "", fmt.Errorf("%w: exactly one of customer_id, email and phone is required", ErrInvalidRequest)
+	}
+	return keyType, value, nil
+}
+
+// problems with the request, before anything is looked up
+func (r Request) Validate() error {
+	_, _, err := r.key()
+	return err
+}
+
+func digits(s string) string {
+	return strings.Map(func(c rune) rune {
+		if unicode.IsDigit(c) {
+			return c
+		}
+		return -1
+	}, s)
+}
+
+// anonymize the customer's orders in Postgres and drop cached copies.
+// actor is who asked, it goes to the audit along with the hashed key
+func Erase(ctx context.Context, cfg *config.Config, target Target, actor string, req Request) (Result, error) {
+	keyType, value, err := req.key()
+	if err != nil {
+		return Result{}, err
+	}
+
+	audit := database.ErasureAudit{
+		Actor:   actor,
+		KeyType: keyType,
+		KeyHash: pii.Apply(pii.Hash, value),
+		Reason:  req.Reason,
+		DryRun:  req.DryRun,
+	}
+	id, ids, err := database.EraseCustomer(ctx, target.DB, value, audit, cfg.Postgres.InsertTimeout)
+	if err != nil {
+		metrics.ErasuresTotal.WithLabelValues("error").Inc()
+		return Result{}, err
+	}
+	res := Result{AuditID: id, DryRun: req.DryRun, Orders: ids}
+	if req.DryRun {
+		metrics.ErasuresTotal.WithLabelValues("dry_run").Inc()
+		logger.Info("Erasure dry run", "audit_id", id, "actor", actor, "orders", len(ids))
+		return res, nil
+	}
+
+	// readers that miss the cache get the anonymized rows from the DB,
+	// other instances pick the audit record up in their Watcher
+	evicted, err := evict(ctx, target, database.Erasure{ID: id, OrderUIDs: ids})
+	res.Evicted = evicted
+
+	metrics.ErasuresTotal.WithLabelValues("erased").Inc()
+	logger.Info("Customer data erased", "audit_id", id, "actor", actor, "orders", len(ids), "evicted", res.Evicted)
+	return res, err
+}
+
+// drop cached copies of erased orders, stream history gets anonymized ones
+func evict(ctx context.Context, target Target, e database.Erasure) (int, error) {
+	var errs []error
+	evicted := 0
+	erased := make(map[string]bool, len(e.OrderUIDs))
+	for _, oid := range e.OrderUIDs {
+		erased[oid] = true
+		if target.Cache != nil && target.Cache.Delete(oid) {
+			evicted++
+		}
+		if err := target.L2.Delete(ctx, oid); err != nil {
+			errs = append(errs, fmt.Errorf("L2 delete %s: %w", oid, err))
+		}
+	}
+	pseudonym := database.Pseudonym(e.ID)
+	evicted += target.Hub.Rewrite(func(o models.Order) (models.Order, bool) {
+		if !erased[o.OrderUID] {
+			return o, false
+		}
+		return Anonymize(o, pseudonym), true
+	})
+	return evicted, errors.Join(errs...)
+}
+
+// order as it reads from the DB after erasure
+func Anonymize(o models.Order, pseudonym string) models.Order {
+	o.CustomerID = pseudonym
+	o.Delivery.Name = database.ErasedName
+	o.Delivery.Phone = ""
+	o.Delivery.Zip = ""
+	o.Delivery.Address = ""
+	o.Delivery.Email = ""
+	return o
+}
@@ -0,0 +1,53 @@
+package erasure
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/beganov/L0/internal/database"
+	"github.com/beganov/L0/internal/models"
+)
+
+// --- Тест ключа удаления: ровно один ключ, нормализация email и телефона ---
+func TestRequest_Key(t *testing.T) {
+	cases := []struct {
+		req       Request
+		keyType   string
+		value     string
+		wantError bool
+	}{
+		{Request{CustomerID: " c1 "}, database.EraseByCustomerID, "c1", false},
+		{Request{Email: "Test@Gmail.com"}, database.EraseByEmail, "test@gmail.com", false},
+		{Request{Phone: "+972 (000) 00-00"}, database.EraseByPhone, "9720000000", false},
+		{Request{Phone: "n/a"}, "", "", true},
+		{Request{}, "", "", true},
+		{Request{CustomerID: "c1", Email: "a@b.c"}, "", "", true},
+	}
+	for _, tc := range cases {
+		keyType, value, err := tc.req.key()
+		if tc.wantError {
+			if !errors.Is(err, ErrInvalidRequest) {
+				t.Errorf("%+v: expected ErrInvalidRequest, got %v", tc.req, err)
+			}
+			continue
+		}
+		if err != nil || keyType != tc.keyType || value != tc.value {
+			t.Errorf("%+v: got %q %q %v", tc.req, keyType, value, err)
+		}
+	}
+}
+
+// --- Тест анонимизации: персональные данные удалены, финансовые сохранены ---
+func TestAnonymize(t *testing.T) {
+	o := models.Order{
+		OrderUID:   "o1",
+		CustomerID: "c1",
+		Delivery:   models.Delivery{Name: "Test Testov", Phone: "+9720000000", Email: "t@gmail.com", City: "Kiryat Mozkin"},
+		Payment:    models.Payment{Amount: 1817},
+	}
+	got := Anonymize(o, database.Pseudonym(7))
+	want := models.Delivery{Name: database.ErasedName, City: "Kiryat Mozkin"}
+	if got.Delivery != want || got.CustomerID != "erased-7" || got.Payment != o.Payment {
+		t.Errorf("unexpected %+v", got)
+	}
+}
@@ -0,0 +1,80 @@
+package erasure
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/beganov/L0/internal/config"
+	"github.com/beganov/L0/internal/database"
+	"github.com/beganov/L0/internal/logger"
+)
+
+// Watcher follows erasure_audit and evicts orders erased by other instances
+// or the CLI. the first Sync walks the whole audit, which also drops erased
+// orders a restored snapshot brought back
+type Watcher struct {
+	cfg      *config.Holder
+	target   Target
+	snapshot string // rewritten after evictions, empty when snapshots are off
+	last     int64  // newest audit id already handled
+	fetch    func(ctx context.Context, after int64) ([]database.Erasure, error)
+}
+
+// constructor
+func NewWatcher(cfg *config.Holder, target Target, snapshotPath string) *Watcher {
+	w := &Watcher{cfg: cfg, target: target, snapshot: snapshotPath}
+	w.fetch = func(ctx context.Context, after int64) ([]database.Erasure, error) {
+		return database.ErasuresSince(ctx, target.DB, after, w.cfg.Get().Postgres.SelectTimeout)
+	}
+	return w
+}
+
+// evict orders of erasures recorded since the previous call,
+// returns number of handled audit records
+func (w *Watcher) Sync(ctx context.Context) (int, error) {
+	erasures, err := w.fetch(ctx, w.last)
+	if err != nil {
+		return 0, err
+	}
+	if len(erasures) == 0 {
+		return 0, nil
+	}
+
+	evicted := 0
+	for _, e := range erasures {
+		n, err := evict(ctx, w.target, e)
+		if err != nil {
+			// L2 copies expire by redis.ttl, the record is not retried
+			logger.Error(fmt.Errorf("audit %d: %w", e.ID, err), "failed to evict erased orders from L2")
+		}
+		evicted += n
+		w.last = e.ID
+	}
+
+	// the file may hold copies this instance evicted earlier, it is rewritten anyway
+	if w.snapshot != "" && w.target.Cache != nil {
+		if err := w.target.Cache.SaveSnapshot(w.snapshot); err != nil {
+			logger.Error(err, "failed to rewrite cache snapshot after erasure")
+		}
+	}
+	logger.Info("Erased orders evicted", "erasures", len(erasures), "evicted", evicted)
+	return len(erasures), nil
+}
+
+// sync every interval until ctx is done
+func (w *Watcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := w.Sync(ctx); err != nil && ctx.Err() == nil {
+				logger.Error(err, "failed to check erasure audit")
+			}
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package erasure
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/beganov/L0/internal/cache"
+	"github.com/beganov/L0/internal/database"
+	"github.com/beganov/L0/internal/models"
+)
+
+// --- Тест восстановления из снапшота, снятого до удаления ---
+func TestWatcher_SnapshotAfterErasure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snap")
+
+	before := cache.NewOrderCache(10)
+	before.Set("o1", models.Order{OrderUID: "o1", Delivery: models.Delivery{Email: "t@gmail.com"}})
+	before.Set("o2", models.Order{OrderUID: "o2"})
+	if err := before.SaveSnapshot(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// o1 erased through another instance while this one was down
+	audit := []database.Erasure{{ID: 3, OrderUIDs: []string{"o1"}}}
+	restored := cache.NewOrderCache(10)
+	if _, _, err := restored.LoadSnapshot(path); err != nil {
+		t.Fatal(err)
+	}
+	w := &Watcher{target: Target{Cache: restored}, snapshot: path}
+	w.fetch = func(_ context.Context, after int64) ([]database.Erasure, error) {
+		var res []database.Erasure
+		for _, e := range audit {
+			if e.ID > after {
+				res = append(res, e)
+			}
+		}
+		return res, nil
+	}
+
+	if n, err := w.Sync(context.Background()); err != nil || n != 1 {
+		t.Fatalf("expected 1 erasure, got %d %v", n, err)
+	}
+	if _, ok := restored.Get("o1"); ok {
+		t.Error("erased order restored from snapshot")
+	}
+	if _, ok := restored.Get("o2"); !ok {
+		t.Error("other orders must stay cached")
+	}
+
+	orders, err := cache.ReadSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 1 || orders[0].OrderUID != "o2" {
+		t.Errorf("snapshot still holds erased order: %+v", orders)
+	}
+
+	// handled records are not fetched again
+	if n, _ := w.Sync(context.Background()); n != 0 {
+		t.Errorf("expected nothing new, got %d", n)
+	}
+}
@@ -0,0 +1,169 @@
+package events
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/beganov/L0/internal/models"
+)
+
+// stored order announced to watchers
+type Event struct {
+	ID    uint64 // increasing within the process
+	Order models.Order
+}
+
+// fan-out of stored orders to subscribers of this process.
+// subscriber that falls behind by more than its buffer is dropped,
+// last events are kept in a ring so a reconnecting client can resume
+type Hub struct {
+	mu    sync.Mutex
+	epoch string // tells ids of this process from those of earlier ones
+	next  uint64
+	subs  map[*Subscription]struct{}
+
+	ring  []Event // ring[(id-1) % len(ring)] holds event id
+	count int     // events kept in ring
+}
+
+// hub that keeps last history events for resuming, 0 keeps none
+func NewHub(history int) *Hub {
+	return &Hub{
+		epoch: strconv.FormatInt(time.Now().UnixNano(), 36),
+		subs:  make(map[*Subscription]struct{}),
+		ring:  make([]Event, history),
+	}
+}
+
+// id as sent to clients, "<epoch>-<id>". numbering starts over in every
+// process, so a bare number would point into another history after restart
+func (h *Hub) FormatID(id uint64) string {
+	return h.epoch + "-" + strconv.FormatUint(id, 10)
+}
+
+// event id from a client, false when it was not issued by this process
+func (h *Hub) ParseID(s string) (uint64, bool) {
+	epoch, num, ok := strings.Cut(s, "-")
+	if !ok || epoch != h.epoch {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(num, 10, 64)
+	return id, err == nil
+}
+
+type Subscription struct {
+	hub     *Hub
+	ch      chan Event
+	dropped bool // set under hub mutex before ch is closed
+}
+
+// events in publish order, closed on Close or when the subscriber is dropped
+func (s *Subscription) C() <-chan Event {
+	return s.ch
+}
+
+// whether channel was closed because the subscriber did not keep up
+func (s *Subscription) Dropped() bool {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	return s.dropped
+}
+
+// stop receiving, safe to call more than once
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	if _, ok := s.hub.subs[s]; ok {
+		delete(s.hub.subs, s)
+		close(s.ch)
+	}
+}
+
+// subscribe to orders published from now on
+func (h *Hub) Subscribe(buffer int) *Subscription {
+	s := &Subscription{hub: h, ch: make(chan Event, buffer)}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subs[s] = struct{}{}
+	return s
+}
+
+// subscribe and get kept events after lastID first. false means some events
+// after lastID are lost: they left the ring, did not fit the buffer or lastID
+// is ahead of this process. the events that are still kept are delivered anyway
+func (h *Hub) Resume(lastID uint64, buffer int) (*Subscription, bool) {
+	s := &Subscription{hub: h, ch: make(chan Event, buffer)}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	complete := lastID <= h.next
+	if complete && lastID < h.next {
+		oldest := h.next - uint64(h.count) + 1
+		from := max(lastID+1, oldest)
+		complete = from == lastID+1
+		// newest events win when they do not fit the buffer
+		if n := h.next - from + 1; n > uint64(buffer) {
+			from = h.next - uint64(buffer) + 1
+			complete = false
+		}
+		for id := from; id <= h.next; id++ {
+			s.ch <- h.ring[(id-1)%uint64(len(h.ring))]
+		}
+	}
+	h.subs[s] = struct{}{}
+	return s, complete
+}
+
+// announce stored order, never blocks. nil hub ignores it
+func (h *Hub) Publish(order models.Order) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.next++
+	ev := Event{ID: h.next, Order: order}
+	if len(h.ring) > 0 {
+		h.ring[(h.next-1)%uint64(len(h.ring))] = ev
+		h.count = min(h.count+1, len(h.ring))
+	}
+	for s := range h.subs {
+		select {
+		case s.ch <- ev:
+		default:
+			s.dropped = true
+			delete(h.subs, s)
+			close(s.ch)
+		}
+	}
+}
+
+// replace orders of kept events, fn returns the new order and whether it changed.
+// returns number of changed events, delivered ones are not recalled
+func (h *Hub) Rewrite(fn func(models.Order) (models.Order, bool)) int {
+	if h == nil {
+		return 0
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	n := 0
+	for id := h.next - uint64(h.count) + 1; id <= h.next && h.count > 0; id++ {
+		ev := &h.ring[(id-1)%uint64(len(h.ring))]
+		if o, ok := fn(ev.Order); ok {
+			ev.Order = o
+			n++
+		}
+	}
+	return n
+}
+
+// number of current subscribers
+func (h *Hub) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs)
+}
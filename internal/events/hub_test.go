@@ -0,0 +1,122 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/beganov/L0/internal/models"
+)
+
+// --- Тест хаба: отставший подписчик отключается, остальные получают события ---
+func TestHub_DropSlowSubscriber(t *testing.T) {
+	h := NewHub(0)
+	slow := h.Subscribe(1)
+	fast := h.Subscribe(2)
+
+	h.Publish(models.Order{OrderUID: "o1"})
+	<-fast.C()
+	h.Publish(models.Order{OrderUID: "o2"})
+
+	if !slow.Dropped() || h.Len() != 1 {
+		t.Fatalf("slow subscriber must be dropped, subscribers left %d", h.Len())
+	}
+	if ev := <-slow.C(); ev.Order.OrderUID != "o1" {
+		t.Errorf("buffered event must survive the drop, got %+v", ev)
+	}
+	if _, ok := <-slow.C(); ok {
+		t.Error("channel of dropped subscriber must be closed")
+	}
+	if ev := <-fast.C(); ev.ID != 2 || ev.Order.OrderUID != "o2" {
+		t.Errorf("unexpected event %+v", ev)
+	}
+
+	fast.Close()
+	fast.Close()
+	if h.Len() != 0 {
+		t.Errorf("closed subscriber still registered")
+	}
+}
+
+// --- Тест продолжения с Last-Event-ID: события из кольца, потерянные и чужие id ---
+func TestHub_Resume(t *testing.T) {
+	h := NewHub(3)
+	for _, id := range []string{"o1", "o2", "o3", "o4", "o5"} {
+		h.Publish(models.Order{OrderUID: id})
+	}
+
+	ids := func(s *Subscription) []uint64 {
+		var got []uint64
+		for len(s.C()) > 0 {
+			got = append(got, (<-s.C()).ID)
+		}
+		s.Close()
+		return got
+	}
+
+	cases := []struct {
+		name     string
+		lastID   uint64
+		buffer   int
+		want     []uint64
+		complete bool
+	}{
+		{"kept in ring", 3, 10, []uint64{4, 5}, true},
+		{"up to date", 5, 10, nil, true},
+		{"left the ring", 1, 10, []uint64{3, 4, 5}, false},
+		{"does not fit buffer", 2, 1, []uint64{5}, false},
+		{"id of another process", 9, 10, nil, false},
+	}
+	for _, tc := range cases {
+		s, complete := h.Resume(tc.lastID, tc.buffer)
+		got := ids(s)
+		if complete != tc.complete || len(got) != len(tc.want) {
+			t.Errorf("%s: got %v complete=%v, want %v complete=%v", tc.name, got, complete, tc.want, tc.complete)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+			}
+		}
+	}
+}
+
+// --- Тест номеров событий: номер другого процесса не принимается ---
+func TestHub_EventID(t *testing.T) {
+	h := NewHub(3)
+	if id, ok := h.ParseID(h.FormatID(42)); !ok || id != 42 {
+		t.Errorf("own id: got %d %v", id, ok)
+	}
+	for _, s := range []string{"42", "0-42", h.FormatID(42) + "x", ""} {
+		if _, ok := h.ParseID(s); ok {
+			t.Errorf("%q must not be accepted", s)
+		}
+	}
+}
+
+// --- Тест перезаписи истории: изменённые заказы отдаются при продолжении ---
+func TestHub_Rewrite(t *testing.T) {
+	h := NewHub(2)
+	for _, id := range []string{"o1", "o2", "o3"} {
+		h.Publish(models.Order{OrderUID: id, CustomerID: "c"})
+	}
+
+	n := h.Rewrite(func(o models.Order) (models.Order, bool) {
+		if o.OrderUID == "o1" || o.OrderUID == "o3" {
+			o.CustomerID = "erased"
+			return o, true
+		}
+		return o, false
+	})
+	if n != 1 {
+		t.Fatalf("only o3 is kept and matches, rewritten %d", n)
+	}
+
+	sub, _ := h.Resume(1, 10)
+	defer sub.Close()
+	if ev := <-sub.C(); ev.Order.OrderUID != "o2" || ev.Order.CustomerID != "c" {
+		t.Errorf("unexpected event %+v", ev)
+	}
+	if ev := <-sub.C(); ev.Order.OrderUID != "o3" || ev.Order.CustomerID != "erased" {
+		t.Errorf("unexpected event %+v", ev)
+	}
+}
@@ -0,0 +1,110 @@
+package gql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// items of one order assumed by the cost estimate
+const itemsPerOrder = 10
+
+// estimated cost and depth of the executed operation. every field with a selection
+// costs 1, orders counts its subtree first times, items counts its subtree
+// itemsPerOrder times. scalar and introspection fields are free
+type costAnalysis struct {
+	fragments map[string]*ast.FragmentDefinition
+	vars      map[string]any
+	defaults  map[string]ast.Value
+}
+
+func analyze(doc *ast.Document, operationName string, vars map[string]any) (cost, depth int, err error) {
+	a := costAnalysis{fragments: make(map[string]*ast.FragmentDefinition), vars: vars, defaults: make(map[string]ast.Value)}
+	var op *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		switch d := def.(type) {
+		case *ast.FragmentDefinition:
+			a.fragments[d.Name.Value] = d
+		case *ast.OperationDefinition:
+			if operationName == "" || (d.Name != nil && d.Name.Value == operationName) {
+				op = d
+			}
+		}
+	}
+	if op == nil {
+		return 0, 0, fmt.Errorf("unknown operation %q", operationName)
+	}
+	for _, v := range op.VariableDefinitions {
+		if v.DefaultValue != nil {
+			a.defaults[v.Variable.Name.Value] = v.DefaultValue
+		}
+	}
+	cost, depth = a.selection(op.SelectionSet, map[string]bool{})
+	return cost, depth, nil
+}
+
+func (a costAnalysis) selection(set *ast.SelectionSet, visiting map[string]bool) (cost, depth int) {
+	if set == nil {
+		return 0, 0
+	}
+	for _, sel := range set.Selections {
+		var c, d int
+		switch s := sel.(type) {
+		case *ast.Field:
+			c, d = a.field(s, visiting)
+		case *ast.InlineFragment:
+			c, d = a.selection(s.SelectionSet, visiting)
+		case *ast.FragmentSpread:
+			name := s.Name.Value
+			if f, ok := a.fragments[name]; ok && !visiting[name] {
+				visiting[name] = true
+				c, d = a.selection(f.SelectionSet, visiting)
+				delete(visiting, name)
+			}
+		}
+		cost += c
+		depth = max(depth, d)
+	}
+	return cost, depth
+}
+
+func (a costAnalysis) field(f *ast.Field, visiting map[string]bool) (cost, depth int) {
+	if f.SelectionSet == nil || strings.HasPrefix(f.Name.Value, "__") {
+		return 0, 0
+	}
+	cost, depth = a.selection(f.SelectionSet, visiting)
+	switch f.Name.Value {
+	case "orders":
+		cost *= max(a.intArg(f, "first", defaultFirst), 0)
+	case "items":
+		cost *= itemsPerOrder
+	}
+	return 1 + cost, 1 + depth
+}
+
+// literal or variable value of an int argument, def when it is not given
+func (a costAnalysis) intArg(f *ast.Field, name string, def int) int {
+	for _, arg := range f.Arguments {
+		if arg.Name.Value != name {
+			continue
+		}
+		value := arg.Value
+		if v, ok := value.(*ast.Variable); ok {
+			switch x := a.vars[v.Name.Value].(type) {
+			case float64: // JSON numbers
+				return int(x)
+			case int:
+				return x
+			}
+			value = a.defaults[v.Name.Value]
+		}
+		if iv, ok := value.(*ast.IntValue); ok {
+			if n, err := strconv.Atoi(iv.Value); err == nil {
+				return n
+			}
+		}
+	}
+	return def
+}
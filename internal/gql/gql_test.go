@@ -0,0 +1,138 @@
+package gql
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/beganov/L0/internal/auth"
+	"github.com/beganov/L0/internal/cache"
+	"github.com/beganov/L0/internal/config"
+	"github.com/beganov/L0/internal/models"
+	"github.com/beganov/L0/internal/storage"
+
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+// --- Тест оценки стоимости: списки умножают стоимость, фрагменты и переменные учитываются ---
+func TestAnalyze(t *testing.T) {
+	cases := []struct {
+		name      string
+		query     string
+		vars      map[string]any
+		wantCost  int
+		wantDepth int
+	}{
+		{"scalars only", `{ order(id: "o1") { order_uid customer_id } }`, nil, 1, 1},
+		{"nested parts", `{ order(id: "o1") { payment { amount } items { name } } }`, nil, 1 + 1 + 1, 2},
+		{"page of orders", `{ orders(first: 50) { nodes { order_uid items { name } } } }`, nil, 1 + 50*(1+1), 3},
+		{"default page", `{ orders { nodes { order_uid } } }`, nil, 1 + defaultFirst, 2},
+		{"variable", `query($n: Int) { orders(first: $n) { nodes { delivery { city } } } }`, map[string]any{"n": float64(10)}, 1 + 10*2, 3},
+		{"fragment", `{ orders(first: 2) { ...page } } fragment page on OrderConnection { nodes { payment { bank } } }`, nil, 1 + 2*2, 3},
+		{"introspection is free", `{ __schema { types { name fields { name } } } }`, nil, 0, 0},
+	}
+	for _, tc := range cases {
+		doc, err := parser.Parse(parser.ParseParams{Source: tc.query})
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		cost, depth, err := analyze(doc, "", tc.vars)
+		if err != nil || cost != tc.wantCost || depth != tc.wantDepth {
+			t.Errorf("%s: cost %d depth %d err %v, want cost %d depth %d", tc.name, cost, depth, err, tc.wantCost, tc.wantDepth)
+		}
+	}
+}
+
+// --- Тест dataloader: ключи одного уровня загружаются одним запросом ---
+func TestLoader_Batches(t *testing.T) {
+	var calls [][]string
+	l := newLoader("test", func(_ context.Context, ids []string) (map[string]int, error) {
+		calls = append(calls, ids)
+		return map[string]int{"a": 1, "b": 2}, nil
+	})
+	ctx := context.Background()
+	ident := func(v int, ok bool) any { return orNil(v, ok) }
+	thunks := []func() (any, error){l.load(ctx, "a", ident), l.load(ctx, "b", ident), l.load(ctx, "c", ident)}
+
+	var got []any
+	for _, th := range thunks {
+		v, err := th()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, v)
+	}
+	if len(calls) != 1 || len(calls[0]) != 3 {
+		t.Fatalf("expected one fetch of 3 keys, got %v", calls)
+	}
+	if got[0] != 1 || got[1] != 2 || got[2] != nil {
+		t.Errorf("unexpected values %v", got)
+	}
+}
+
+// --- Тест запроса: только выбранные поля заказа и отказ по лимиту стоимости ---
+func TestHandler_Order(t *testing.T) {
+	cfg := config.Default()
+	cfg.GraphQL.MaxCost = 50
+	holder := config.NewHolder(cfg)
+	oc := cache.NewOrderCache(10)
+	oc.Set("o1", models.Order{OrderUID: "o1", Payment: models.Payment{Amount: 1817, Bank: "alpha"}, Items: []models.Items{{Name: "Mascaras"}}})
+	h := NewHandler(holder, oc, storage.NewStorage(holder, oc, nil, nil), nil)
+
+	post := func(query string) map[string]any {
+		body, _ := json.Marshal(map[string]any{"query": query})
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body))))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d %s", w.Code, w.Body)
+		}
+		if origin := w.Header().Get("Access-Control-Allow-Origin"); origin != "" {
+			t.Errorf("unexpected CORS header %q", origin)
+		}
+		var res map[string]any
+		if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	res := post(`{ order(id: "o1") { payment { amount } items { name } } }`)
+	got, _ := json.Marshal(res["data"])
+	if want := `{"order":{"items":[{"name":"Mascaras"}],"payment":{"amount":1817}}}`; string(got) != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	res = post(`{ orders(first: 100) { nodes { order_uid } } }`)
+	if res["data"] != nil || !strings.Contains(mustJSON(res["errors"]), "exceeds limit 50") {
+		t.Errorf("expensive query must be rejected before execution, got %v", res)
+	}
+}
+
+// --- Тест фильтра orders(customer_id:) для viewer: отказ до обращения к БД ---
+func TestHandler_ViewerCustomerFilter(t *testing.T) {
+	holder := config.NewHolder(config.Default())
+	oc := cache.NewOrderCache(10)
+	h := NewHandler(holder, oc, storage.NewStorage(holder, oc, nil, nil), nil)
+
+	body, _ := json.Marshal(map[string]any{"query": `{ orders(customer_id: "c1") { nodes { order_uid } } }`})
+	r := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body)))
+	r = r.WithContext(auth.WithPrincipal(r.Context(), auth.Principal{Subject: "board", Role: auth.RoleViewer, Method: "apikey"}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	var res map[string]any
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(mustJSON(res["errors"]), "customer_id filter is not available to role viewer") {
+		t.Errorf("viewer filter by raw customer id must be refused, got %v", res)
+	}
+}
+
+func mustJSON(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -0,0 +1,134 @@
+package gql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/beganov/L0/internal/auth"
+	"github.com/beganov/L0/internal/cache"
+	"github.com/beganov/L0/internal/config"
+	"github.com/beganov/L0/internal/logger"
+	"github.com/beganov/L0/internal/metrics"
+	"github.com/beganov/L0/internal/storage"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// request body limit of POST /graphql
+const maxQueryBody = 1 << 20
+
+// GraphQL over orders, reads go through the same cache tiers as the JSON API
+type Handler struct {
+	cfg    *config.Holder // limits may change on reload
+	schema graphql.Schema
+	cache  *cache.OrderCache
+	store  *storage.Storage
+	db     *pgxpool.Pool
+}
+
+// schema is static, failing to build it is a programming error
+func NewHandler(cfg *config.Holder, cache *cache.OrderCache, store *storage.Storage, db *pgxpool.Pool) *Handler {
+	schema, err := newSchema()
+	if err != nil {
+		panic(fmt.Sprintf("graphql schema: %v", err))
+	}
+	return &Handler{cfg: cfg, schema: schema, cache: cache, store: store, db: db}
+}
+
+type request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// ServeHTTP runs a query from POST JSON body or GET parameters. query errors,
+// including exceeded depth and cost limits, are answered with 200 and errors
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	metrics.HttpRequestsTotal.Inc()
+	req, err := readRequest(w, r)
+	if err != nil {
+		metrics.HttpErrorsTotal.Inc()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	res := h.execute(r.Context(), req)
+	// no CORS header, the endpoint is authenticated and must not be readable from any origin
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		logger.Error(err, "cannot encode json")
+	}
+}
+
+func readRequest(w http.ResponseWriter, r *http.Request) (request, error) {
+	var req request
+	if r.Method == http.MethodGet {
+		q := r.URL.Query()
+		req.Query, req.OperationName = q.Get("query"), q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				return req, fmt.Errorf("invalid variables: %w", err)
+			}
+		}
+	} else if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxQueryBody)).Decode(&req); err != nil {
+		return req, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if req.Query == "" {
+		return req, fmt.Errorf("query is required")
+	}
+	return req, nil
+}
+
+// parse, validate, check limits, then execute
+func (h *Handler) execute(ctx context.Context, req request) *graphql.Result {
+	cfg := h.cfg.Get().GraphQL
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{Body: []byte(req.Query), Name: "GraphQL request"})})
+	if err != nil {
+		metrics.GraphqlRequestsTotal.WithLabelValues("invalid").Inc()
+		return &graphql.Result{Errors: gqlerrors.FormatErrors(err)}
+	}
+	if v := graphql.ValidateDocument(&h.schema, doc, nil); !v.IsValid {
+		metrics.GraphqlRequestsTotal.WithLabelValues("invalid").Inc()
+		return &graphql.Result{Errors: v.Errors}
+	}
+
+	cost, depth, err := analyze(doc, req.OperationName, req.Variables)
+	if err != nil {
+		metrics.GraphqlRequestsTotal.WithLabelValues("invalid").Inc()
+		return &graphql.Result{Errors: gqlerrors.FormatErrors(err)}
+	}
+	metrics.GraphqlQueryCost.Observe(float64(cost))
+	if depth > cfg.MaxDepth {
+		metrics.GraphqlRequestsTotal.WithLabelValues("rejected").Inc()
+		return &graphql.Result{Errors: gqlerrors.FormatErrors(fmt.Errorf("query depth %d exceeds limit %d", depth, cfg.MaxDepth))}
+	}
+	if cost > cfg.MaxCost {
+		metrics.GraphqlRequestsTotal.WithLabelValues("rejected").Inc()
+		return &graphql.Result{Errors: gqlerrors.FormatErrors(fmt.Errorf("query cost %d exceeds limit %d", cost, cfg.MaxCost))}
+	}
+
+	st := &requestState{
+		h:       h,
+		loaders: newLoaders(h.cache, h.db, h.cfg.Get().Postgres.SelectTimeout),
+		maxPage: cfg.MaxPage,
+		role:    auth.CallerRole(ctx).String(),
+	}
+	res := graphql.Execute(graphql.ExecuteParams{
+		Schema:        h.schema,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       context.WithValue(ctx, ctxKey{}, st),
+	})
+	result := "ok"
+	if res.HasErrors() {
+		result = "error"
+	}
+	metrics.GraphqlRequestsTotal.WithLabelValues(result).Inc()
+	return res
+}
@@ -0,0 +1,113 @@
+package gql
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/beganov/L0/internal/cache"
+	"github.com/beganov/L0/internal/database"
+	"github.com/beganov/L0/internal/metrics"
+	"github.com/beganov/L0/internal/models"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// batches loads of one kind within a request. resolvers register keys and
+// return thunks, executor runs the thunks of one level after all resolvers
+// of that level, so the first thunk fetches every registered key at once
+type loader[V any] struct {
+	mu      sync.Mutex
+	name    string // metric label
+	fetch   func(ctx context.Context, ids []string) (map[string]V, error)
+	pending []string
+	results map[string]V
+	errs    map[string]error // keys of a failed batch
+}
+
+func newLoader[V any](name string, fetch func(context.Context, []string) (map[string]V, error)) *loader[V] {
+	return &loader[V]{name: name, fetch: fetch, results: make(map[string]V), errs: make(map[string]error)}
+}
+
+// thunk returning the value of id and whether it exists
+func (l *loader[V]) load(ctx context.Context, id string, resolve func(V, bool) any) func() (any, error) {
+	l.mu.Lock()
+	_, done := l.results[id]
+	if !done {
+		l.pending = append(l.pending, id)
+	}
+	l.mu.Unlock()
+
+	return func() (any, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if len(l.pending) > 0 {
+			ids := l.pending
+			l.pending = nil
+			metrics.GraphqlLoaderBatches.WithLabelValues(l.name).Inc()
+			res, err := l.fetch(ctx, ids)
+			for _, k := range ids {
+				if err != nil {
+					l.errs[k] = err
+				} else if v, ok := res[k]; ok {
+					l.results[k] = v
+				}
+			}
+		}
+		if err := l.errs[id]; err != nil {
+			return nil, err
+		}
+		v, ok := l.results[id]
+		return resolve(v, ok), nil
+	}
+}
+
+// loaders of one request, parts of cached orders never reach the DB
+type loaders struct {
+	deliveries *loader[models.Delivery]
+	payments   *loader[models.Payment]
+	items      *loader[[]models.Items]
+}
+
+func newLoaders(c *cache.OrderCache, db *pgxpool.Pool, selectTimeOut time.Duration) *loaders {
+	return &loaders{
+		deliveries: newLoader("delivery", cachedOr(c, func(o models.Order) models.Delivery { return o.Delivery },
+			func(ctx context.Context, ids []string) (map[string]models.Delivery, error) {
+				return database.GetDeliveries(ctx, db, ids, selectTimeOut)
+			})),
+		payments: newLoader("payment", cachedOr(c, func(o models.Order) models.Payment { return o.Payment },
+			func(ctx context.Context, ids []string) (map[string]models.Payment, error) {
+				return database.GetPayments(ctx, db, ids, selectTimeOut)
+			})),
+		items: newLoader("items", cachedOr(c, func(o models.Order) []models.Items { return o.Items },
+			func(ctx context.Context, ids []string) (map[string][]models.Items, error) {
+				return database.GetItems(ctx, db, ids, selectTimeOut)
+			})),
+	}
+}
+
+// fetch that takes the part from cached orders and asks the DB only for the rest
+func cachedOr[V any](c *cache.OrderCache, part func(models.Order) V, load func(context.Context, []string) (map[string]V, error)) func(context.Context, []string) (map[string]V, error) {
+	return func(ctx context.Context, ids []string) (map[string]V, error) {
+		res := make(map[string]V, len(ids))
+		var misses []string
+		for _, id := range ids {
+			if o, ok := c.Get(id); ok {
+				res[id] = part(o)
+				continue
+			}
+			misses = append(misses, id)
+		}
+		if len(misses) == 0 {
+			return res, nil
+		}
+		stored, err := load(ctx, misses)
+		if err != nil {
+			return nil, err
+		}
+		for id, v := range stored {
+			res[id] = v
+		}
+		return res, nil
+	}
+}
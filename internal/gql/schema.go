@@ -0,0 +1,220 @@
+package gql
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/beganov/L0/internal/database"
+	"github.com/beganov/L0/internal/logger"
+	"github.com/beganov/L0/internal/models"
+	"github.com/beganov/L0/internal/pii"
+	"github.com/beganov/L0/internal/storage"
+
+	"github.com/graphql-go/graphql"
+)
+
+// page size of orders when first is not given
+const defaultFirst = 20
+
+// order as GraphQL source. full orders come from the cache tiers with all parts,
+// listed ones hold only the orders row and load the rest through loaders
+type orderNode struct {
+	order models.Order
+	full  bool
+}
+
+// scalar fields resolve by json tag of models.Order
+func (n *orderNode) Resolve(p graphql.ResolveParams) (any, error) {
+	p.Source = n.order
+	return graphql.DefaultResolveFn(p)
+}
+
+type connection struct {
+	Nodes       []*orderNode `json:"nodes"`
+	EndCursor   *string      `json:"end_cursor"`
+	HasNextPage bool         `json:"has_next_page"`
+}
+
+type ctxKey struct{}
+
+// request scoped state of resolvers
+type requestState struct {
+	h       *Handler
+	loaders *loaders
+	maxPage int
+	role    string // personal data is masked for it
+}
+
+func stateFrom(ctx context.Context) *requestState {
+	return ctx.Value(ctxKey{}).(*requestState)
+}
+
+func scalars(names ...string) graphql.Fields {
+	fields := graphql.Fields{}
+	for _, n := range names {
+		fields[n] = &graphql.Field{Type: graphql.String}
+	}
+	return fields
+}
+
+func ints(fields graphql.Fields, names ...string) graphql.Fields {
+	for _, n := range names {
+		fields[n] = &graphql.Field{Type: graphql.Int}
+	}
+	return fields
+}
+
+// field names follow the JSON API, so frontends keep their models
+func newSchema() (graphql.Schema, error) {
+	delivery := graphql.NewObject(graphql.ObjectConfig{
+		Name:   "Delivery",
+		Fields: scalars("name", "phone", "zip", "city", "address", "region", "email"),
+	})
+	payment := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Payment",
+		Fields: ints(scalars("transaction", "request_id", "currency", "provider", "bank"),
+			"amount", "payment_dt", "delivery_cost", "goods_total", "custom_fee"),
+	})
+	item := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Item",
+		Fields: ints(scalars("track_number", "rid", "name", "size", "brand"),
+			"chrt_id", "price", "sale", "total_price", "nm_id", "status"),
+	})
+
+	orderFields := ints(scalars("order_uid", "track_number", "entry", "locale", "internal_signature",
+		"customer_id", "delivery_service", "shardkey", "oof_shard"), "sm_id")
+	orderFields["date_created"] = &graphql.Field{Type: graphql.DateTime}
+	orderFields["delivery"] = &graphql.Field{Type: delivery, Resolve: func(p graphql.ResolveParams) (any, error) {
+		n := p.Source.(*orderNode)
+		if n.full {
+			return n.order.Delivery, nil
+		}
+		st := stateFrom(p.Context)
+		return st.loaders.deliveries.load(p.Context, n.order.OrderUID, func(d models.Delivery, ok bool) any {
+			return orNil(pii.Mask(d, st.role), ok)
+		}), nil
+	}}
+	orderFields["payment"] = &graphql.Field{Type: payment, Resolve: func(p graphql.ResolveParams) (any, error) {
+		n := p.Source.(*orderNode)
+		if n.full {
+			return n.order.Payment, nil
+		}
+		return stateFrom(p.Context).loaders.payments.load(p.Context, n.order.OrderUID, orNil[models.Payment]), nil
+	}}
+	orderFields["items"] = &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(item))), Resolve: func(p graphql.ResolveParams) (any, error) {
+		n := p.Source.(*orderNode)
+		if n.full {
+			return n.order.Items, nil
+		}
+		return stateFrom(p.Context).loaders.items.load(p.Context, n.order.OrderUID, func(items []models.Items, _ bool) any {
+			if items == nil {
+				return []models.Items{}
+			}
+			return items
+		}), nil
+	}}
+	order := graphql.NewObject(graphql.ObjectConfig{Name: "Order", Fields: orderFields})
+
+	conn := graphql.NewObject(graphql.ObjectConfig{
+		Name: "OrderConnection",
+		Fields: graphql.Fields{
+			"nodes":         &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(order)))},
+			"end_cursor":    &graphql.Field{Type: graphql.String},
+			"has_next_page": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+		},
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"order": &graphql.Field{
+				Type:        order,
+				Description: "Order by id, null if there is no such order",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: resolveOrder,
+			},
+			"orders": &graphql.Field{
+				Type:        graphql.NewNonNull(conn),
+				Description: "Stored orders, oldest first",
+				Args: graphql.FieldConfigArgument{
+					"first":            &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultFirst},
+					"after":            &graphql.ArgumentConfig{Type: graphql.String},
+					"customer_id":      &graphql.ArgumentConfig{Type: graphql.String},
+					"delivery_service": &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Resolve: resolveOrders,
+			},
+		},
+	})
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query})
+}
+
+// missing delivery or payment is null
+func orNil[V any](v V, ok bool) any {
+	if !ok {
+		return nil
+	}
+	return v
+}
+
+func resolveOrder(p graphql.ResolveParams) (any, error) {
+	st := stateFrom(p.Context)
+	order, err := st.h.store.Get(p.Context, p.Args["id"].(string))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		logger.Error(err, "GraphQL order lookup failed")
+		return nil, errors.New("storage unavailable")
+	}
+	return &orderNode{order: pii.Mask(order, st.role), full: true}, nil
+}
+
+// cursor is the last order_uid of the page, as page_token of gRPC ListOrders
+func resolveOrders(p graphql.ResolveParams) (any, error) {
+	st := stateFrom(p.Context)
+	first, _ := p.Args["first"].(int)
+	if first < 0 {
+		return nil, errors.New("first must not be negative")
+	}
+	if first > st.maxPage {
+		return nil, fmt.Errorf("first must not exceed %d", st.maxPage)
+	}
+	var after []byte
+	if cursor, ok := p.Args["after"].(string); ok {
+		var err error
+		if after, err = base64.RawURLEncoding.DecodeString(cursor); err != nil {
+			return nil, errors.New("invalid cursor")
+		}
+	}
+	filter := database.OrderFilter{}
+	filter.CustomerID, _ = p.Args["customer_id"].(string)
+	filter.DeliveryService, _ = p.Args["delivery_service"].(string)
+	// the DB holds raw ids only, a role that sees them masked could probe raw ids otherwise
+	if id := filter.CustomerID; id != "" && pii.Mask(models.Order{CustomerID: id}, st.role).CustomerID != id {
+		return nil, fmt.Errorf("customer_id filter is not available to role %s", st.role)
+	}
+
+	cfg := st.h.cfg.Get()
+	// one more row tells whether there is a next page
+	orders, err := database.ListOrders(p.Context, st.h.db, filter, string(after), first+1, cfg.Postgres.SelectTimeout)
+	if err != nil {
+		return nil, errors.New("storage unavailable") // logged by database
+	}
+	res := &connection{HasNextPage: len(orders) > first, Nodes: []*orderNode{}}
+	if res.HasNextPage {
+		orders = orders[:first]
+	}
+	for _, o := range orders {
+		res.Nodes = append(res.Nodes, &orderNode{order: pii.Mask(o, st.role)})
+	}
+	if len(orders) > 0 {
+		cursor := base64.RawURLEncoding.EncodeToString([]byte(orders[len(orders)-1].OrderUID))
+		res.EndCursor = &cursor
+	}
+	return res, nil
+}
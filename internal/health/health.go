@@ -0,0 +1,200 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/beganov/L0/internal/broker"
+	"github.com/beganov/L0/internal/cache"
+	"github.com/beganov/L0/internal/config"
+	"github.com/beganov/L0/internal/lifecycle"
+	"github.com/beganov/L0/internal/logger"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	statusUp   = "up"
+	statusDown = "down"
+
+	consumerName = "consumer" // component name of both consumers
+)
+
+// dependency checks behind /livez, /readyz and /healthz
+type Checker struct {
+	cfg     *config.Holder
+	db      *pgxpool.Pool
+	control *broker.Control
+	cache   *cache.OrderCache
+	group   *lifecycle.Group
+	ping    func(ctx context.Context) error // db.Ping, replaced in tests
+
+	cacheWarm        atomic.Bool
+	migrationVersion atomic.Int64
+}
+
+// constructor, control is nil when this instance does not consume
+func NewChecker(cfg *config.Holder, db *pgxpool.Pool, control *broker.Control, cache *cache.OrderCache, group *lifecycle.Group) *Checker {
+	c := &Checker{cfg: cfg, db: db, control: control, cache: cache, group: group, ping: db.Ping}
+	c.migrationVersion.Store(-1)
+	return c
+}
+
+// mark cache warm-up finished
+func (c *Checker) SetCacheWarm() {
+	c.cacheWarm.Store(true)
+}
+
+// applied schema version
+func (c *Checker) SetMigrationVersion(v int64) {
+	c.migrationVersion.Store(v)
+}
+
+type Report struct {
+	Status     string             `json:"status"`
+	Postgres   PostgresReport     `json:"postgres"`
+	Kafka      KafkaReport        `json:"kafka"`
+	Cache      CacheReport        `json:"cache"`
+	Migrations MigrationReport    `json:"migrations"`
+	Components []lifecycle.Status `json:"components"`
+}
+
+type PostgresReport struct {
+	Status        string `json:"status"`
+	Error         string `json:"error,omitempty"`
+	PingMs        int64  `json:"ping_ms"`
+	TotalConns    int32  `json:"total_conns"`
+	IdleConns     int32  `json:"idle_conns"`
+	AcquiredConns int32  `json:"acquired_conns"`
+	MaxConns      int32  `json:"max_conns"`
+}
+
+type KafkaReport struct {
+	Topic      string                  `json:"topic"`
+	Paused     bool                    `json:"paused"`
+	Lag        int64                   `json:"lag"` // sum over assigned partitions
+	Partitions []broker.PartitionStats `json:"partitions"`
+}
+
+type CacheReport struct {
+	Status   string `json:"status"`
+	Warm     bool   `json:"warm"`
+	Size     int    `json:"size"`
+	Capacity int    `json:"capacity"`
+}
+
+type MigrationReport struct {
+	Version int64 `json:"version"`
+}
+
+// run all checks, status is up only when service may take traffic
+func (c *Checker) Check(ctx context.Context) Report {
+	cfg := c.cfg.Get()
+	ctx, cancel := context.WithTimeout(ctx, cfg.HTTP.Timeout)
+	defer cancel()
+
+	r := Report{
+		Status:     statusUp,
+		Postgres:   c.checkPostgres(ctx),
+		Kafka:      c.kafkaStats(cfg),
+		Cache:      c.checkCache(),
+		Migrations: MigrationReport{Version: c.migrationVersion.Load()},
+		Components: c.group.Status(ctx),
+	}
+	if r.Postgres.Status != statusUp || r.Cache.Status != statusUp {
+		r.Status = statusDown
+	}
+	// consumer health includes broker reachability
+	consumer := false
+	for _, comp := range r.Components {
+		if comp.State != lifecycle.StateRunning || comp.Error != "" {
+			r.Status = statusDown
+		}
+		consumer = consumer || comp.Name == consumerName
+	}
+	// a consuming instance is not ready before its consumer is added to the group
+	if c.control != nil && !consumer {
+		r.Status = statusDown
+	}
+	return r
+}
+
+func (c *Checker) checkPostgres(ctx context.Context) PostgresReport {
+	r := PostgresReport{Status: statusUp}
+	if c.db != nil {
+		st := c.db.Stat()
+		r.TotalConns, r.IdleConns = st.TotalConns(), st.IdleConns()
+		r.AcquiredConns, r.MaxConns = st.AcquiredConns(), st.MaxConns()
+	}
+
+	start := time.Now()
+	if err := c.ping(ctx); err != nil {
+		r.Status, r.Error = statusDown, err.Error()
+	}
+	r.PingMs = time.Since(start).Milliseconds()
+	return r
+}
+
+func (c *Checker) kafkaStats(cfg *config.Config) KafkaReport {
+	r := KafkaReport{Topic: cfg.Kafka.Topic}
+	if cfg.Broker.Type == config.BrokerNATS {
+		r.Topic = cfg.NATS.Subject
+	}
+	if c.control == nil {
+		return r // api-only instance
+	}
+
+	ctl := c.control.Report()
+	r.Paused, r.Partitions = ctl.Paused, ctl.Partitions
+	for _, p := range ctl.Partitions {
+		r.Lag += p.Lag
+	}
+	return r
+}
+
+func (c *Checker) checkCache() CacheReport {
+	r := CacheReport{
+		Status:   statusUp,
+		Warm:     c.cacheWarm.Load(),
+		Size:     c.cache.Len(),
+		Capacity: c.cache.Cap(),
+	}
+	if !r.Warm {
+		r.Status = statusDown
+	}
+	return r
+}
+
+// Livez answers while the process is able to serve HTTP at all
+func (c *Checker) Livez(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte("ok\n"))
+}
+
+// Readyz fails until cache is warm, all components run and dependencies answer
+func (c *Checker) Readyz(w http.ResponseWriter, r *http.Request) {
+	report := c.Check(r.Context())
+	w.Header().Set("Content-Type", "text/plain")
+	if report.Status != statusUp {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("not ready\n"))
+		return
+	}
+	w.Write([]byte("ok\n"))
+}
+
+// Healthz returns detailed report of every dependency
+func (c *Checker) Healthz(w http.ResponseWriter, r *http.Request) {
+	report := c.Check(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status != statusUp {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		logger.Error(err, "cannot encode health report")
+	}
+}
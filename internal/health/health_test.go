@@ -0,0 +1,194 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/beganov/L0/internal/broker"
+	"github.com/beganov/L0/internal/cache"
+	"github.com/beganov/L0/internal/config"
+	"github.com/beganov/L0/internal/lifecycle"
+	"github.com/beganov/L0/internal/models"
+)
+
+// компонент с заданной ошибкой запуска и ответом на проверку здоровья
+type fakeComponent struct {
+	name   string
+	fail   error // Start returns it at once, the group gives up after one restart
+	health error
+}
+
+func (c *fakeComponent) Name() string { return c.name }
+
+func (c *fakeComponent) Start(ctx context.Context) error {
+	if c.fail != nil {
+		return c.fail
+	}
+	<-ctx.Done()
+	return nil
+}
+
+func (c *fakeComponent) Stop(ctx context.Context) error   { return nil }
+func (c *fakeComponent) Health(ctx context.Context) error { return c.health }
+
+// checker without a pool, components are started and settled before it is returned
+func testChecker(t *testing.T, pingErr error, warm bool, comps ...*fakeComponent) *Checker {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	group := lifecycle.NewGroup()
+	want := make(map[string]lifecycle.State, len(comps))
+	for _, comp := range comps {
+		group.Add(comp, lifecycle.Policy{MaxRestarts: 1, BackoffMin: time.Millisecond, BackoffMax: time.Millisecond})
+		want[comp.name] = lifecycle.StateRunning
+		if comp.fail != nil {
+			want[comp.name] = lifecycle.StateFailed
+		}
+	}
+	group.Start(ctx)
+
+	deadline := time.Now().Add(time.Second)
+	for settled := false; !settled; {
+		settled = true
+		for _, st := range group.Status(ctx) {
+			settled = settled && st.State == want[st.Name]
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("components not settled: %+v", group.Status(ctx))
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	oc := cache.NewOrderCache(10)
+	oc.Set("o1", models.Order{OrderUID: "o1"})
+	c := NewChecker(config.NewHolder(config.Default()), nil, nil, oc, group)
+	c.ping = func(context.Context) error { return pingErr }
+	if warm {
+		c.SetCacheWarm()
+	}
+	return c
+}
+
+// --- Тест готовности: Postgres, прогрев кеша и состояние компонентов ---
+func TestReadyz(t *testing.T) {
+	cases := []struct {
+		name    string
+		pingErr error
+		warm    bool
+		comps   []*fakeComponent
+		code    int
+	}{
+		{"all up", nil, true, []*fakeComponent{{name: "consumer"}, {name: "grpc"}}, http.StatusOK},
+		{"no components", nil, true, nil, http.StatusOK},
+		{"postgres down", errors.New("connection refused"), true, []*fakeComponent{{name: "consumer"}}, http.StatusServiceUnavailable},
+		{"cache not warm", nil, false, []*fakeComponent{{name: "consumer"}}, http.StatusServiceUnavailable},
+		{"component failed", nil, true, []*fakeComponent{{name: "consumer", fail: errors.New("boom")}, {name: "grpc"}}, http.StatusServiceUnavailable},
+		{"component unhealthy", nil, true, []*fakeComponent{{name: "consumer", health: errors.New("broker unreachable")}}, http.StatusServiceUnavailable},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := testChecker(t, tc.pingErr, tc.warm, tc.comps...)
+			w := httptest.NewRecorder()
+			c.Readyz(w, httptest.NewRequest("GET", "/readyz", nil))
+			if w.Code != tc.code {
+				t.Errorf("got %d %q, want %d", w.Code, w.Body.String(), tc.code)
+			}
+
+			// liveness does not depend on anything
+			w = httptest.NewRecorder()
+			c.Livez(w, httptest.NewRequest("GET", "/livez", nil))
+			if w.Code != http.StatusOK {
+				t.Errorf("livez: got %d", w.Code)
+			}
+		})
+	}
+}
+
+// --- Тест готовности консьюмера: без компонента consumer инстанс не готов ---
+func TestReadyz_RequiresConsumer(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		comps []*fakeComponent
+		code  int
+	}{
+		{"consumer not added", []*fakeComponent{{name: "http"}}, http.StatusServiceUnavailable},
+		{"consumer running", []*fakeComponent{{name: "http"}, {name: "consumer"}}, http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := testChecker(t, nil, true, tc.comps...)
+			c.control = broker.NewControl()
+			w := httptest.NewRecorder()
+			c.Readyz(w, httptest.NewRequest("GET", "/readyz", nil))
+			if w.Code != tc.code {
+				t.Errorf("got %d %q, want %d", w.Code, w.Body.String(), tc.code)
+			}
+		})
+	}
+}
+
+// --- Тест /healthz: поля отчёта и причины отказа ---
+func TestHealthz_Report(t *testing.T) {
+	c := testChecker(t, errors.New("connection refused"), true,
+		&fakeComponent{name: "consumer", health: errors.New("broker unreachable")})
+	c.SetMigrationVersion(7)
+
+	w := httptest.NewRecorder()
+	c.Healthz(w, httptest.NewRequest("GET", "/healthz", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	// field names are part of the API, they are checked on the raw JSON
+	var raw map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &raw); err != nil {
+		t.Fatal(err)
+	}
+	fields := map[string][]string{
+		"postgres":   {"status", "error", "ping_ms", "total_conns", "idle_conns", "acquired_conns", "max_conns"},
+		"kafka":      {"topic", "paused", "lag", "partitions"},
+		"cache":      {"status", "warm", "size", "capacity"},
+		"migrations": {"version"},
+	}
+	for section, keys := range fields {
+		obj, ok := raw[section].(map[string]any)
+		if !ok {
+			t.Errorf("missing %s in %s", section, w.Body)
+			continue
+		}
+		for _, key := range keys {
+			if _, ok := obj[key]; !ok {
+				t.Errorf("missing %s.%s", section, key)
+			}
+		}
+	}
+	if _, ok := raw["status"].(string); !ok {
+		t.Errorf("missing status in %s", w.Body)
+	}
+	if _, ok := raw["components"].([]any); !ok {
+		t.Errorf("missing components in %s", w.Body)
+	}
+
+	var report Report
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Status != statusDown || report.Postgres.Status != statusDown || report.Postgres.Error != "connection refused" {
+		t.Errorf("postgres failure not reported: %+v", report)
+	}
+	if report.Cache.Status != statusUp || !report.Cache.Warm || report.Cache.Size != 1 || report.Cache.Capacity != 10 {
+		t.Errorf("unexpected cache report %+v", report.Cache)
+	}
+	if report.Kafka.Topic != config.Default().Kafka.Topic || report.Migrations.Version != 7 {
+		t.Errorf("unexpected report %+v", report)
+	}
+	want := lifecycle.Status{Name: "consumer", State: lifecycle.StateRunning, Error: "broker unreachable"}
+	if len(report.Components) != 1 || report.Components[0] != want {
+		t.Errorf("unexpected components %+v", report.Components)
+	}
+}
@@ -0,0 +1,253 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/beganov/L0/internal/logger"
+	"github.com/beganov/L0/internal/metrics"
+)
+
+// long-running part of the service supervised by Group
+type Component interface {
+	Name() string
+	// Start blocks until ctx is cancelled, Stop is called or component fails.
+	// nil after ctx cancel or Stop means clean exit
+	Start(ctx context.Context) error
+	// Stop asks a running component to finish, ctx bounds the wait
+	Stop(ctx context.Context) error
+	// Health reports whether a running component is able to do its job
+	Health(ctx context.Context) error
+}
+
+type State string
+
+const (
+	StateRunning State = "running"
+	StateBackoff State = "backoff"
+	StateStopped State = "stopped"
+	StateFailed  State = "failed" // restarts exhausted
+)
+
+// restart rules for failing components
+type Policy struct {
+	MaxRestarts int           // consecutive restarts before giving up, 0 means unlimited
+	BackoffMin  time.Duration // first restart delay, doubled on every failure
+	BackoffMax  time.Duration // delay cap, a run longer than this resets the counter
+	Fatal       bool          // giving up stops the whole service
+}
+
+// snapshot of one component for health reports
+type Status struct {
+	Name     string `json:"name"`
+	State    State  `json:"state"`
+	Restarts int    `json:"restarts"`
+	Error    string `json:"error,omitempty"`
+}
+
+type supervised struct {
+	comp   Component
+	policy Policy
+
+	mu       sync.Mutex
+	state    State
+	restarts int
+	lastErr  error
+	stopping bool
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// set of supervised components
+type Group struct {
+	mu    sync.RWMutex
+	items []*supervised
+	byKey map[string]*supervised
+	fatal chan error
+}
+
+// constructor
+func NewGroup() *Group {
+	return &Group{
+		byKey: make(map[string]*supervised),
+		fatal: make(chan error, 1),
+	}
+}
+
+// register component, it runs after the next Start
+func (g *Group) Add(comp Component, policy Policy) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	s := &supervised{comp: comp, policy: policy, state: StateStopped, done: make(chan struct{})}
+	g.items = append(g.items, s)
+	g.byKey[comp.Name()] = s
+}
+
+// start supervising components added since previous Start, in order of registration
+func (g *Group) Start(ctx context.Context) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	for _, s := range g.items {
+		s.mu.Lock()
+		if s.cancel == nil {
+			runCtx, cancel := context.WithCancel(ctx)
+			s.cancel = cancel
+			go g.supervise(runCtx, s)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// receives error when a component with fatal policy gives up
+func (g *Group) Fatal() <-chan error {
+	return g.fatal
+}
+
+func (g *Group) supervise(ctx context.Context, s *supervised) {
+	defer close(s.done)
+	name := s.comp.Name()
+	backoff := s.policy.BackoffMin
+
+	for {
+		s.setState(StateRunning, nil)
+		metrics.ComponentUp.WithLabelValues(name).Set(1)
+
+		started := time.Now()
+		err := s.comp.Start(ctx)
+		metrics.ComponentUp.WithLabelValues(name).Set(0)
+
+		if s.isStopping() || ctx.Err() != nil {
+			if err != nil {
+				logger.Error(err, "Component stopped with error: "+name)
+			}
+			s.setState(StateStopped, err)
+			return
+		}
+		if err == nil {
+			err = errors.New("exited unexpectedly")
+		}
+
+		// long healthy run means the failure is not part of a crash loop
+		if time.Since(started) > s.policy.BackoffMax {
+			s.resetRestarts()
+			backoff = s.policy.BackoffMin
+		}
+
+		restarts := s.failed(err)
+		if s.policy.MaxRestarts > 0 && restarts > s.policy.MaxRestarts {
+			s.setState(StateFailed, err)
+			logger.Error(err, "Component gave up after restarts: "+name)
+			if s.policy.Fatal {
+				select {
+				case g.fatal <- fmt.Errorf("component %s: %w", name, err):
+				default:
+				}
+			}
+			return
+		}
+
+		metrics.ComponentRestartsTotal.WithLabelValues(name).Inc()
+		logger.Error(err, "Component failed, restarting: "+name)
+		logger.Info("Component restart scheduled", "component", name, "in", backoff.String(), "restart", restarts)
+
+		select {
+		case <-ctx.Done():
+			s.setState(StateStopped, err)
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, s.policy.BackoffMax)
+	}
+}
+
+// stop one component without restarting it, for use as Shutdown step
+func (g *Group) Stopper(name string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		g.mu.RLock()
+		s, ok := g.byKey[name]
+		g.mu.RUnlock()
+		if !ok {
+			return nil // never added, nothing to stop
+		}
+
+		s.mu.Lock()
+		s.stopping = true
+		cancel := s.cancel
+		s.mu.Unlock()
+		if cancel == nil {
+			return nil // never started
+		}
+
+		err := s.comp.Stop(ctx)
+		cancel()
+
+		select {
+		case <-s.done:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// state of every component, running ones are also asked for health
+func (g *Group) Status(ctx context.Context) []Status {
+	g.mu.RLock()
+	items := append([]*supervised(nil), g.items...)
+	g.mu.RUnlock()
+
+	out := make([]Status, 0, len(items))
+	for _, s := range items {
+		s.mu.Lock()
+		st := Status{Name: s.comp.Name(), State: s.state, Restarts: s.restarts}
+		if s.lastErr != nil {
+			st.Error = s.lastErr.Error()
+		}
+		s.mu.Unlock()
+
+		if st.State == StateRunning {
+			if err := s.comp.Health(ctx); err != nil {
+				st.Error = err.Error()
+			} else {
+				st.Error = ""
+			}
+		}
+		out = append(out, st)
+	}
+	return out
+}
+
+func (s *supervised) setState(state State, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = state
+	if err != nil {
+		s.lastErr = err
+	}
+}
+
+func (s *supervised) failed(err error) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = StateBackoff
+	s.lastErr = err
+	s.restarts++
+	return s.restarts
+}
+
+func (s *supervised) resetRestarts() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.restarts = 0
+}
+
+func (s *supervised) isStopping() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stopping
+}
@@ -0,0 +1,79 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// компонент, который падает заданное число раз, затем работает до отмены
+type flakyComponent struct {
+	failures int32
+	starts   atomic.Int32
+}
+
+func (c *flakyComponent) Name() string { return "flaky" }
+
+func (c *flakyComponent) Start(ctx context.Context) error {
+	if c.starts.Add(1) <= c.failures {
+		return errors.New("boom")
+	}
+	<-ctx.Done()
+	return nil
+}
+
+func (c *flakyComponent) Stop(ctx context.Context) error   { return nil }
+func (c *flakyComponent) Health(ctx context.Context) error { return nil }
+
+var testPolicy = Policy{MaxRestarts: 3, BackoffMin: time.Millisecond, BackoffMax: 5 * time.Millisecond, Fatal: true}
+
+// --- Тест перезапуска после сбоев ---
+func TestGroup_Restart(t *testing.T) {
+	comp := &flakyComponent{failures: 2}
+	g := NewGroup()
+	g.Add(comp, testPolicy)
+	g.Start(context.Background())
+
+	deadline := time.Now().Add(time.Second)
+	for comp.starts.Load() < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := comp.starts.Load(); got != 3 {
+		t.Fatalf("expected 3 starts, got %d", got)
+	}
+
+	st := g.Status(context.Background())
+	if len(st) != 1 || st[0].State != StateRunning || st[0].Restarts != 2 {
+		t.Errorf("unexpected status: %+v", st)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := g.Stopper("flaky")(ctx); err != nil {
+		t.Errorf("unexpected stop error: %v", err)
+	}
+	if st := g.Status(context.Background()); st[0].State != StateStopped {
+		t.Errorf("expected stopped, got %s", st[0].State)
+	}
+}
+
+// --- Тест фатального сбоя после исчерпания перезапусков ---
+func TestGroup_Fatal(t *testing.T) {
+	g := NewGroup()
+	g.Add(&flakyComponent{failures: 100}, testPolicy)
+	g.Start(context.Background())
+
+	select {
+	case err := <-g.Fatal():
+		if err == nil {
+			t.Error("expected error")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected fatal failure")
+	}
+	if st := g.Status(context.Background()); st[0].State != StateFailed {
+		t.Errorf("expected failed, got %s", st[0].State)
+	}
+}
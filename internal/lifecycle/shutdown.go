@@ -0,0 +1,90 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/beganov/L0/internal/logger"
+	"github.com/beganov/L0/internal/metrics"
+)
+
+// one stage of shutdown
+type step struct {
+	name    string
+	timeout time.Duration
+	stop    func(ctx context.Context) error
+}
+
+// ordered shutdown, steps run one by one in the order they were added
+type Shutdown struct {
+	steps []step
+}
+
+// constructor
+func NewShutdown() *Shutdown {
+	return &Shutdown{}
+}
+
+// register next step, stop gets a context that expires after timeout
+func (s *Shutdown) Add(name string, timeout time.Duration, stop func(ctx context.Context) error) {
+	s.steps = append(s.steps, step{name: name, timeout: timeout, stop: stop})
+}
+
+// run all steps, a failed or timed out step does not block the next ones.
+// returns joined errors of all failed steps
+func (s *Shutdown) Run() error {
+	var errs []error
+	start := time.Now()
+
+	for _, st := range s.steps {
+		logger.Info("Shutdown step started", "step", st.name, "timeout", st.timeout.String())
+
+		stepStart := time.Now()
+		ctx, cancel := context.WithTimeout(context.Background(), st.timeout)
+		err := st.stop(ctx)
+		cancel()
+		took := time.Since(stepStart)
+
+		metrics.ShutdownStepDuration.WithLabelValues(st.name).Set(took.Seconds())
+		if err != nil {
+			metrics.ShutdownStepsTotal.WithLabelValues(st.name, "error").Inc()
+			logger.Error(err, "Shutdown step failed: "+st.name)
+			errs = append(errs, err)
+			continue
+		}
+		metrics.ShutdownStepsTotal.WithLabelValues(st.name, "ok").Inc()
+		logger.Info("Shutdown step done", "step", st.name, "took", took.String())
+	}
+
+	logger.Info("Shutdown finished", "took", time.Since(start).String())
+	return errors.Join(errs...)
+}
+
+// adapt blocking close without context, the call keeps running in background
+// after the deadline but shutdown moves on
+func Blocking(fn func() error) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		done := make(chan error, 1)
+		go func() { done <- fn() }()
+
+		select {
+		case err := <-done:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// wait until done is closed or deadline passes
+func Wait(done <-chan struct{}) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// --- Тест порядка шагов и продолжения после ошибки ---
+func TestShutdown_Order(t *testing.T) {
+	var order []string
+	s := NewShutdown()
+	s.Add("first", time.Second, func(ctx context.Context) error {
+		order = append(order, "first")
+		return errors.New("boom")
+	})
+	s.Add("second", time.Second, func(ctx context.Context) error {
+		order = append(order, "second")
+		return nil
+	})
+
+	err := s.Run()
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("expected error from first step, got %v", err)
+	}
+	if strings.Join(order, ",") != "first,second" {
+		t.Errorf("unexpected order: %v", order)
+	}
+}
+
+// --- Тест дедлайна шага ---
+func TestShutdown_Timeout(t *testing.T) {
+	never := make(chan struct{})
+	s := NewShutdown()
+	s.Add("stuck", 10*time.Millisecond, Wait(never))
+	s.Add("blocking", 10*time.Millisecond, Blocking(func() error {
+		<-never
+		return nil
+	}))
+
+	start := time.Now()
+	err := s.Run()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("shutdown waited too long: %v", took)
+	}
+}
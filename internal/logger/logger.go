@@ -3,6 +3,8 @@ package logger
 import (
 	"os"
 
+	"github.com/beganov/L0/internal/pii"
+
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
@@ -19,8 +21,22 @@ func Init(level string) {
 	zerolog.SetGlobalLevel(l)
 }
 
+// change global level at runtime
+func SetLevel(level string) error {
+	l, err := zerolog.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	zerolog.SetGlobalLevel(l)
+	return nil
+}
+
 func Info(msg string, fields ...interface{}) {
-	log.Info().Fields(fields).Msg(msg)
+	log.Info().Fields(redact(fields)).Msg(msg)
+}
+
+func Warn(msg string, fields ...interface{}) {
+	log.Warn().Fields(redact(fields)).Msg(msg)
 }
 
 func Error(err error, msg string) {
@@ -32,5 +48,13 @@ func Fatal(err error, msg string) {
 }
 
 func Debug(msg string, fields ...interface{}) {
-	log.Debug().Fields(fields).Msg(msg)
+	log.Debug().Fields(redact(fields)).Msg(msg)
+}
+
+// orders and their parts never reach the log with personal data
+func redact(fields []interface{}) []interface{} {
+	for i := 1; i < len(fields); i += 2 {
+		fields[i] = pii.ForLog(fields[i])
+	}
+	return fields
 }
@@ -21,6 +21,36 @@ var (
 			Help:    "Время обработки одного Kafka-сообщения",
 			Buckets: prometheus.DefBuckets,
 		})
+
+	KafkaInFlight = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "kafka_in_flight_messages",
+			Help: "Сообщения, которые сейчас обрабатываются",
+		})
+
+	KafkaPartitionLag = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kafka_partition_lag",
+			Help: "Отставание консьюмера по партиции, сообщений",
+		}, []string{"topic", "partition"})
+
+	KafkaPartitionOffset = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kafka_partition_offset",
+			Help: "Текущее смещение консьюмера по партиции",
+		}, []string{"topic", "partition"})
+
+	KafkaPartitionRate = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kafka_partition_messages_per_second",
+			Help: "Скорость чтения партиции, сообщений в секунду",
+		}, []string{"topic", "partition"})
+
+	KafkaConsumerPaused = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "kafka_consumer_paused",
+			Help: "Чтение из Kafka приостановлено (1/0)",
+		})
 )
 
 var (
@@ -43,6 +73,24 @@ var (
 			Name: "cache_misses_total",
 			Help: "Количество промахов в кэше",
 		})
+
+	L2CacheHits = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "l2_cache_hits_total",
+			Help: "Количество попаданий в кэш второго уровня",
+		})
+
+	L2CacheMisses = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "l2_cache_misses_total",
+			Help: "Количество промахов в кэше второго уровня",
+		})
+
+	L2CacheErrors = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "l2_cache_errors_total",
+			Help: "Ошибки кэша второго уровня",
+		})
 )
 
 var (
@@ -66,11 +114,143 @@ var (
 		})
 )
 
+var (
+	GrpcRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "grpc_requests_total",
+			Help: "gRPC-вызовы по методу и коду ответа",
+		}, []string{"method", "code"})
+
+	GrpcRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "grpc_request_duration_seconds",
+			Help:    "Время обработки gRPC-вызовов",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method"})
+
+	GrpcWatchers = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "grpc_watchers",
+			Help: "Открытые потоки WatchOrders",
+		})
+)
+
+var (
+	StreamClients = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "stream_clients",
+			Help: "Подключённые клиенты потока заказов (sse/websocket)",
+		}, []string{"transport"})
+
+	StreamDroppedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "stream_dropped_total",
+			Help: "Клиенты потока заказов, отключённые за отставание",
+		}, []string{"transport"})
+)
+
+var (
+	GraphqlRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "graphql_requests_total",
+			Help: "GraphQL-запросы по результату (ok/error/invalid/rejected)",
+		}, []string{"result"})
+
+	GraphqlQueryCost = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "graphql_query_cost",
+			Help:    "Оценка стоимости GraphQL-запросов",
+			Buckets: prometheus.ExponentialBuckets(1, 4, 8),
+		})
+
+	GraphqlLoaderBatches = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "graphql_loader_batches_total",
+			Help: "Пакетные загрузки dataloader по типу данных",
+		}, []string{"loader"})
+)
+
+var (
+	AuthRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "auth_requests_total",
+			Help: "Проверки доступа по способу и результату (ok/unauthenticated/forbidden)",
+		}, []string{"method", "result"})
+)
+
+var (
+	ErasuresTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "erasures_total",
+			Help: "Запросы на удаление персональных данных по результату (erased/dry_run/error)",
+		}, []string{"result"})
+)
+
+var (
+	ConfigReloadsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "config_reloads_total",
+			Help: "Перезагрузки конфигурации по результату",
+		}, []string{"result"})
+
+	ConfigRestartPending = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "config_restart_pending",
+			Help: "Количество изменённых настроек, которые применятся только после перезапуска",
+		})
+)
+
+var (
+	IngestOrdersTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ingest_orders_total",
+			Help: "Заказы, присланные через POST /orders, по результату",
+		}, []string{"result"})
+)
+
+var (
+	ShutdownStepDuration = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "shutdown_step_duration_seconds",
+			Help: "Длительность шагов остановки сервиса",
+		}, []string{"step"})
+
+	ShutdownStepsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "shutdown_steps_total",
+			Help: "Шаги остановки сервиса по результату",
+		}, []string{"step", "result"})
+)
+
+var (
+	ComponentUp = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "component_up",
+			Help: "Запущен ли компонент сервиса (1/0)",
+		}, []string{"component"})
+
+	ComponentRestartsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "component_restarts_total",
+			Help: "Перезапуски компонентов после сбоя",
+		}, []string{"component"})
+)
+
 func Init() {
 	prometheus.MustRegister(
-		KafkaMessagesTotal, KafkaErrorsTotal, KafkaProcessDuration,
+		KafkaMessagesTotal, KafkaErrorsTotal, KafkaProcessDuration, KafkaInFlight,
+		KafkaPartitionLag, KafkaPartitionOffset, KafkaPartitionRate, KafkaConsumerPaused,
 		DBErrorsTotal,
 		CacheHits, CacheMisses,
+		L2CacheHits, L2CacheMisses, L2CacheErrors,
 		HttpRequestsTotal, HttpErrorsTotal, HttpDuration,
+		GrpcRequestsTotal, GrpcRequestDuration, GrpcWatchers,
+		StreamClients, StreamDroppedTotal,
+		GraphqlRequestsTotal, GraphqlQueryCost, GraphqlLoaderBatches,
+		IngestOrdersTotal,
+		AuthRequestsTotal, ErasuresTotal,
+		ConfigReloadsTotal, ConfigRestartPending,
+		ShutdownStepDuration, ShutdownStepsTotal,
+		ComponentUp, ComponentRestartsTotal,
 	)
 }
@@ -1,10 +1,12 @@
 package models
 
 import (
-	"errors"
+	"fmt"
+	"strings"
 	"time"
 )
 
+// pii tags say how each role sees personal data, roles not listed see it in full
 type Order struct {
 	OrderUID          string    `json:"order_uid"`
 	TrackNumber       string    `json:"track_number"`
@@ -14,7 +16,7 @@ type Order struct {
 	Items             []Items   `json:"items"`
 	Locale            string    `json:"locale"`
 	InternalSignature string    `json:"internal_signature"`
-	CustomerID        string    `json:"customer_id"`
+	CustomerID        string    `json:"customer_id" pii:"viewer=hash"`
 	DeliveryService   string    `json:"delivery_service"`
 	Shardkey          string    `json:"shardkey"`
 	SmID              int       `json:"sm_id"`
@@ -24,12 +26,12 @@ type Order struct {
 
 type Delivery struct {
 	Name    string `json:"name"`
-	Phone   string `json:"phone"`
+	Phone   string `json:"phone" pii:"support=last4,viewer=redact"`
 	Zip     string `json:"zip"`
 	City    string `json:"city"`
-	Address string `json:"address"`
+	Address string `json:"address" pii:"support=partial,viewer=redact"`
 	Region  string `json:"region"`
-	Email   string `json:"email"`
+	Email   string `json:"email" pii:"support=partial,viewer=hash"`
 }
 
 type Payment struct {
@@ -59,23 +61,56 @@ type Items struct {
 	Status      int    `json:"status"`
 }
 
+// problem with one field, Field is a JSON path like items[0].chrt_id
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return e.Field + " " + e.Message
+}
+
+// all problems found in an order
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// check required fields, error is *ValidationError with every failed field
 func (o Order) Validate() error {
+	var fields []FieldError
+	fail := func(field, msg string) {
+		fields = append(fields, FieldError{Field: field, Message: msg})
+	}
+
 	if o.OrderUID == "" {
-		return errors.New("order_uid is required")
+		fail("order_uid", "is required")
 	}
 	if o.Payment.Transaction == "" {
-		return errors.New("payment.transaction is required")
+		fail("payment.transaction", "is required")
 	}
 	if o.Delivery.Name == "" {
-		return errors.New("delivery.name is required")
+		fail("delivery.name", "is required")
 	}
 	if len(o.Items) == 0 {
-		return errors.New("order must have at least 1 item")
+		fail("items", "must have at least 1 item")
 	}
-	for _, i := range o.Items {
-		if i.ChrtID == 0 {
-			return errors.New("items.chrt_id is required")
+	for i, it := range o.Items {
+		if it.ChrtID == 0 {
+			fail(fmt.Sprintf("items[%d].chrt_id", i), "is required")
 		}
 	}
+
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
 	return nil
 }
@@ -1,6 +1,8 @@
 package models_test
 
 import (
+	"errors"
+	"strings"
 	"testing"
 	"time"
 
@@ -91,3 +93,23 @@ func TestOrder_Validate(t *testing.T) {
 		})
 	}
 }
+
+// --- Тест ошибок по полям: все проблемы сразу, с путём до поля ---
+func TestOrder_ValidateFields(t *testing.T) {
+	o := models.Order{
+		OrderUID: "123",
+		Items:    []models.Items{{ChrtID: 1}, {ChrtID: 0}},
+	}
+	var verr *models.ValidationError
+	if !errors.As(o.Validate(), &verr) {
+		t.Fatalf("expected *ValidationError, got %v", o.Validate())
+	}
+	var got []string
+	for _, f := range verr.Fields {
+		got = append(got, f.Field)
+	}
+	want := "payment.transaction,delivery.name,items[1].chrt_id"
+	if strings.Join(got, ",") != want {
+		t.Errorf("fields = %v, want %s", got, want)
+	}
+}
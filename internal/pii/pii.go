@@ -0,0 +1,234 @@
+// Package pii masks personal data of orders according to the caller role.
+//
+// Fields opt in with a tag listing the treatment per role, roles that are
+// not listed see the value as is:
+//
+//	Phone string `pii:"support=last4,viewer=redact"`
+package pii
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// treatment of a tagged field
+type Action string
+
+const (
+	Full    Action = "full"    // value as is
+	Partial Action = "partial" // first characters, the rest starred, emails keep the domain
+	Last4   Action = "last4"   // last four characters, the rest starred
+	Hash    Action = "hash"    // keyed hash, equal values stay equal
+	Redact  Action = "redact"  // value replaced with stars
+)
+
+// role whose treatment applies to orders written to the log
+const LogRole = "viewer"
+
+const stars = "***"
+
+var hashKey atomic.Pointer[[]byte]
+
+// key of Hash, values hashed with different keys do not match
+func SetHashKey(key string) {
+	b := []byte(key)
+	hashKey.Store(&b)
+}
+
+// masked copy of v, v itself and everything it references stay untouched
+func Mask[T any](v T, role string) T {
+	rv := reflect.ValueOf(&v).Elem()
+	if !tagged(rv.Type()) {
+		return v
+	}
+	out := reflect.New(rv.Type()).Elem()
+	out.Set(rv)
+	mask(out, role)
+	return out.Interface().(T)
+}
+
+// value ready for the log: tagged structs, pointers and slices of them are masked
+// for LogRole, anything else is returned as is
+func ForLog(v any) any {
+	if v == nil {
+		return nil
+	}
+	rv := reflect.ValueOf(v)
+	if !tagged(rv.Type()) {
+		return v
+	}
+	out := reflect.New(rv.Type()).Elem()
+	out.Set(rv)
+	mask(out, LogRole)
+	return out.Interface()
+}
+
+// mask v in place, shared pointers and slices are copied first
+func mask(v reflect.Value, role string) {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() || !tagged(v.Type().Elem()) {
+			return
+		}
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(v.Elem())
+		mask(c.Elem(), role)
+		v.Set(c)
+	case reflect.Slice:
+		if v.IsNil() || !tagged(v.Type().Elem()) {
+			return
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		reflect.Copy(c, v)
+		for i := 0; i < c.Len(); i++ {
+			mask(c.Index(i), role)
+		}
+		v.Set(c)
+	case reflect.Struct:
+		for _, f := range fieldsOf(v.Type()) {
+			fv := v.Field(f.index)
+			if f.rules == nil {
+				mask(fv, role)
+				continue
+			}
+			if a, ok := f.rules[role]; ok && fv.Kind() == reflect.String {
+				fv.SetString(Apply(a, fv.String()))
+			}
+		}
+	}
+}
+
+// one value under one action
+func Apply(a Action, s string) string {
+	if s == "" {
+		return s
+	}
+	switch a {
+	case Partial:
+		if at := strings.LastIndexByte(s, '@'); at > 0 {
+			return keep(s[:at], 1) + s[at:]
+		}
+		return keep(s, len([]rune(s))/4)
+	case Last4:
+		r := []rune(s)
+		if len(r) <= 4 {
+			return strings.Repeat("*", len(r))
+		}
+		return strings.Repeat("*", len(r)-4) + string(r[len(r)-4:])
+	case Hash:
+		var key []byte
+		if k := hashKey.Load(); k != nil {
+			key = *k
+		}
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(s))
+		return "h:" + hex.EncodeToString(mac.Sum(nil))[:16]
+	case Redact:
+		return stars
+	}
+	return s
+}
+
+// first n characters followed by stars
+func keep(s string, n int) string {
+	r := []rune(s)
+	if n < 1 {
+		n = 1
+	}
+	if n >= len(r) {
+		return stars
+	}
+	return string(r[:n]) + stars
+}
+
+type field struct {
+	index int
+	rules map[string]Action // nil for untagged fields that may hold tagged ones
+}
+
+// what masking needs to know about a type
+type typeInfo struct {
+	tagged bool    // values may hold tagged fields
+	fields []field // of a struct, tagged or leading to tagged ones
+}
+
+var (
+	infoMu sync.Mutex // serializes building, lookups go through infos
+	infos  sync.Map   // reflect.Type -> *typeInfo
+)
+
+func tagged(t reflect.Type) bool {
+	return info(t).tagged
+}
+
+func fieldsOf(t reflect.Type) []field {
+	return info(t).fields
+}
+
+func info(t reflect.Type) *typeInfo {
+	if ti, ok := infos.Load(t); ok {
+		return ti.(*typeInfo)
+	}
+	infoMu.Lock()
+	defer infoMu.Unlock()
+	return build(t, make(map[reflect.Type]*typeInfo))
+}
+
+// seen holds types being built, recursive types are not expected in models
+func build(t reflect.Type, seen map[reflect.Type]*typeInfo) *typeInfo {
+	if ti, ok := infos.Load(t); ok {
+		return ti.(*typeInfo)
+	}
+	if ti, ok := seen[t]; ok {
+		return ti
+	}
+	ti := &typeInfo{}
+	seen[t] = ti
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice:
+		ti.tagged = build(t.Elem(), seen).tagged
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if !sf.IsExported() {
+				continue
+			}
+			if tag, ok := sf.Tag.Lookup("pii"); ok {
+				rules, err := ParseTag(tag)
+				if err != nil {
+					panic(fmt.Sprintf("pii: %s.%s: %v", t, sf.Name, err))
+				}
+				ti.fields = append(ti.fields, field{index: i, rules: rules})
+			} else if build(sf.Type, seen).tagged {
+				ti.fields = append(ti.fields, field{index: i})
+			}
+		}
+		ti.tagged = len(ti.fields) > 0
+	}
+	infos.Store(t, ti)
+	return ti
+}
+
+// "role=action,..." of a pii tag
+func ParseTag(tag string) (map[string]Action, error) {
+	rules := make(map[string]Action)
+	for _, part := range strings.Split(tag, ",") {
+		role, action, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok || role == "" {
+			return nil, fmt.Errorf("want role=action, got %q", part)
+		}
+		switch a := Action(action); a {
+		case Full, Partial, Last4, Hash, Redact:
+			rules[role] = a
+		default:
+			return nil, fmt.Errorf("unknown action %q", action)
+		}
+	}
+	return rules, nil
+}
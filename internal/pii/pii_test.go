@@ -0,0 +1,85 @@
+package pii
+
+import (
+	"testing"
+
+	"github.com/beganov/L0/internal/models"
+)
+
+func testOrder() models.Order {
+	return models.Order{
+		OrderUID:   "o1",
+		CustomerID: "test",
+		Delivery: models.Delivery{
+			Name: "Test Testov", Phone: "+9720000000", Address: "Ploshad Mira 15",
+			City: "Kiryat Mozkin", Email: "test@gmail.com",
+		},
+		Items: []models.Items{{Name: "Mascaras"}},
+	}
+}
+
+// --- Тест маскирования по ролям: полный доступ, частичный и хеш ---
+func TestMask_Roles(t *testing.T) {
+	SetHashKey("k")
+	o := testOrder()
+
+	if got := Mask(o, "admin"); got.Delivery != o.Delivery || got.CustomerID != o.CustomerID {
+		t.Errorf("admin: %+v", got)
+	}
+
+	support := Mask(o, "support")
+	if support.Delivery.Phone != "*******0000" {
+		t.Errorf("support phone: %q", support.Delivery.Phone)
+	}
+	if support.Delivery.Email != "t***@gmail.com" {
+		t.Errorf("support email: %q", support.Delivery.Email)
+	}
+	if support.Delivery.Address != "Plo***" {
+		t.Errorf("support address: %q", support.Delivery.Address)
+	}
+	if support.CustomerID != "test" || support.Delivery.Name != o.Delivery.Name {
+		t.Errorf("support sees customer_id and name: %+v", support)
+	}
+
+	viewer := Mask(o, "viewer")
+	if viewer.Delivery.Phone != "***" || viewer.Delivery.Address != "***" {
+		t.Errorf("viewer: %+v", viewer.Delivery)
+	}
+	if viewer.CustomerID == o.CustomerID || viewer.CustomerID != Mask(testOrder(), "viewer").CustomerID {
+		t.Errorf("viewer customer_id must be a stable hash: %q", viewer.CustomerID)
+	}
+
+	// source order is not modified
+	if o.Delivery.Phone != "+9720000000" || o.CustomerID != "test" {
+		t.Errorf("source modified: %+v", o)
+	}
+}
+
+// --- Тест логов: заказы, указатели и срезы маскируются, прочие значения как есть ---
+func TestForLog(t *testing.T) {
+	o := testOrder()
+	if got := ForLog(o).(models.Order); got.Delivery.Phone != "***" {
+		t.Errorf("order: %q", got.Delivery.Phone)
+	}
+	if got := ForLog(&o).(*models.Order); got.Delivery.Phone != "***" || o.Delivery.Phone != "+9720000000" {
+		t.Errorf("pointer: %q, source %q", got.Delivery.Phone, o.Delivery.Phone)
+	}
+	list := []models.Order{o}
+	if got := ForLog(list).([]models.Order); got[0].Delivery.Email == o.Delivery.Email || list[0].Delivery.Email != o.Delivery.Email {
+		t.Errorf("slice: %q, source %q", got[0].Delivery.Email, list[0].Delivery.Email)
+	}
+	if got := ForLog("+9720000000"); got != "+9720000000" {
+		t.Errorf("plain string changed: %v", got)
+	}
+}
+
+func TestParseTag(t *testing.T) {
+	if _, err := ParseTag("support=last4,viewer=hash"); err != nil {
+		t.Fatal(err)
+	}
+	for _, bad := range []string{"support", "=hash", "viewer=shuffle"} {
+		if _, err := ParseTag(bad); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package projection
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/beganov/L0/internal/models"
+)
+
+// dotted JSON paths of models.Order, items.name is the name of every item
+var known = orderPaths()
+
+func orderPaths() map[string]bool {
+	paths := make(map[string]bool)
+	var walk func(t reflect.Type, prefix string)
+	walk = func(t reflect.Type, prefix string) {
+		for i := 0; i < t.NumField(); i++ {
+			name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+			if name == "" || name == "-" {
+				continue
+			}
+			path := prefix + name
+			paths[path] = true
+			ft := t.Field(i).Type
+			if ft.Kind() == reflect.Slice {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && ft.PkgPath() == t.PkgPath() {
+				walk(ft, path+".")
+			}
+		}
+	}
+	walk(reflect.TypeOf(models.Order{}), "")
+	return paths
+}
+
+// whether path names a field of the order
+func Known(path string) bool {
+	return known[path]
+}
+
+// fields to keep and to drop from an order response
+type Projection struct {
+	fields  []string
+	exclude []string
+}
+
+// projection from comma separated ?fields= and ?exclude= values. every path must be
+// a field of the order covered by allowed, an allowed path covers its subfields
+func Parse(fields, exclude string, allowed []string) (*Projection, error) {
+	p := &Projection{}
+	var err error
+	if p.fields, err = parsePaths("fields", fields, allowed); err != nil {
+		return nil, err
+	}
+	if p.exclude, err = parsePaths("exclude", exclude, allowed); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func parsePaths(param, value string, allowed []string) ([]string, error) {
+	var paths []string
+	for _, path := range strings.Split(value, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		if !known[path] {
+			return nil, fmt.Errorf("%s: unknown field %q", param, path)
+		}
+		if !slices.ContainsFunc(allowed, func(a string) bool { return path == a || strings.HasPrefix(path, a+".") }) {
+			return nil, fmt.Errorf("%s: field %q may not be projected", param, path)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// nothing to change, the order is sent as is
+func (p *Projection) Empty() bool {
+	return len(p.fields) == 0 && len(p.exclude) == 0
+}
+
+// order as JSON object with only the selected fields, excluded ones removed after that
+func (p *Projection) Apply(order models.Order) (map[string]any, error) {
+	data, err := json.Marshal(order)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	if len(p.fields) > 0 {
+		tree := node{}
+		for _, path := range p.fields {
+			tree.add(strings.Split(path, "."))
+		}
+		doc = tree.pick(doc).(map[string]any)
+	}
+	for _, path := range p.exclude {
+		remove(doc, strings.Split(path, "."))
+	}
+	return doc, nil
+}
+
+// selected paths as a tree, nil child keeps the whole value
+type node map[string]node
+
+func (n node) add(path []string) {
+	child, ok := n[path[0]]
+	if ok && child == nil {
+		return // whole value already kept
+	}
+	if len(path) == 1 {
+		n[path[0]] = nil
+		return
+	}
+	if child == nil {
+		child = node{}
+		n[path[0]] = child
+	}
+	child.add(path[1:])
+}
+
+// arrays are projected element by element
+func (n node) pick(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(n))
+		for key, child := range n {
+			fv, ok := val[key]
+			if !ok {
+				continue
+			}
+			if child == nil {
+				out[key] = fv
+			} else {
+				out[key] = child.pick(fv)
+			}
+		}
+		return out
+	case []any:
+		out := make([]any, len(val))
+		for i, el := range val {
+			out[i] = n.pick(el)
+		}
+		return out
+	}
+	return v
+}
+
+func remove(v any, path []string) {
+	switch val := v.(type) {
+	case map[string]any:
+		if len(path) == 1 {
+			delete(val, path[0])
+			return
+		}
+		remove(val[path[0]], path[1:])
+	case []any:
+		for _, el := range val {
+			remove(el, path)
+		}
+	}
+}
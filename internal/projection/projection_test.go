@@ -0,0 +1,66 @@
+package projection
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/beganov/L0/internal/models"
+)
+
+var allowed = []string{"order_uid", "customer_id", "delivery", "payment", "items"}
+
+func testOrder() models.Order {
+	return models.Order{
+		OrderUID:          "o1",
+		CustomerID:        "c1",
+		InternalSignature: "secret",
+		Delivery:          models.Delivery{Name: "Ivan", City: "Kiryat Mozkin"},
+		Payment:           models.Payment{Amount: 1817, Bank: "alpha"},
+		Items:             []models.Items{{Name: "Mascaras", Price: 453}, {Name: "Lipstick", Price: 100}},
+	}
+}
+
+// --- Тест проекции: fields и exclude, вложенные поля и массивы ---
+func TestProjection_Apply(t *testing.T) {
+	cases := []struct {
+		name, fields, exclude, want string
+	}{
+		{"nested and arrays", "order_uid,payment.amount,items.name", "",
+			`{"items":[{"name":"Mascaras"},{"name":"Lipstick"}],"order_uid":"o1","payment":{"amount":1817}}`},
+		{"whole object wins", "delivery.name,delivery", "",
+			`{"delivery":{"address":"","city":"Kiryat Mozkin","email":"","name":"Ivan","phone":"","region":"","zip":""}}`},
+		{"exclude after fields", "order_uid,items", "items.price",
+			`{"items":[{"brand":"","chrt_id":0,"name":"Mascaras","nm_id":0,"rid":"","sale":0,"size":"","status":0,"total_price":0,"track_number":""},{"brand":"","chrt_id":0,"name":"Lipstick","nm_id":0,"rid":"","sale":0,"size":"","status":0,"total_price":0,"track_number":""}],"order_uid":"o1"}`},
+	}
+	for _, tc := range cases {
+		p, err := Parse(tc.fields, tc.exclude, allowed)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		doc, err := p.Apply(testOrder())
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := json.Marshal(doc)
+		if string(got) != tc.want {
+			t.Errorf("%s:\n got %s\nwant %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+// --- Тест списка разрешённых полей: неизвестные и не разрешённые поля отклоняются ---
+func TestProjection_Allowlist(t *testing.T) {
+	if _, err := Parse("internal_signature", "", allowed); err == nil {
+		t.Error("field outside allowlist must be rejected")
+	}
+	if _, err := Parse("", "payment.nope", allowed); err == nil {
+		t.Error("unknown field must be rejected")
+	}
+	p, err := Parse(" , ", "", allowed)
+	if err != nil || !p.Empty() {
+		t.Errorf("empty lists must give empty projection, got %v %v", p, err)
+	}
+	if !Known("items.chrt_id") || Known("items.chrt") {
+		t.Error("known paths come from json tags")
+	}
+}
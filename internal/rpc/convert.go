@@ -0,0 +1,119 @@
+package rpc
+
+import (
+	"github.com/beganov/L0/internal/models"
+	"github.com/beganov/L0/internal/rpc/orderpb"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// wire form of a stored order, field for field
+func toProto(o models.Order) *orderpb.Order {
+	items := make([]*orderpb.Item, len(o.Items))
+	for i, it := range o.Items {
+		items[i] = &orderpb.Item{
+			ChrtId:      int64(it.ChrtID),
+			TrackNumber: it.TrackNumber,
+			Price:       int64(it.Price),
+			Rid:         it.Rid,
+			Name:        it.Name,
+			Sale:        int64(it.Sale),
+			Size:        it.Size,
+			TotalPrice:  int64(it.TotalPrice),
+			NmId:        int64(it.NmID),
+			Brand:       it.Brand,
+			Status:      int64(it.Status),
+		}
+	}
+	return &orderpb.Order{
+		OrderUid:    o.OrderUID,
+		TrackNumber: o.TrackNumber,
+		Entry:       o.Entry,
+		Delivery: &orderpb.Delivery{
+			Name:    o.Delivery.Name,
+			Phone:   o.Delivery.Phone,
+			Zip:     o.Delivery.Zip,
+			City:    o.Delivery.City,
+			Address: o.Delivery.Address,
+			Region:  o.Delivery.Region,
+			Email:   o.Delivery.Email,
+		},
+		Payment: &orderpb.Payment{
+			Transaction:  o.Payment.Transaction,
+			RequestId:    o.Payment.RequestID,
+			Currency:     o.Payment.Currency,
+			Provider:     o.Payment.Provider,
+			Amount:       int64(o.Payment.Amount),
+			PaymentDt:    o.Payment.PaymentDT,
+			Bank:         o.Payment.Bank,
+			DeliveryCost: int64(o.Payment.DeliveryCost),
+			GoodsTotal:   int64(o.Payment.GoodsTotal),
+			CustomFee:    int64(o.Payment.CustomFee),
+		},
+		Items:             items,
+		Locale:            o.Locale,
+		InternalSignature: o.InternalSignature,
+		CustomerId:        o.CustomerID,
+		DeliveryService:   o.DeliveryService,
+		Shardkey:          o.Shardkey,
+		SmId:              int64(o.SmID),
+		DateCreated:       timestamppb.New(o.DateCreated),
+		OofShard:          o.OofShard,
+	}
+}
+
+// stored order back from wire form, used by clients and tests
+func fromProto(p *orderpb.Order) models.Order {
+	items := make([]models.Items, len(p.GetItems()))
+	for i, it := range p.GetItems() {
+		items[i] = models.Items{
+			ChrtID:      int(it.GetChrtId()),
+			TrackNumber: it.GetTrackNumber(),
+			Price:       int(it.GetPrice()),
+			Rid:         it.GetRid(),
+			Name:        it.GetName(),
+			Sale:        int(it.GetSale()),
+			Size:        it.GetSize(),
+			TotalPrice:  int(it.GetTotalPrice()),
+			NmID:        int(it.GetNmId()),
+			Brand:       it.GetBrand(),
+			Status:      int(it.GetStatus()),
+		}
+	}
+	d, pay := p.GetDelivery(), p.GetPayment()
+	return models.Order{
+		OrderUID:    p.GetOrderUid(),
+		TrackNumber: p.GetTrackNumber(),
+		Entry:       p.GetEntry(),
+		Delivery: models.Delivery{
+			Name:    d.GetName(),
+			Phone:   d.GetPhone(),
+			Zip:     d.GetZip(),
+			City:    d.GetCity(),
+			Address: d.GetAddress(),
+			Region:  d.GetRegion(),
+			Email:   d.GetEmail(),
+		},
+		Payment: models.Payment{
+			Transaction:  pay.GetTransaction(),
+			RequestID:    pay.GetRequestId(),
+			Currency:     pay.GetCurrency(),
+			Provider:     pay.GetProvider(),
+			Amount:       int(pay.GetAmount()),
+			PaymentDT:    pay.GetPaymentDt(),
+			Bank:         pay.GetBank(),
+			DeliveryCost: int(pay.GetDeliveryCost()),
+			GoodsTotal:   int(pay.GetGoodsTotal()),
+			CustomFee:    int(pay.GetCustomFee()),
+		},
+		Items:             items,
+		Locale:            p.GetLocale(),
+		InternalSignature: p.GetInternalSignature(),
+		CustomerID:        p.GetCustomerId(),
+		DeliveryService:   p.GetDeliveryService(),
+		Shardkey:          p.GetShardkey(),
+		SmID:              int(p.GetSmId()),
+		DateCreated:       p.GetDateCreated().AsTime(),
+		OofShard:          p.GetOofShard(),
+	}
+}
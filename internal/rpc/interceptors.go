@@ -0,0 +1,130 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/beganov/L0/internal/auth"
+	"github.com/beganov/L0/internal/metrics"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// count calls by method and code, time them by method
+func unaryMetrics(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	observe(info.FullMethod, start, err)
+	return resp, err
+}
+
+// streams are timed for their whole life
+func streamMetrics(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	observe(info.FullMethod, start, err)
+	return err
+}
+
+func observe(method string, start time.Time, err error) {
+	metrics.GrpcRequestsTotal.WithLabelValues(method, status.Code(err).String()).Inc()
+	metrics.GrpcRequestDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+// probes answer without credentials, like /livez and /readyz over HTTP
+const healthService = "/grpc.health.v1.Health/"
+
+// unary calls need the viewer role, the principal goes to the handler context
+func unaryAuth(a *auth.Auth) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if strings.HasPrefix(info.FullMethod, healthService) {
+			return handler(ctx, req)
+		}
+		ctx, err := authenticate(ctx, a, info.FullMethod, req)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func streamAuth(a *auth.Auth) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if strings.HasPrefix(info.FullMethod, healthService) {
+			return handler(srv, ss)
+		}
+		// the request message is signed too, so the check waits for it
+		return handler(srv, &authStream{ServerStream: ss, ctx: ss.Context(), auth: a, method: info.FullMethod})
+	}
+}
+
+// metadata is checked as HTTP headers of "POST <full method>", the body is the
+// deterministic protobuf encoding of the request message, that is also what HMAC clients sign
+func authenticate(ctx context.Context, a *auth.Auth, method string, req any) (context.Context, error) {
+	var body []byte
+	if m, ok := req.(proto.Message); ok {
+		var err error
+		if body, err = (proto.MarshalOptions{Deterministic: true}).Marshal(m); err != nil {
+			return ctx, status.Error(codes.Internal, err.Error())
+		}
+	}
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, method, bytes.NewReader(body))
+	if err != nil {
+		return ctx, status.Error(codes.Internal, err.Error())
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for k, vs := range md {
+		for _, v := range vs {
+			r.Header.Add(k, v)
+		}
+	}
+	p, err := a.Authenticate(r)
+	if err != nil {
+		metrics.AuthRequestsTotal.WithLabelValues("none", "unauthenticated").Inc()
+		return ctx, status.Error(codes.Unauthenticated, "credentials required")
+	}
+	if p.Role < auth.RoleViewer {
+		metrics.AuthRequestsTotal.WithLabelValues(p.Method, "forbidden").Inc()
+		return ctx, status.Error(codes.PermissionDenied, "forbidden")
+	}
+	if a != nil {
+		metrics.AuthRequestsTotal.WithLabelValues(p.Method, "ok").Inc()
+	}
+	return auth.WithPrincipal(ctx, p), nil
+}
+
+// server stream authenticated by its first request message,
+// the handler reads the context only after receiving it
+type authStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	auth   *auth.Auth
+	method string
+	done   bool
+}
+
+func (s *authStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *authStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if s.done {
+		return nil
+	}
+	ctx, err := authenticate(s.ServerStream.Context(), s.auth, s.method, m)
+	if err != nil {
+		return err
+	}
+	s.ctx, s.done = ctx, true
+	return nil
+}
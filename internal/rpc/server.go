@@ -0,0 +1,108 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"github.com/beganov/L0/internal/auth"
+	"github.com/beganov/L0/internal/config"
+	"github.com/beganov/L0/internal/events"
+	"github.com/beganov/L0/internal/logger"
+	"github.com/beganov/L0/internal/rpc/orderpb"
+	"github.com/beganov/L0/internal/storage"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+// gRPC server as supervised component
+type Server struct {
+	addr  string
+	cfg   *config.Holder
+	store *storage.Storage
+	hub   *events.Hub
+	auth  *auth.Auth // nil when auth is disabled
+
+	mu      sync.Mutex
+	srv     *grpc.Server // stopped server cannot serve again, new one on every start
+	health  *health.Server
+	service *orderService
+}
+
+// constructor, watchers of an instance that consumes nothing get no orders
+func NewServer(addr string, cfg *config.Holder, store *storage.Storage, hub *events.Hub, authn *auth.Auth) *Server {
+	return &Server{addr: addr, cfg: cfg, store: store, hub: hub, auth: authn}
+}
+
+func (s *Server) Name() string {
+	return "grpc"
+}
+
+// listen until Stop, listen errors are returned for restart
+func (s *Server) Start(ctx context.Context) error {
+	lis, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(unaryMetrics, unaryAuth(s.auth)),
+		grpc.ChainStreamInterceptor(streamMetrics, streamAuth(s.auth)),
+	)
+	service := &orderService{cfg: s.cfg, store: s.store, hub: s.hub, stopping: make(chan struct{})}
+	orderpb.RegisterOrderServiceServer(srv, service)
+	hs := health.NewServer()
+	healthpb.RegisterHealthServer(srv, hs)
+	reflection.Register(srv)
+
+	s.mu.Lock()
+	s.srv, s.health, s.service = srv, hs, service
+	s.mu.Unlock()
+
+	logger.Info("gRPC server running at", "addr", s.addr)
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Serve(lis) }()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		// cancelled without Stop, or Stop raced with start
+		srv.Stop()
+		return <-errc
+	}
+}
+
+// report NOT_SERVING, end watch streams and wait for unary calls,
+// calls still running when ctx is done are cut off
+func (s *Server) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	srv, hs, service := s.srv, s.health, s.service
+	s.srv = nil
+	s.mu.Unlock()
+	if srv == nil {
+		return nil
+	}
+
+	hs.Shutdown()
+	close(service.stopping)
+	done := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		srv.Stop()
+		return ctx.Err()
+	}
+}
+
+// serving calls is all the server has to do
+func (s *Server) Health(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,153 @@
+package rpc
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+
+	"github.com/beganov/L0/internal/auth"
+	"github.com/beganov/L0/internal/config"
+	"github.com/beganov/L0/internal/events"
+	"github.com/beganov/L0/internal/logger"
+	"github.com/beganov/L0/internal/metrics"
+	"github.com/beganov/L0/internal/models"
+	"github.com/beganov/L0/internal/pii"
+	"github.com/beganov/L0/internal/rpc/orderpb"
+	"github.com/beganov/L0/internal/storage"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// page size limits of ListOrders
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// OrderService over the same lookup as HTTP API
+type orderService struct {
+	orderpb.UnimplementedOrderServiceServer
+	cfg   *config.Holder
+	store *storage.Storage
+	hub   *events.Hub
+	// closed on server stop, graceful stop would wait for watchers forever
+	stopping chan struct{}
+}
+
+func (s *orderService) GetOrder(ctx context.Context, req *orderpb.GetOrderRequest) (*orderpb.Order, error) {
+	if req.GetOrderUid() == "" {
+		return nil, status.Error(codes.InvalidArgument, "order_uid is required")
+	}
+	order, err := s.store.Get(ctx, req.GetOrderUid())
+	if err != nil {
+		return nil, lookupError(err)
+	}
+	return reply(ctx, order), nil
+}
+
+func (s *orderService) BatchGetOrders(ctx context.Context, req *orderpb.BatchGetOrdersRequest) (*orderpb.BatchGetOrdersResponse, error) {
+	if n, max := len(req.GetOrderUids()), s.cfg.Get().HTTP.BatchMax; n > max {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d order_uids in one call, got %d", max, n)
+	}
+	found, missing, err := s.store.GetMany(ctx, req.GetOrderUids())
+	if err != nil {
+		return nil, lookupError(err)
+	}
+	resp := &orderpb.BatchGetOrdersResponse{Orders: make(map[string]*orderpb.Order, len(found)), Missing: missing}
+	for id, o := range found {
+		resp.Orders[id] = reply(ctx, o)
+	}
+	return resp, nil
+}
+
+// page token is the last order_uid of the previous page
+func (s *orderService) ListOrders(ctx context.Context, req *orderpb.ListOrdersRequest) (*orderpb.ListOrdersResponse, error) {
+	size := int(req.GetPageSize())
+	switch {
+	case size < 0:
+		return nil, status.Error(codes.InvalidArgument, "page_size must not be negative")
+	case size == 0:
+		size = defaultPageSize
+	case size > maxPageSize:
+		size = maxPageSize
+	}
+	after, err := base64.RawURLEncoding.DecodeString(req.GetPageToken())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid page_token")
+	}
+
+	orders, err := s.store.List(ctx, string(after), size)
+	if err != nil {
+		return nil, lookupError(err)
+	}
+	resp := &orderpb.ListOrdersResponse{Orders: make([]*orderpb.Order, len(orders))}
+	for i, o := range orders {
+		resp.Orders[i] = reply(ctx, o)
+	}
+	if len(orders) == size {
+		resp.NextPageToken = base64.RawURLEncoding.EncodeToString([]byte(orders[len(orders)-1].OrderUID))
+	}
+	return resp, nil
+}
+
+// stream orders stored by this instance until the client goes away.
+// client that does not keep up is cut off with RESOURCE_EXHAUSTED
+func (s *orderService) WatchOrders(req *orderpb.WatchOrdersRequest, stream grpc.ServerStreamingServer[orderpb.Order]) error {
+	sub := s.hub.Subscribe(s.cfg.Get().GRPC.WatchBuffer)
+	defer sub.Close()
+	metrics.GrpcWatchers.Inc()
+	defer metrics.GrpcWatchers.Dec()
+
+	ctx := stream.Context()
+	role := auth.CallerRole(ctx).String()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.stopping:
+			return status.Error(codes.Unavailable, "server is stopping")
+		case ev, ok := <-sub.C():
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "watcher fell behind, reconnect")
+			}
+			order := pii.Mask(ev.Order, role)
+			if !matchWatch(req, order) {
+				continue
+			}
+			if err := stream.Send(toProto(order)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// message with personal data masked for the caller role
+func reply(ctx context.Context, o models.Order) *orderpb.Order {
+	return toProto(pii.Mask(o, auth.CallerRole(ctx).String()))
+}
+
+// empty filter fields match any order. o is masked for the caller,
+// a role that sees customer_id hashed filters by the hash and cannot probe raw ids
+func matchWatch(req *orderpb.WatchOrdersRequest, o models.Order) bool {
+	if c := req.GetCustomerId(); c != "" && c != o.CustomerID {
+		return false
+	}
+	if d := req.GetDeliveryService(); d != "" && d != o.DeliveryService {
+		return false
+	}
+	return true
+}
+
+// not found is the caller's problem, anything else is the storage
+func lookupError(err error) error {
+	if errors.Is(err, storage.ErrNotFound) {
+		return status.Error(codes.NotFound, "order not found")
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+	logger.Error(err, "gRPC order lookup failed")
+	return status.Error(codes.Unavailable, "storage unavailable")
+}
@@ -0,0 +1,185 @@
+package rpc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/beganov/L0/internal/auth"
+	"github.com/beganov/L0/internal/cache"
+	"github.com/beganov/L0/internal/config"
+	"github.com/beganov/L0/internal/events"
+	"github.com/beganov/L0/internal/models"
+	"github.com/beganov/L0/internal/pii"
+	"github.com/beganov/L0/internal/rpc/orderpb"
+	"github.com/beganov/L0/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+func testOrder(id, customer string) models.Order {
+	return models.Order{
+		OrderUID:    id,
+		CustomerID:  customer,
+		Delivery:    models.Delivery{Name: "Ivan", Phone: "+79990000000"},
+		Payment:     models.Payment{Transaction: id, Amount: 1817, PaymentDT: 1637907727},
+		Items:       []models.Items{{ChrtID: 9934930, Price: 453, NmID: 2389212}},
+		DateCreated: time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC),
+	}
+}
+
+// client to the order service over in-memory connection, orders are served from cache only,
+// auth disabled, as in serve without auth.enabled
+func startService(t *testing.T, oc *cache.OrderCache, hub *events.Hub) orderpb.OrderServiceClient {
+	return startAuthService(t, oc, hub, nil)
+}
+
+func startAuthService(t *testing.T, oc *cache.OrderCache, hub *events.Hub, a *auth.Auth) orderpb.OrderServiceClient {
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(unaryMetrics, unaryAuth(a)), grpc.ChainStreamInterceptor(streamMetrics, streamAuth(a)))
+	holder := config.NewHolder(config.Default())
+	orderpb.RegisterOrderServiceServer(srv, &orderService{
+		cfg:      holder,
+		store:    storage.NewStorage(holder, oc, nil, nil),
+		hub:      hub,
+		stopping: make(chan struct{}),
+	})
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return orderpb.NewOrderServiceClient(conn)
+}
+
+// --- Тест конвертации: заказ переживает преобразование в protobuf и обратно ---
+func TestConvert_RoundTrip(t *testing.T) {
+	o := testOrder("b563feb7b2b84b6test", "test")
+	assert.Equal(t, o, fromProto(toProto(o)))
+}
+
+// --- Тест GetOrder: заказ из кэша и ошибка на пустой id ---
+func TestGetOrder(t *testing.T) {
+	oc := cache.NewOrderCache(10)
+	o := testOrder("o1", "c1")
+	oc.Set(o.OrderUID, o)
+	client := startService(t, oc, events.NewHub(0))
+
+	got, err := client.GetOrder(context.Background(), &orderpb.GetOrderRequest{OrderUid: "o1"})
+	require.NoError(t, err)
+	assert.Equal(t, o, fromProto(got))
+
+	_, err = client.GetOrder(context.Background(), &orderpb.GetOrderRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+// --- Тест WatchOrders: поток отдаёт только заказы нужного клиента ---
+func TestWatchOrders(t *testing.T) {
+	hub := events.NewHub(0)
+	client := startService(t, cache.NewOrderCache(10), hub)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := client.WatchOrders(ctx, &orderpb.WatchOrdersRequest{CustomerId: "c1"})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return hub.Len() == 1 }, time.Second, 10*time.Millisecond)
+
+	hub.Publish(testOrder("o1", "c2"))
+	hub.Publish(testOrder("o2", "c1"))
+	got, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "o2", got.GetOrderUid())
+}
+
+// --- Тест WatchOrders для viewer: фильтр сравнивается с хешем customer_id ---
+func TestWatchOrders_ViewerFiltersByHash(t *testing.T) {
+	sum := sha256.Sum256([]byte("k-view"))
+	file := filepath.Join(t.TempDir(), "keys")
+	require.NoError(t, os.WriteFile(file, []byte("board viewer "+hex.EncodeToString(sum[:])+"\n"), 0o600))
+	a, err := auth.New(config.AuthConfig{Enabled: true, APIKeysFile: file})
+	require.NoError(t, err)
+
+	hub := events.NewHub(0)
+	client := startAuthService(t, cache.NewOrderCache(10), hub, a)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, "x-api-key", "k-view")
+
+	hashed := pii.Apply(pii.Hash, "c1")
+	byHash, err := client.WatchOrders(ctx, &orderpb.WatchOrdersRequest{CustomerId: hashed})
+	require.NoError(t, err)
+	// the raw id never matches, that stream only ends with its deadline
+	rawCtx, stop := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer stop()
+	raw, err := client.WatchOrders(rawCtx, &orderpb.WatchOrdersRequest{CustomerId: "c1"})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return hub.Len() == 2 }, time.Second, 10*time.Millisecond)
+
+	hub.Publish(testOrder("o1", "c2"))
+	hub.Publish(testOrder("o2", "c1"))
+	got, err := byHash.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "o2", got.GetOrderUid())
+	assert.Equal(t, hashed, got.GetCustomerId())
+
+	_, err = raw.Recv()
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+}
+
+// --- Тест HMAC в gRPC: подпись покрывает сообщение запроса ---
+func TestAuth_SignedMessage(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "hmac")
+	require.NoError(t, os.WriteFile(file, []byte("partner viewer s3cret\n"), 0o600))
+	a, err := auth.New(config.AuthConfig{Enabled: true, HMACKeysFile: file, HMACSkew: time.Minute})
+	require.NoError(t, err)
+
+	oc := cache.NewOrderCache(10)
+	oc.Set("o1", testOrder("o1", "c1"))
+	oc.Set("o2", testOrder("o2", "c2"))
+	hub := events.NewHub(0)
+	client := startAuthService(t, oc, hub, a)
+
+	signed := func(method, nonce string, m proto.Message) context.Context {
+		body, err := proto.MarshalOptions{Deterministic: true}.Marshal(m)
+		require.NoError(t, err)
+		ts := time.Now().Unix()
+		sig := auth.Sign("s3cret", "POST", method, ts, nonce, body)
+		return metadata.AppendToOutgoingContext(context.Background(),
+			"x-key-id", "partner", "x-timestamp", strconv.FormatInt(ts, 10),
+			"x-nonce", nonce, "x-signature", hex.EncodeToString(sig))
+	}
+	const getOrder = "/l0.order.v1.OrderService/GetOrder"
+
+	got, err := client.GetOrder(signed(getOrder, "nonce-0001", &orderpb.GetOrderRequest{OrderUid: "o1"}), &orderpb.GetOrderRequest{OrderUid: "o1"})
+	require.NoError(t, err)
+	assert.Equal(t, "o1", got.GetOrderUid())
+
+	// the same signature does not open another order
+	_, err = client.GetOrder(signed(getOrder, "nonce-0002", &orderpb.GetOrderRequest{OrderUid: "o1"}), &orderpb.GetOrderRequest{OrderUid: "o2"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// streams are checked against their first message
+	ctx, cancel := context.WithTimeout(signed("/l0.order.v1.OrderService/WatchOrders", "nonce-0003", &orderpb.WatchOrdersRequest{CustomerId: "c1"}), 5*time.Second)
+	defer cancel()
+	stream, err := client.WatchOrders(ctx, &orderpb.WatchOrdersRequest{CustomerId: "c2"})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
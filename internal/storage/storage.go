@@ -1,8 +1,147 @@
 package storage
 
+import (
+	"context"
+	"errors"
+
+	"github.com/beganov/L0/internal/cache"
+	"github.com/beganov/L0/internal/config"
+	"github.com/beganov/L0/internal/database"
+	"github.com/beganov/L0/internal/logger"
+	"github.com/beganov/L0/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// order is neither cached nor stored
+var ErrNotFound = errors.New("order not found")
+
+// order lookup shared by HTTP and gRPC: memory cache, then L2, then DB
 type Storage struct {
+	cfg   *config.Holder // timeouts may change on reload
+	cache *cache.OrderCache
+	l2    *cache.RedisCache
+	db    *pgxpool.Pool
+}
+
+func NewStorage(cfg *config.Holder, cache *cache.OrderCache, l2 *cache.RedisCache, db *pgxpool.Pool) *Storage {
+	return &Storage{cfg: cfg, cache: cache, l2: l2, db: db}
 }
 
-func NewStorage() *Storage {
-	return &Storage{}
+// order by id, found order is put into both cache tiers.
+// ErrNotFound when it does not exist, other errors mean the DB failed
+func (s *Storage) Get(ctx context.Context, orderID string) (models.Order, error) {
+	if order, ok := s.cache.Get(orderID); ok {
+		return order, nil
+	}
+
+	cfg := s.cfg.Get()
+	ctx, cancel := context.WithTimeout(ctx, cfg.HTTP.Timeout)
+	defer cancel()
+
+	// L2 errors only degrade to db lookup
+	order, ok, err := s.l2.Get(ctx, orderID)
+	if err != nil {
+		logger.Error(err, "L2 cache get failed")
+	}
+	if ok {
+		s.cache.Set(orderID, order)
+		return order, nil
+	}
+
+	order, err = database.GetOrderFromDB(ctx, s.db, orderID, cfg.Postgres.SelectTimeout)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Order{}, ErrNotFound
+	}
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	s.cache.Set(orderID, order)
+	if err := s.l2.Set(ctx, order); err != nil {
+		logger.Error(err, "L2 cache set failed")
+	}
+	return order, nil
+}
+
+// several orders at once: memory cache hits, all misses in one DB round trip.
+// found orders are put into both cache tiers, ids not stored are returned as missing
+// in request order. duplicate ids are looked up once
+func (s *Storage) GetMany(ctx context.Context, orderIDs []string) (map[string]models.Order, []string, error) {
+	found := make(map[string]models.Order, len(orderIDs))
+	var misses []string
+	seen := make(map[string]bool, len(orderIDs))
+	for _, id := range orderIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if order, ok := s.cache.Get(id); ok {
+			found[id] = order
+			continue
+		}
+		misses = append(misses, id)
+	}
+	if len(misses) == 0 {
+		return found, nil, nil
+	}
+
+	cfg := s.cfg.Get()
+	ctx, cancel := context.WithTimeout(ctx, cfg.HTTP.Timeout)
+	defer cancel()
+	stored, err := database.GetOrdersFromDB(ctx, s.db, misses, cfg.Postgres.SelectTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var missing []string
+	for _, id := range misses {
+		order, ok := stored[id]
+		if !ok {
+			missing = append(missing, id)
+			continue
+		}
+		found[id] = order
+		s.cache.Set(id, order)
+		if err := s.l2.Set(ctx, order); err != nil {
+			logger.Error(err, "L2 cache set failed")
+		}
+	}
+	return found, missing, nil
+}
+
+// whether order is stored, cache hit saves the DB query
+func (s *Storage) Exists(ctx context.Context, orderID string) (bool, error) {
+	if _, ok := s.cache.Get(orderID); ok {
+		return true, nil
+	}
+	cfg := s.cfg.Get()
+	ctx, cancel := context.WithTimeout(ctx, cfg.HTTP.Timeout)
+	defer cancel()
+	return database.OrderExists(ctx, s.db, orderID, cfg.Postgres.SelectTimeout)
+}
+
+// page of orders, oldest first, starting after the order with id after
+// (from the beginning when empty). full orders come through GetMany
+func (s *Storage) List(ctx context.Context, after string, limit int) ([]models.Order, error) {
+	cfg := s.cfg.Get()
+	listCtx, cancel := context.WithTimeout(ctx, cfg.HTTP.Timeout)
+	ids, err := database.ListOrderIDs(listCtx, s.db, after, limit, cfg.Postgres.SelectTimeout)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+
+	found, _, err := s.GetMany(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	orders := make([]models.Order, 0, len(ids))
+	for _, id := range ids {
+		if o, ok := found[id]; ok { // missing ones were deleted meanwhile
+			orders = append(orders, o)
+		}
+	}
+	return orders, nil
 }
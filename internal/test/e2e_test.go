@@ -1,26 +1,98 @@
 package e2e_test
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/beganov/L0/internal/api"
+	"github.com/beganov/L0/internal/auth"
+	"github.com/beganov/L0/internal/broker"
+	"github.com/beganov/L0/internal/cache"
 	"github.com/beganov/L0/internal/config"
+	"github.com/beganov/L0/internal/database"
+	"github.com/beganov/L0/internal/erasure"
+	"github.com/beganov/L0/internal/health"
+	"github.com/beganov/L0/internal/lifecycle"
 	"github.com/beganov/L0/internal/models"
+	"github.com/beganov/L0/internal/storage"
 
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
-	"github.com/segmentio/kafka-go"
 	"github.com/stretchr/testify/require"
 )
 
+// pipeline fed by in-memory broker, only Postgres from .env is needed
+type pipeline struct {
+	broker *broker.MemoryBroker
+	url    string // base url of the HTTP API
+	holder *config.Holder
+	db     *pgxpool.Pool
+	cache  *cache.OrderCache
+}
+
+func startPipeline(t *testing.T) *pipeline {
+	t.Helper()
+	_ = godotenv.Load("../../.env")
+	cfg, err := config.Load(nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pingCtx, pingCancel := context.WithTimeout(ctx, 2*time.Second)
+	defer pingCancel()
+	db, err := pgxpool.New(ctx, cfg.Postgres.URL)
+	if err == nil {
+		err = db.Ping(pingCtx)
+	}
+	if err != nil {
+		cancel()
+		t.Skipf("Postgres unavailable: %v", err)
+	}
+	require.NoError(t, database.Migrate(ctx, cfg.Postgres.URL, "", "up", io.Discard))
+
+	holder := config.NewHolder(cfg)
+	orderCache := cache.NewOrderCache(cfg.Cache.Capacity)
+	control := broker.NewControl()
+	mb := broker.NewMemoryBroker(cfg.Kafka.Topic)
+
+	done := make(chan error, 1)
+	go func() { done <- broker.Consume(ctx, holder, mb, db, orderCache, nil, control, nil) }()
+
+	checker := health.NewChecker(holder, db, control, orderCache, lifecycle.NewGroup())
+	ingest := api.NewIngestHandler(holder, mb)
+	srv := httptest.NewServer(api.SetupRouter(holder, orderCache, nil, db, checker, nil, ingest, nil, nil, nil))
+
+	t.Cleanup(func() {
+		srv.Close()
+		cancel()
+		require.NoError(t, <-done)
+		mb.Close()
+		db.Close()
+	})
+	return &pipeline{broker: mb, url: srv.URL, holder: holder, db: db, cache: orderCache}
+}
+
+// wait until consumer acked n messages in total
+func (p *pipeline) waitAcked(t *testing.T, n int) {
+	t.Helper()
+	require.Eventually(t, func() bool { return p.broker.Acked() >= n }, 10*time.Second, 20*time.Millisecond)
+}
+
 func TestE2E_OrderFlow_Advanced(t *testing.T) {
-	require.NoError(t, godotenv.Load("../../.env"))
-	config.VarsInit()
+	p := startPipeline(t)
 
 	cases := []struct {
 		name       string
@@ -90,15 +162,8 @@ func TestE2E_OrderFlow_Advanced(t *testing.T) {
 		},
 	}
 
-	for _, tc := range cases {
+	for i, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
-			w := &kafka.Writer{
-				Addr:     kafka.TCP(config.KafkaBroker),
-				Topic:    config.KafkaTopic,
-				Balancer: &kafka.LeastBytes{},
-			}
-			defer w.Close()
-
 			var val []byte
 			var err error
 			switch o := tc.order.(type) {
@@ -111,12 +176,9 @@ func TestE2E_OrderFlow_Advanced(t *testing.T) {
 				t.Fatalf("unsupported order type")
 			}
 
-			err = w.WriteMessages(context.Background(),
-				kafka.Message{Key: []byte("key-" + strconv.FormatInt(time.Now().UnixNano(), 10)), Value: val},
-			)
-			require.NoError(t, err)
-
-			time.Sleep(2 * time.Second)
+			key := []byte("key-" + strconv.FormatInt(time.Now().UnixNano(), 10))
+			require.NoError(t, p.broker.Publish(context.Background(), broker.Message{Key: key, Value: val}))
+			p.waitAcked(t, i+1)
 
 			orderUID := ""
 			if o, ok := tc.order.(models.Order); ok {
@@ -125,7 +187,7 @@ func TestE2E_OrderFlow_Advanced(t *testing.T) {
 				orderUID = "bad1"
 			}
 
-			resp, err := http.Get("http://localhost:8081/order/" + orderUID)
+			resp, err := http.Get(p.url + "/order/" + orderUID)
 			require.NoError(t, err)
 			defer resp.Body.Close()
 
@@ -140,39 +202,217 @@ func TestE2E_OrderFlow_Advanced(t *testing.T) {
 	}
 }
 
-func TestE2E_OrderFlow_Stress(t *testing.T) {
-	const N = 5
-	require.NoError(t, godotenv.Load("../../.env"))
-	config.VarsInit()
+func TestE2E_SubmitOverHTTP(t *testing.T) {
+	p := startPipeline(t)
+
+	order := generateRandomOrder(0)
+	body, err := json.Marshal(order)
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodPost, p.url+"/orders", bytes.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Idempotency-Key", "e2e-"+order.OrderUID)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	statusURL := resp.Header.Get("Location")
+	require.Equal(t, "/orders/"+order.OrderUID+"/status", statusURL)
 
-	w := &kafka.Writer{
-		Addr:     kafka.TCP(config.KafkaBroker),
-		Topic:    config.KafkaTopic,
-		Balancer: &kafka.LeastBytes{},
+	p.waitAcked(t, 1)
+	resp, err = http.Get(p.url + statusURL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var st struct{ Status string }
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&st))
+	require.Equal(t, "persisted", st.Status)
+}
+
+// bulk lookup on a cold cache reads all orders in one DB round trip
+func TestE2E_BatchGetFromDB(t *testing.T) {
+	p := startPipeline(t)
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		o := generateRandomOrder(i)
+		val, err := json.Marshal(o)
+		require.NoError(t, err)
+		require.NoError(t, p.broker.Publish(context.Background(), broker.Message{Key: []byte(o.OrderUID), Value: val}))
+		ids = append(ids, o.OrderUID)
 	}
-	defer w.Close()
+	p.waitAcked(t, len(ids))
+
+	store := storage.NewStorage(p.holder, cache.NewOrderCache(10), nil, p.db)
+	found, missing, err := store.GetMany(context.Background(), append(ids, "no-such-order", ids[0]))
+	require.NoError(t, err)
+	require.Equal(t, []string{"no-such-order"}, missing)
+	require.Len(t, found, len(ids))
+	for _, id := range ids {
+		want, err := database.GetOrderFromDB(context.Background(), p.db, id, time.Second)
+		require.NoError(t, err)
+		require.Equal(t, want, found[id])
+	}
+}
+
+// filtered GraphQL page with nested parts loaded by dataloader
+func TestE2E_GraphQLOrders(t *testing.T) {
+	p := startPipeline(t)
 
+	customer := fmt.Sprintf("gql-%d", time.Now().UnixNano())
+	for i := 0; i < 3; i++ {
+		o := generateRandomOrder(i)
+		o.CustomerID = customer
+		val, err := json.Marshal(o)
+		require.NoError(t, err)
+		require.NoError(t, p.broker.Publish(context.Background(), broker.Message{Key: []byte(o.OrderUID), Value: val}))
+	}
+	p.waitAcked(t, 3)
+
+	query := `query($c: String) { orders(first: 2, customer_id: $c) {
+		nodes { customer_id payment { currency } items { name } } has_next_page end_cursor } }`
+	body, err := json.Marshal(map[string]any{"query": query, "variables": map[string]any{"c": customer}})
+	require.NoError(t, err)
+	resp, err := http.Post(p.url+"/graphql", "application/json", bytes.NewReader(body))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var res struct {
+		Data struct {
+			Orders struct {
+				Nodes []struct {
+					CustomerID string `json:"customer_id"`
+					Payment    struct{ Currency string }
+					Items      []struct{ Name string }
+				}
+				HasNextPage bool `json:"has_next_page"`
+			}
+		}
+		Errors []any
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+	require.Empty(t, res.Errors)
+	require.Len(t, res.Data.Orders.Nodes, 2)
+	require.True(t, res.Data.Orders.HasNextPage)
+	for _, n := range res.Data.Orders.Nodes {
+		require.Equal(t, customer, n.CustomerID)
+		require.Equal(t, "USD", n.Payment.Currency)
+		require.Len(t, n.Items, 1)
+	}
+}
+
+// erasure by email: dry run changes nothing, then delivery data and customer_id are
+// anonymized, payments stay and cached copies are gone
+func TestE2E_EraseCustomer(t *testing.T) {
+	p := startPipeline(t)
+
+	email := fmt.Sprintf("erase-%d@example.com", time.Now().UnixNano())
+	var ids []string
+	for i := 0; i < 2; i++ {
+		o := generateRandomOrder(i)
+		o.Delivery.Email = email
+		val, err := json.Marshal(o)
+		require.NoError(t, err)
+		require.NoError(t, p.broker.Publish(context.Background(), broker.Message{Key: []byte(o.OrderUID), Value: val}))
+		ids = append(ids, o.OrderUID)
+	}
+	p.waitAcked(t, 2)
+	// taken before the erasure, like a snapshot of another replica
+	snap := filepath.Join(t.TempDir(), "cache.snap")
+	require.NoError(t, p.cache.SaveSnapshot(snap))
+
+	// erasure is served only with auth, the actor goes to the audit
+	keys := filepath.Join(t.TempDir(), "keys")
+	sum := sha256.Sum256([]byte("k-admin"))
+	require.NoError(t, os.WriteFile(keys, []byte("ops admin "+hex.EncodeToString(sum[:])+"\n"), 0o600))
+	authn, err := auth.New(config.AuthConfig{Enabled: true, APIKeysFile: keys})
+	require.NoError(t, err)
+	handler := api.NewErasureHandler(p.holder, erasure.Target{DB: p.db, Cache: p.cache})
+	srv := httptest.NewServer(api.SetupServiceRouter(nil, nil, handler, authn))
+	defer srv.Close()
+
+	erase := func(body string) erasure.Result {
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/admin/erasure", bytes.NewReader([]byte(body)))
+		require.NoError(t, err)
+		req.Header.Set("X-API-Key", "k-admin")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var res erasure.Result
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		return res
+	}
+
+	dry := erase(`{"email": "` + strings.ToUpper(email) + `", "dry_run": true}`)
+	require.ElementsMatch(t, ids, dry.Orders)
+	o, err := database.GetOrderFromDB(context.Background(), p.db, ids[0], time.Second)
+	require.NoError(t, err)
+	require.Equal(t, email, o.Delivery.Email)
+
+	res := erase(`{"email": "` + email + `", "reason": "e2e"}`)
+	require.ElementsMatch(t, ids, res.Orders)
+	require.Equal(t, 2, res.Evicted)
+	for _, id := range ids {
+		o, err := database.GetOrderFromDB(context.Background(), p.db, id, time.Second)
+		require.NoError(t, err)
+		require.Equal(t, database.ErasedName, o.Delivery.Name)
+		require.Empty(t, o.Delivery.Phone+o.Delivery.Email+o.Delivery.Address)
+		require.Equal(t, database.Pseudonym(res.AuditID), o.CustomerID)
+		require.Equal(t, "USD", o.Payment.Currency)
+		require.Len(t, o.Items, 1)
+		_, cached := p.cache.Get(id)
+		require.False(t, cached)
+	}
+
+	var audited int
+	require.NoError(t, p.db.QueryRow(context.Background(),
+		`SELECT count(*) FROM erasure_audit WHERE id IN ($1, $2)`, dry.AuditID, res.AuditID).Scan(&audited))
+	require.Equal(t, 2, audited)
+	var actor string
+	require.NoError(t, p.db.QueryRow(context.Background(),
+		`SELECT actor FROM erasure_audit WHERE id = $1`, res.AuditID).Scan(&actor))
+	require.Equal(t, "apikey:ops", actor)
+
+	restored := cache.NewOrderCache(100)
+	_, _, err = restored.LoadSnapshot(snap)
+	require.NoError(t, err)
+	_, err = erasure.NewWatcher(p.holder, erasure.Target{DB: p.db, Cache: restored}, snap).Sync(context.Background())
+	require.NoError(t, err)
+	for _, id := range ids {
+		_, cached := restored.Get(id)
+		require.False(t, cached, "erased order restored from snapshot")
+	}
+}
+
+func TestE2E_OrderFlow_Stress(t *testing.T) {
+	const N = 5
+	p := startPipeline(t)
+
+	orders := make([]models.Order, N)
 	wg := sync.WaitGroup{}
 	wg.Add(N)
 
 	for i := 0; i < N; i++ {
 		go func(i int) {
 			defer wg.Done()
-			order := generateRandomOrder(i)
-			val, err := json.Marshal(order)
+			orders[i] = generateRandomOrder(i)
+			val, err := json.Marshal(orders[i])
 			require.NoError(t, err)
 
-			err = w.WriteMessages(context.Background(),
-				kafka.Message{Key: []byte(order.OrderUID), Value: val},
-			)
-			require.NoError(t, err)
-			t.Logf("Sent order %s", order.OrderUID)
+			require.NoError(t, p.broker.Publish(context.Background(), broker.Message{Key: []byte(orders[i].OrderUID), Value: val}))
+			t.Logf("Sent order %s", orders[i].OrderUID)
 		}(i)
 	}
 
 	wg.Wait()
+	p.waitAcked(t, N)
 
-	time.Sleep(5 * time.Second)
+	for _, o := range orders {
+		resp, err := http.Get(p.url + "/order/" + o.OrderUID)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
 }
 
 func generateRandomOrder(i int) models.Order {
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS erasure_audit (
+    id BIGSERIAL PRIMARY KEY,
+    requested_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    actor TEXT NOT NULL,
+    key_type TEXT NOT NULL,
+    key_hash TEXT NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    dry_run BOOLEAN NOT NULL,
+    order_uids TEXT[] NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS orders_customer_id_idx ON orders (customer_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS orders_customer_id_idx;
+DROP TABLE IF EXISTS erasure_audit;
+-- +goose StatementEnd